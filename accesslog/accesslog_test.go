@@ -0,0 +1,137 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	values := map[string]string{
+		"remote_addr":     "203.0.113.9",
+		"request":         `GET /?q="x" HTTP/1.1`,
+		"status":          "200",
+		"http_user_agent": "curl\n/8",
+	}
+	get := func(name string) string { return values[name] }
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{`$remote_addr - $remote_user "$request" $status $body_bytes_sent`, `203.0.113.9 - - "GET /?q=\x22x\x22 HTTP/1.1" 200 0`},
+		{`${status}s "$http_user_agent"`, `200s "curl\x0A/8"`},
+		{`escape=json {"ua":"$http_user_agent","user":"$remote_user","bytes":$body_bytes_sent}`, `{"ua":"curl\n/8","user":"","bytes":0}`},
+	}
+	for _, tt := range tests {
+		if got := string(Compile(tt.template).Append(nil, get)); got != tt.want {
+			t.Errorf("%s :\n%s\nattendu\n%s", tt.template, got, tt.want)
+		}
+	}
+
+	if _, err := Lookup("inconnu", nil); err == nil {
+		t.Error("format inconnu accepté")
+	}
+	if f, err := Lookup("", map[string]string{"combined": "$status"}); err != nil || string(f.Append(nil, get)) != "200" {
+		t.Error("log_format ne remplace pas le format intégré")
+	}
+}
+
+// waitFor attend qu'une condition devienne vraie, le logger écrivant depuis
+// sa propre goroutine.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("délai dépassé : %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	logger, err := Open(Options{Path: path, Flush: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, _ := Lookup("json", nil)
+	handler := Handler(logger, format, "exemple.com", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Request-ID") == "" {
+			t.Error("X-Request-ID absent côté backend")
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("créé"))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/items?x=1", nil)
+	r.Header.Set("X-Request-ID", "abc-123")
+	r.Header.Set("User-Agent", `agent "test"`)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("X-Request-ID renvoyé %q", got)
+	}
+
+	var line map[string]any
+	waitFor(t, "ligne de log", func() bool {
+		data, _ := os.ReadFile(path)
+		return json.Unmarshal(data, &line) == nil
+	})
+	want := map[string]any{
+		"site":       "exemple.com",
+		"request_id": "abc-123",
+		"method":     "POST",
+		"uri":        "/items?x=1",
+		"status":     float64(201),
+		"bytes":      float64(len("créé")),
+		"user_agent": `agent "test"`,
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, attendu %v", key, line[key], value)
+		}
+	}
+
+	// Identifiant entrant non conforme : remplacé.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Request-ID", "a b\nc")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if id := w.Header().Get("X-Request-ID"); len(id) != 32 {
+		t.Errorf("X-Request-ID généré %q", id)
+	}
+}
+
+func TestRotateSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	logger, err := Open(Options{Path: path, Flush: 10 * time.Millisecond, RotateSize: 100, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte(strings.Repeat("x", 59) + "\n")
+	for range 10 {
+		logger.Log(line)
+	}
+
+	rotated := func() []string {
+		old, _ := filepath.Glob(path + ".*")
+		return old
+	}
+	waitFor(t, "rotation", func() bool {
+		info, err := os.Stat(path)
+		return len(rotated()) == 2 && err == nil && info.Size() == 0
+	})
+	for _, name := range rotated() {
+		if data, _ := os.ReadFile(name); len(data) != 2*len(line) {
+			t.Errorf("%s : %d octets, attendu %d", name, len(data), 2*len(line))
+		}
+	}
+}
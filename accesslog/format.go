@@ -0,0 +1,136 @@
+// Package accesslog écrit les logs d'accès des sites Goinx : formats common,
+// combined, json ou log_format personnalisés, écriture asynchrone bufferisée
+// et rotation des fichiers.
+package accesslog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const escapeJSONPrefix = "escape=json"
+
+var builtinFormats = map[string]string{
+	"common":   `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`,
+	"combined": `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+	"json": escapeJSONPrefix + ` {"time":"$time_iso8601","site":"$server_name","request_id":"$request_id",` +
+		`"remote_addr":"$remote_addr","method":"$request_method","host":"$host","uri":"$request_uri",` +
+		`"protocol":"$server_protocol","status":$status,"bytes":$body_bytes_sent,"request_time":$request_time,` +
+		`"upstream_addr":"$upstream_addr","upstream_status":"$upstream_status",` +
+		`"upstream_response_time":"$upstream_response_time","tls":"$ssl_protocol",` +
+		`"referer":"$http_referer","user_agent":"$http_user_agent"}`,
+}
+
+// Variables toujours numériques : jamais remplacées par "-", pour garder un
+// JSON valide.
+var numericVariables = map[string]bool{"status": true, "body_bytes_sent": true, "bytes_sent": true, "request_time": true}
+
+var variablePattern = regexp.MustCompile(`\$(\{[a-zA-Z0-9_]+\}|[a-zA-Z0-9_]+)`)
+
+type segment struct {
+	literal  string
+	variable string
+}
+
+// Format est un modèle de ligne compilé.
+type Format struct {
+	segments   []segment
+	escapeJSON bool
+}
+
+// Compile prépare un modèle log_format. Un modèle commençant par
+// "escape=json" échappe les valeurs pour une ligne JSON.
+func Compile(template string) *Format {
+	f := &Format{}
+	if rest, ok := strings.CutPrefix(template, escapeJSONPrefix); ok {
+		f.escapeJSON = true
+		template = strings.TrimSpace(rest)
+	}
+	last := 0
+	for _, loc := range variablePattern.FindAllStringIndex(template, -1) {
+		if loc[0] > last {
+			f.segments = append(f.segments, segment{literal: template[last:loc[0]]})
+		}
+		f.segments = append(f.segments, segment{variable: strings.Trim(template[loc[0]+1:loc[1]], "{}")})
+		last = loc[1]
+	}
+	if last < len(template) {
+		f.segments = append(f.segments, segment{literal: template[last:]})
+	}
+	return f
+}
+
+// Lookup renvoie le format nommé, parmi les log_format déclarés puis les
+// formats intégrés (common, combined, json).
+func Lookup(name string, custom map[string]string) (*Format, error) {
+	if name == "" {
+		name = "combined"
+	}
+	if template, ok := custom[name]; ok {
+		return Compile(template), nil
+	}
+	if template, ok := builtinFormats[name]; ok {
+		return Compile(template), nil
+	}
+	return nil, fmt.Errorf("format de log inconnu : %s", name)
+}
+
+// Append ajoute à buf la ligne produite avec get, sans retour à la ligne.
+func (f *Format) Append(buf []byte, get func(name string) string) []byte {
+	for _, s := range f.segments {
+		if s.variable == "" {
+			buf = append(buf, s.literal...)
+			continue
+		}
+		value := get(s.variable)
+		switch {
+		case value == "" && numericVariables[s.variable]:
+			buf = append(buf, '0')
+		case f.escapeJSON:
+			buf = appendJSONEscaped(buf, value)
+		case value == "":
+			buf = append(buf, '-')
+		default:
+			buf = appendEscaped(buf, value)
+		}
+	}
+	return buf
+}
+
+// appendEscaped protège le format texte contre l'injection de lignes et de
+// guillemets, comme nginx (\xHH).
+func appendEscaped(buf []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '"' || c == '\\' || c < 0x20 || c == 0x7f {
+			buf = append(buf, '\\', 'x')
+			buf = append(buf, strings.ToUpper(strconv.FormatUint(uint64(c)|0x100, 16)[1:])...)
+			continue
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+func appendJSONEscaped(buf []byte, value string) []byte {
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			buf = append(buf, '\\', byte(r))
+		case r == '\n':
+			buf = append(buf, '\\', 'n')
+		case r == '\r':
+			buf = append(buf, '\\', 'r')
+		case r == '\t':
+			buf = append(buf, '\\', 't')
+		case r < 0x20 || r == utf8.RuneError:
+			buf = append(buf, fmt.Sprintf(`\u%04x`, r)...)
+		default:
+			buf = utf8.AppendRune(buf, r)
+		}
+	}
+	return buf
+}
@@ -0,0 +1,188 @@
+package accesslog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OxiWanV2/Goinx/server"
+)
+
+const maxRequestIDLength = 128
+
+// Handler journalise chaque requête de next dans l. Il attribue aussi le
+// X-Request-ID, transmis au backend et renvoyé au client.
+func Handler(l *Logger, f *Format, site string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &server.RequestInfo{ID: requestID(r), Start: time.Now()}
+		r.Header.Set("X-Request-ID", info.ID)
+		w.Header().Set("X-Request-ID", info.ID)
+		r = r.WithContext(server.WithRequestInfo(r.Context(), info))
+
+		lw := &logWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+
+		end := time.Now()
+		vars := server.Vars{Request: r, Lookup: func(name string) (string, bool) {
+			return lw.variable(name, r, info, site, end)
+		}}
+		line := f.Append(make([]byte, 0, 256), func(name string) string {
+			value, _ := vars.Get(name)
+			return value
+		})
+		l.Log(append(line, '\n'))
+	})
+}
+
+// requestID reprend un X-Request-ID entrant raisonnable, sinon en génère un.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= maxRequestIDLength && isToken(id) {
+		return id
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func isToken(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+type logWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *logWriter) WriteHeader(code int) {
+	if w.status == 0 || w.status < 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *logWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *logWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *logWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// variable renvoie les variables propres au log d'accès ; les autres
+// ($host, $http_*...) sont celles de server.Vars.
+func (w *logWriter) variable(name string, r *http.Request, info *server.RequestInfo, site string, end time.Time) (string, bool) {
+	switch name {
+	case "status":
+		status := w.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		return strconv.Itoa(status), true
+	case "body_bytes_sent", "bytes_sent":
+		return strconv.FormatInt(w.bytes, 10), true
+	case "request_time":
+		return seconds(end.Sub(info.Start)), true
+	case "time_local":
+		return end.Format("02/Jan/2006:15:04:05 -0700"), true
+	case "time_iso8601":
+		return end.Format(time.RFC3339), true
+	case "msec":
+		return strconv.FormatFloat(float64(end.UnixMilli())/1000, 'f', 3, 64), true
+	case "request":
+		return r.Method + " " + r.RequestURI + " " + r.Proto, true
+	case "server_protocol":
+		return r.Proto, true
+	case "server_name":
+		return site, true
+	case "request_id":
+		return info.ID, true
+	case "remote_user":
+		user, _, _ := r.BasicAuth()
+		return user, true
+	case "ssl_protocol":
+		if r.TLS == nil {
+			return "", true
+		}
+		return tlsVersion(r.TLS.Version), true
+	case "ssl_cipher":
+		if r.TLS == nil {
+			return "", true
+		}
+		return tls.CipherSuiteName(r.TLS.CipherSuite), true
+	}
+
+	upstream := info.Upstream()
+	switch name {
+	case "upstream_addr":
+		return upstream.Addr, true
+	case "upstream_status":
+		if upstream.Addr == "" {
+			return "", true
+		}
+		return strconv.Itoa(upstream.Status), true
+	case "upstream_header_time":
+		if upstream.Addr == "" {
+			return "", true
+		}
+		return seconds(upstream.HeaderTime), true
+	case "upstream_response_time":
+		if upstream.Addr == "" {
+			return "", true
+		}
+		return seconds(upstream.Time), true
+	}
+	return "", false
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// tlsVersion suit la notation de nginx (TLSv1.3).
+func tlsVersion(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLSv1"
+	case tls.VersionTLS11:
+		return "TLSv1.1"
+	case tls.VersionTLS12:
+		return "TLSv1.2"
+	case tls.VersionTLS13:
+		return "TLSv1.3"
+	}
+	return tls.VersionName(version)
+}
@@ -0,0 +1,218 @@
+package accesslog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+
+	defaultBuffer = 64 << 10
+	defaultFlush  = time.Second
+
+	// Lignes en attente avant que les suivantes ne soient perdues : une
+	// écriture lente ne doit jamais ralentir les requêtes.
+	queueSize = 8192
+)
+
+type Options struct {
+	Path       string        // Fichier, "stdout" ou "stderr"
+	Buffer     int           // Taille du buffer d'écriture
+	Flush      time.Duration // Délai max avant écriture effective
+	RotateSize int64         // Rotation au-delà de cette taille, 0 = jamais
+	RotateTime time.Duration // Rotation à cet intervalle, 0 = jamais
+	Keep       int           // Anciens fichiers conservés, 0 = tous
+}
+
+// Logger écrit les lignes d'un fichier de log depuis une goroutine dédiée.
+type Logger struct {
+	mu   sync.Mutex // Protège opts, modifiables à chaud par Open
+	opts Options
+
+	queue   chan []byte
+	reopen  chan struct{}
+	dropped atomic.Int64
+
+	out    io.Writer
+	file   *os.File
+	w      *bufio.Writer
+	size   int64
+	opened time.Time
+}
+
+var (
+	loggersMu  sync.Mutex
+	loggers    = make(map[string]*Logger)
+	signalOnce sync.Once
+)
+
+// Open renvoie le logger d'un chemin, partagé entre les sites qui y écrivent
+// et conservé d'un reload à l'autre. Les réglages sont ceux du dernier appel.
+func Open(opts Options) (*Logger, error) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultBuffer
+	}
+	if opts.Flush <= 0 {
+		opts.Flush = defaultFlush
+	}
+	signalOnce.Do(func() { notifyReopen(ReopenAll) })
+
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	if l, ok := loggers[opts.Path]; ok {
+		l.mu.Lock()
+		l.opts = opts
+		l.mu.Unlock()
+		return l, nil
+	}
+
+	l := &Logger{
+		opts:   opts,
+		queue:  make(chan []byte, queueSize),
+		reopen: make(chan struct{}, 1),
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	loggers[opts.Path] = l
+	go l.run()
+	return l, nil
+}
+
+// ReopenAll rouvre tous les fichiers de log, après une rotation externe
+// (logrotate puis SIGUSR1).
+func ReopenAll() {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	for _, l := range loggers {
+		select {
+		case l.reopen <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Log met une ligne en file d'attente sans jamais bloquer.
+func (l *Logger) Log(line []byte) {
+	select {
+	case l.queue <- line:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+func (l *Logger) settings() Options {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.opts
+}
+
+func (l *Logger) open() error {
+	opts := l.settings()
+	switch opts.Path {
+	case Stdout:
+		l.out = os.Stdout
+	case Stderr:
+		l.out = os.Stderr
+	default:
+		if err := os.MkdirAll(filepath.Dir(opts.Path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		l.file, l.out, l.size = file, file, info.Size()
+	}
+	l.opened = time.Now()
+	l.w = bufio.NewWriterSize(l.out, opts.Buffer)
+	return nil
+}
+
+func (l *Logger) close() {
+	l.w.Flush()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+func (l *Logger) run() {
+	ticker := time.NewTicker(l.settings().Flush)
+	defer ticker.Stop()
+	for {
+		select {
+		case line := <-l.queue:
+			n, _ := l.w.Write(line)
+			l.size += int64(n)
+			if opts := l.settings(); opts.RotateSize > 0 && l.size >= opts.RotateSize {
+				l.rotate()
+			}
+		case <-ticker.C:
+			l.w.Flush()
+			if n := l.dropped.Swap(0); n > 0 {
+				log.Printf("Log d'accès %s saturé : %d lignes perdues", l.settings().Path, n)
+			}
+			if opts := l.settings(); opts.RotateTime > 0 && time.Since(l.opened) >= opts.RotateTime {
+				l.rotate()
+			}
+		case <-l.reopen:
+			l.close()
+			if err := l.open(); err != nil {
+				log.Printf("Réouverture du log d'accès %s impossible : %v", l.settings().Path, err)
+				l.out, l.w = io.Discard, bufio.NewWriter(io.Discard)
+			}
+		}
+	}
+}
+
+// rotate renomme le fichier courant avec un horodatage, en ouvre un neuf et
+// supprime les plus anciens au-delà de Keep.
+func (l *Logger) rotate() {
+	opts := l.settings()
+	if l.file == nil {
+		l.opened = time.Now()
+		return
+	}
+	l.close()
+	rotated := opts.Path + "." + time.Now().Format("20060102-150405")
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(rotated); os.IsNotExist(err) {
+			break
+		}
+		rotated = fmt.Sprintf("%s.%s-%d", opts.Path, time.Now().Format("20060102-150405"), i)
+	}
+	if err := os.Rename(opts.Path, rotated); err != nil {
+		log.Printf("Rotation du log d'accès %s impossible : %v", opts.Path, err)
+	}
+	if err := l.open(); err != nil {
+		log.Printf("Réouverture du log d'accès %s impossible : %v", opts.Path, err)
+		l.out, l.w = io.Discard, bufio.NewWriter(io.Discard)
+		return
+	}
+
+	if opts.Keep <= 0 {
+		return
+	}
+	old, _ := filepath.Glob(opts.Path + ".*")
+	sort.Strings(old)
+	for len(old) > opts.Keep {
+		os.Remove(old[0])
+		old = old[1:]
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package accesslog
+
+// Pas de SIGUSR1 : la réouverture passe uniquement par ReopenAll.
+func notifyReopen(reopen func()) {}
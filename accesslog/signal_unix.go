@@ -0,0 +1,20 @@
+//go:build unix
+
+package accesslog
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyReopen appelle reopen à chaque SIGUSR1, comme nginx.
+func notifyReopen(reopen func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		for range ch {
+			reopen()
+		}
+	}()
+}
@@ -3,10 +3,12 @@ package backend
 import (
     "bufio"
     "fmt"
+    "io"
     "log"
     "os/exec"
     "path/filepath"
     "sync"
+    "time"
 )
 
 type BackendInstance struct {
@@ -14,14 +16,18 @@ type BackendInstance struct {
     Cmd      *exec.Cmd
     mu       sync.Mutex
     Running  bool
+    logs     *logHub
+    done     chan struct{} // Fermé à la sortie du processus
 }
 
 var (
-    backendsMu   sync.Mutex
-    backends     = make(map[string]*BackendInstance)
-    backendsLogs = make(map[string]chan string)
+    backendsMu sync.Mutex
+    backends   = make(map[string]*BackendInstance)
+    starts     = make(map[string]uint64) // Lancements par site depuis le démarrage
 )
 
+const stopTimeout = 10 * time.Second
+
 func LaunchNodeBackend(siteName, backendDir, backendFile string) error {
     if backendFile == "" {
         log.Printf("BackendFile vide pour site %s, impossible de lancer le backend", siteName)
@@ -50,24 +56,6 @@ func LaunchNodeBackend(siteName, backendDir, backendFile string) error {
         return err
     }
 
-    logChan := make(chan string, 100)
-    backendsMu.Lock()
-    backendsLogs[siteName] = logChan
-    backendsMu.Unlock()
-
-    go func() {
-        scannerOut := bufio.NewScanner(stdoutPipe)
-        for scannerOut.Scan() {
-            logChan <- scannerOut.Text()
-        }
-    }()
-    go func() {
-        scannerErr := bufio.NewScanner(stderrPipe)
-        for scannerErr.Scan() {
-            logChan <- scannerErr.Text()
-        }
-    }()
-
     if err := cmd.Start(); err != nil {
         return err
     }
@@ -76,19 +64,36 @@ func LaunchNodeBackend(siteName, backendDir, backendFile string) error {
         SiteName: siteName,
         Cmd:      cmd,
         Running:  true,
+        logs:     newLogHub(),
+        done:     make(chan struct{}),
     }
 
     backendsMu.Lock()
     backends[siteName] = bi
+    starts[siteName]++
     backendsMu.Unlock()
 
+    // Les lignes sont lues même sans abonné : un pipe plein bloquerait node.
+    var pipes sync.WaitGroup
+    pipes.Add(2)
+    for _, pipe := range []io.Reader{stdoutPipe, stderrPipe} {
+        go func(pipe io.Reader) {
+            defer pipes.Done()
+            scanner := bufio.NewScanner(pipe)
+            for scanner.Scan() {
+                bi.logs.publish(scanner.Text())
+            }
+        }(pipe)
+    }
+
     go func() {
+        pipes.Wait()
         err := cmd.Wait()
         backendsMu.Lock()
         bi.Running = false
-        close(logChan)
-        delete(backendsLogs, siteName)
         backendsMu.Unlock()
+        bi.logs.close()
+        close(bi.done)
 
         if err != nil {
             log.Printf("Backend nodejs site %s fermé avec erreur : %v", siteName, err)
@@ -101,6 +106,7 @@ func LaunchNodeBackend(siteName, backendDir, backendFile string) error {
     return nil
 }
 
+// StopBackend tue le backend du site et attend la fin du processus.
 func StopBackend(siteName string) error {
     backendsMu.Lock()
     bi, exists := backends[siteName]
@@ -111,20 +117,36 @@ func StopBackend(siteName string) error {
     if err := bi.Cmd.Process.Kill(); err != nil {
         return err
     }
-    backendsMu.Lock()
-    bi.Running = false
-    close(backendsLogs[siteName])
-    delete(backendsLogs, siteName)
-    backendsMu.Unlock()
+    select {
+    case <-bi.done:
+    case <-time.After(stopTimeout):
+        return fmt.Errorf("backend site %s toujours actif après %s", siteName, stopTimeout)
+    }
     log.Printf("Backend site %s stoppé", siteName)
     return nil
 }
 
-func GetBackendLogChannel(siteName string) (chan string, bool) {
+// SubscribeLogs abonne aux lignes du backend en cours du site. cancel doit
+// être appelé en fin de lecture ; le canal est fermé à l'arrêt du backend.
+func SubscribeLogs(siteName string) (lines <-chan string, cancel func(), ok bool) {
     backendsMu.Lock()
-    defer backendsMu.Unlock()
-    ch, ok := backendsLogs[siteName]
-    return ch, ok
+    bi, exists := backends[siteName]
+    backendsMu.Unlock()
+    if !exists {
+        return nil, nil, false
+    }
+    return bi.logs.subscribe()
+}
+
+// RecentLogs renvoie les dernières lignes du backend du site, même arrêté.
+func RecentLogs(siteName string) []string {
+    backendsMu.Lock()
+    bi, exists := backends[siteName]
+    backendsMu.Unlock()
+    if !exists {
+        return nil
+    }
+    return bi.logs.recentLines()
 }
 
 func GetActiveBackends() []string {
@@ -138,3 +160,21 @@ func GetActiveBackends() []string {
     }
     return activeSites
 }
+
+type BackendStats struct {
+    Running  bool
+    Restarts uint64 // Lancements après le premier
+}
+
+func Stats() map[string]BackendStats {
+    backendsMu.Lock()
+    defer backendsMu.Unlock()
+    out := make(map[string]BackendStats, len(backends))
+    for siteName, bi := range backends {
+        out[siteName] = BackendStats{
+            Running:  bi.Running,
+            Restarts: starts[siteName] - 1,
+        }
+    }
+    return out
+}
@@ -0,0 +1,74 @@
+package backend
+
+import "sync"
+
+// Lignes conservées pour qui se connecte après coup (CLI, API d'admin).
+const recentLogLines = 200
+
+// logHub diffuse les lignes d'un backend à plusieurs lecteurs. Un lecteur
+// trop lent perd des lignes plutôt que de bloquer le backend.
+type logHub struct {
+	mu     sync.Mutex
+	recent []string
+	next   int
+	subs   map[chan string]struct{}
+	closed bool
+}
+
+func newLogHub() *logHub {
+	return &logHub{subs: make(map[chan string]struct{})}
+}
+
+func (h *logHub) publish(line string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.recent) < recentLogLines {
+		h.recent = append(h.recent, line)
+	} else {
+		h.recent[h.next] = line
+		h.next = (h.next + 1) % recentLogLines
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+func (h *logHub) subscribe() (<-chan string, func(), bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, nil, false
+	}
+	ch := make(chan string, 100)
+	h.subs[ch] = struct{}{}
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel, true
+}
+
+func (h *logHub) recentLines() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]string, 0, len(h.recent))
+	out = append(out, h.recent[h.next:]...)
+	return append(out, h.recent[:h.next]...)
+}
+
+func (h *logHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
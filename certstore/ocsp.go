@@ -0,0 +1,158 @@
+package certstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	ocspTimeout    = 10 * time.Second
+	ocspRetry      = 10 * time.Minute
+	ocspMinRefresh = time.Hour
+)
+
+// OCSPCache agrafe aux certificats la réponse OCSP de leur émetteur. Les
+// réponses sont demandées en arrière-plan et rafraîchies à mi-validité : une
+// poignée de main n'attend jamais le répondeur OCSP.
+type OCSPCache struct {
+	mu      sync.Mutex
+	entries map[[32]byte]*ocspEntry // Par empreinte du certificat
+	client  *http.Client
+}
+
+type ocspEntry struct {
+	staple   []byte
+	refresh  time.Time // Prochaine demande au répondeur
+	expires  time.Time // NextUpdate de la réponse agrafée
+	fetching bool
+}
+
+func NewOCSPCache() *OCSPCache {
+	return &OCSPCache{
+		entries: make(map[[32]byte]*ocspEntry),
+		client:  &http.Client{Timeout: ocspTimeout},
+	}
+}
+
+// Staple renvoie cert avec sa réponse OCSP si elle est connue et valide,
+// sinon cert tel quel. Le certificat d'origine n'est pas modifié.
+func (c *OCSPCache) Staple(cert *tls.Certificate) *tls.Certificate {
+	if cert == nil || cert.Leaf == nil || len(cert.Leaf.OCSPServer) == 0 || len(cert.Certificate) < 2 {
+		return cert
+	}
+	key := sha256.Sum256(cert.Certificate[0])
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &ocspEntry{}
+		c.entries[key] = entry
+	}
+	if !entry.fetching && !time.Now().Before(entry.refresh) {
+		entry.fetching = true
+		go c.fetch(key, cert)
+	}
+	staple := entry.staple
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		staple = nil
+	}
+	c.mu.Unlock()
+
+	if staple == nil {
+		return cert
+	}
+	stapled := *cert
+	stapled.OCSPStaple = staple
+	return &stapled
+}
+
+func (c *OCSPCache) fetch(key [32]byte, cert *tls.Certificate) {
+	resp, der, err := c.request(cert)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[key]
+	entry.fetching = false
+	if err != nil {
+		log.Printf("OCSP %s : %v", cert.Leaf.Subject, err)
+		entry.refresh = time.Now().Add(ocspRetry)
+		return
+	}
+	if resp.Status != ocsp.Good {
+		// Une réponse "révoqué" agrafée ferait échouer tous les clients.
+		log.Printf("OCSP %s : certificat déclaré %s par l'émetteur, agrafage suspendu", cert.Leaf.Subject, ocspStatus(resp.Status))
+		entry.staple, entry.expires = nil, time.Time{}
+		entry.refresh = time.Now().Add(ocspRetry)
+		return
+	}
+	entry.staple, entry.expires = der, resp.NextUpdate
+	refresh := resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+	if resp.NextUpdate.IsZero() || time.Until(refresh) < ocspMinRefresh {
+		refresh = time.Now().Add(ocspMinRefresh)
+	}
+	entry.refresh = refresh
+}
+
+func (c *OCSPCache) request(cert *tls.Certificate) (*ocsp.Response, []byte, error) {
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("émetteur illisible : %v", err)
+	}
+	body, err := ocsp.CreateRequest(cert.Leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lastErr error
+	for _, server := range cert.Leaf.OCSPServer {
+		ctx, cancel := context.WithTimeout(context.Background(), ocspTimeout)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(body))
+		if err != nil {
+			cancel()
+			lastErr = err
+			continue
+		}
+		req.Header.Set("Content-Type", "application/ocsp-request")
+		httpResp, err := c.client.Do(req)
+		if err != nil {
+			cancel()
+			lastErr = err
+			continue
+		}
+		der, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+		httpResp.Body.Close()
+		cancel()
+		if err != nil || httpResp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("%s répond %s", server, httpResp.Status)
+			continue
+		}
+		resp, err := ocsp.ParseResponseForCert(der, cert.Leaf, issuer)
+		if err != nil {
+			lastErr = fmt.Errorf("réponse de %s invalide : %v", server, err)
+			continue
+		}
+		return resp, der, nil
+	}
+	return nil, nil, lastErr
+}
+
+func ocspStatus(status int) string {
+	switch status {
+	case ocsp.Revoked:
+		return "révoqué"
+	case ocsp.Unknown:
+		return "inconnu"
+	}
+	return "valide"
+}
@@ -0,0 +1,147 @@
+package certstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspChain émet un certificat signé par une CA de test dont le répondeur
+// OCSP renvoie status.
+func ocspChain(t *testing.T, status int) (*tls.Certificate, *atomic.Int32) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CA de test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	var requests atomic.Int32
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(24 * time.Hour),
+			RevokedAt:    time.Now().Add(-time.Minute),
+		}, caKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+	t.Cleanup(responder.Close)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "exemple.com"},
+		DNSNames:     []string{"exemple.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{responder.URL},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return &tls.Certificate{Certificate: [][]byte{der, caDER}, PrivateKey: key, Leaf: leaf}, &requests
+}
+
+func TestOCSPStaple(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		stapled bool
+	}{
+		{"certificat valide", ocsp.Good, true},
+		{"certificat révoqué", ocsp.Revoked, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, requests := ocspChain(t, tt.status)
+			c := NewOCSPCache()
+
+			// La première poignée de main n'attend pas le répondeur.
+			if first := c.Staple(cert); first.OCSPStaple != nil {
+				t.Fatal("réponse agrafée avant la demande")
+			}
+			deadline := time.Now().Add(2 * time.Second)
+			for requests.Load() == 0 || c.pending() {
+				if time.Now().After(deadline) {
+					t.Fatal("répondeur OCSP jamais interrogé")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			stapled := c.Staple(cert)
+			if (stapled.OCSPStaple != nil) != tt.stapled {
+				t.Errorf("agrafage %v, attendu %v", stapled.OCSPStaple != nil, tt.stapled)
+			}
+			if cert.OCSPStaple != nil {
+				t.Error("certificat d'origine modifié")
+			}
+			if n := requests.Load(); n != 1 {
+				t.Errorf("%d demandes au répondeur, attendu 1 avant le rafraîchissement", n)
+			}
+		})
+	}
+}
+
+func TestOCSPStapleSkipped(t *testing.T) {
+	c := NewOCSPCache()
+	selfSigned := &tls.Certificate{Certificate: [][]byte{{0}}, Leaf: &x509.Certificate{OCSPServer: []string{"http://ocsp.test"}}}
+	noResponder := &tls.Certificate{Certificate: [][]byte{{0}, {1}}, Leaf: &x509.Certificate{}}
+	for _, cert := range []*tls.Certificate{nil, selfSigned, noResponder} {
+		if got := c.Staple(cert); got != cert {
+			t.Errorf("certificat sans OCSP modifié : %v", got)
+		}
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("%d entrées créées sans répondeur", len(c.entries))
+	}
+}
+
+// pending indique si une demande OCSP est en cours.
+func (c *OCSPCache) pending() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range c.entries {
+		if entry.fetching {
+			return true
+		}
+	}
+	return false
+}
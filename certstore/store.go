@@ -0,0 +1,209 @@
+// Package certstore choisit le certificat TLS à présenter selon le SNI, parmi
+// des certificats fichiers et des gestionnaires ACME, pour un même port.
+package certstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// GetCertificateFunc est la signature de tls.Config.GetCertificate, fournie
+// par exemple par autocert.Manager.
+type GetCertificateFunc func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+// acmeALPN est le protocole du challenge TLS-ALPN-01.
+const acmeALPN = "acme-tls/1"
+
+type fileCert struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+	stamp    fileStamp // Version chargée, voir Watch
+}
+
+type Store struct {
+	mu              sync.RWMutex
+	files           map[[2]string]*fileCert // Par couple (certificat, clé), chargé une fois
+	exact           map[string]*fileCert
+	wildcard        map[string]*fileCert // "exemple.com" pour "*.exemple.com"
+	acme            map[string]GetCertificateFunc
+	issuers         map[string]GetCertificateFunc // Émission à la demande (CA locale)
+	wildcardIssuers map[string]GetCertificateFunc
+	fallback        func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	stop            chan struct{}
+}
+
+func New() *Store {
+	return &Store{
+		files:           make(map[[2]string]*fileCert),
+		exact:           make(map[string]*fileCert),
+		wildcard:        make(map[string]*fileCert),
+		acme:            make(map[string]GetCertificateFunc),
+		issuers:         make(map[string]GetCertificateFunc),
+		wildcardIssuers: make(map[string]GetCertificateFunc),
+	}
+}
+
+// AddFile charge un certificat pour host ("*.exemple.com" accepté). Les SAN
+// du certificat sont aussi servis, sans remplacer un host déclaré ailleurs.
+func (s *Store) AddFile(host, certFile, keyFile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [2]string{certFile, keyFile}
+	fc, ok := s.files[key]
+	if !ok {
+		cert, err := loadKeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		fc = &fileCert{certFile: certFile, keyFile: keyFile}
+		fc.cert.Store(cert)
+		s.files[key] = fc
+	}
+
+	s.index(normalize(host), fc, true)
+	for _, name := range fc.cert.Load().Leaf.DNSNames {
+		s.index(normalize(name), fc, false)
+	}
+	return nil
+}
+
+func (s *Store) index(name string, fc *fileCert, override bool) {
+	table := s.exact
+	if base, ok := strings.CutPrefix(name, "*."); ok {
+		table, name = s.wildcard, base
+	}
+	if _, exists := table[name]; exists && !override {
+		return
+	}
+	table[name] = fc
+}
+
+// AddACME délègue host à un gestionnaire ACME.
+func (s *Store) AddACME(host string, get GetCertificateFunc) {
+	s.mu.Lock()
+	s.acme[normalize(host)] = get
+	s.mu.Unlock()
+}
+
+// AddIssuer délègue host ("*.exemple.com" accepté) à un émetteur de
+// certificats à la demande, comme la CA locale.
+func (s *Store) AddIssuer(host string, get GetCertificateFunc) {
+	name := normalize(host)
+	s.mu.Lock()
+	if base, ok := strings.CutPrefix(name, "*."); ok {
+		s.wildcardIssuers[base] = get
+	} else {
+		s.issuers[name] = get
+	}
+	s.mu.Unlock()
+}
+
+// SetDefault choisit le certificat présenté sans SNI ou pour un nom inconnu :
+// celui servi pour host.
+func (s *Store) SetDefault(host string) {
+	host = normalize(host)
+	s.mu.Lock()
+	s.fallback = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return s.lookup(host, hello)
+	}
+	s.mu.Unlock()
+}
+
+// HasACME indique si un host du store passe par ACME, pour annoncer
+// acme-tls/1 en ALPN.
+func (s *Store) HasACME() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.acme) > 0
+}
+
+// GetCertificate s'utilise comme tls.Config.GetCertificate.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := normalize(hello.ServerName)
+	if cert, err := s.lookup(name, hello); cert != nil || err != nil {
+		return cert, err
+	}
+
+	s.mu.RLock()
+	fallback := s.fallback
+	s.mu.RUnlock()
+	if fallback != nil {
+		return fallback(hello)
+	}
+	return nil, fmt.Errorf("aucun certificat pour %q", hello.ServerName)
+}
+
+func (s *Store) lookup(name string, hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	acme, isACME := s.acme[name]
+	fc, isFile := s.exact[name]
+	issuer, isIssuer := s.issuers[name]
+	if !isFile && !isACME && !isIssuer {
+		if _, base, ok := strings.Cut(name, "."); ok {
+			fc, isFile = s.wildcard[base]
+			if !isFile {
+				issuer, isIssuer = s.wildcardIssuers[base]
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	// Le challenge TLS-ALPN-01 doit toujours atteindre le gestionnaire ACME.
+	if isACME && (!isFile || isChallenge(hello)) {
+		return acme(withName(hello, name))
+	}
+	if isFile {
+		return fc.cert.Load(), nil
+	}
+	if isIssuer {
+		return issuer(withName(hello, name))
+	}
+	return nil, nil
+}
+
+// withName présente le ClientHello sous le nom retenu : un client sans SNI
+// ou au nom inconnu, servi par défaut, reçoit le certificat du host par
+// défaut, pas un certificat émis pour son propre nom.
+func withName(hello *tls.ClientHelloInfo, name string) *tls.ClientHelloInfo {
+	if normalize(hello.ServerName) == name {
+		return hello
+	}
+	clone := *hello
+	clone.ServerName = name
+	return &clone
+}
+
+func isChallenge(hello *tls.ClientHelloInfo) bool {
+	for _, proto := range hello.SupportedProtos {
+		if proto == acmeALPN {
+			return true
+		}
+	}
+	return false
+}
+
+func normalize(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// loadKeyPair charge et vérifie un couple certificat/clé ; Leaf est rempli.
+func loadKeyPair(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("chargement %s / %s : %v", certFile, keyFile, err)
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("lecture %s : %v", certFile, err)
+		}
+		cert.Leaf = leaf
+	}
+	return &cert, nil
+}
@@ -0,0 +1,140 @@
+package certstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert écrit un certificat autosigné pour les noms donnés ; le premier
+// sert de CN, pour reconnaître le certificat présenté.
+func writeCert(t *testing.T, dir string, names ...string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, names[0]+".crt")
+	keyFile = filepath.Join(dir, names[0]+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+// issuerCert renvoie un faux certificat au nom demandé, comme le ferait
+// un gestionnaire ACME ou la CA locale.
+func issuerCert(origin string) GetCertificateFunc {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return &tls.Certificate{Leaf: &x509.Certificate{Subject: pkix.Name{CommonName: origin + ":" + hello.ServerName}}}, nil
+	}
+}
+
+type sniCase struct {
+	name   string
+	protos []string
+	want   string // CN du certificat présenté, "" = aucun
+}
+
+func checkSNI(t *testing.T, s *Store, tests []sniCase) {
+	t.Helper()
+	for _, tt := range tests {
+		cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.name, SupportedProtos: tt.protos})
+		got := ""
+		if cert != nil {
+			got = cert.Leaf.Subject.CommonName
+		}
+		if got != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("SNI %q %v : certificat %q (erreur %v), attendu %q", tt.name, tt.protos, got, err, tt.want)
+		}
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	dir := t.TempDir()
+	s := New()
+	add := func(host string, names ...string) {
+		certFile, keyFile := writeCert(t, dir, names...)
+		if err := s.AddFile(host, certFile, keyFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("exemple.com", "exemple.com", "www.exemple.com", "api.exemple.com")
+	add("*.exemple.com", "*.exemple.com")
+	add("api.exemple.com", "api.exemple.com") // Déclaré : prioritaire sur le SAN
+	add("mixte.test", "mixte.test")
+	s.AddACME("acme.test", issuerCert("acme"))
+	s.AddACME("mixte.test", issuerCert("acme"))
+	s.AddIssuer("*.local.test", issuerCert("ca"))
+
+	checkSNI(t, s, []sniCase{
+		{"exemple.com", nil, "exemple.com"},
+		{"WWW.Exemple.com.", nil, "exemple.com"}, // SAN, casse et point final
+		{"api.exemple.com", nil, "api.exemple.com"},
+		{"blog.exemple.com", nil, "*.exemple.com"},
+		{"a.b.exemple.com", nil, ""}, // Un joker ne couvre qu'un niveau
+		{"acme.test", nil, "acme:acme.test"},
+		{"mixte.test", nil, "mixte.test"},
+		{"mixte.test", []string{"acme-tls/1"}, "acme:mixte.test"}, // Challenge TLS-ALPN-01
+		{"app.local.test", nil, "ca:app.local.test"},
+		{"inconnu.test", nil, ""},
+		{"", nil, ""},
+	})
+	if !s.HasACME() {
+		t.Error("HasACME faux")
+	}
+
+	// Certificat par défaut : clients sans SNI et noms inconnus, y compris
+	// quand le host par défaut est servi par un émetteur.
+	s.SetDefault("exemple.com")
+	checkSNI(t, s, []sniCase{
+		{"inconnu.test", nil, "exemple.com"},
+		{"", nil, "exemple.com"},
+		{"acme.test", nil, "acme:acme.test"},
+	})
+	s.SetDefault("app.local.test")
+	checkSNI(t, s, []sniCase{
+		{"", nil, "ca:app.local.test"},
+	})
+}
+
+func TestAddFileShared(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "exemple.com", "www.exemple.com")
+	s := New()
+	if err := s.AddFile("exemple.com", certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddFile("www.exemple.com", certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.files) != 1 {
+		t.Errorf("%d chargements pour un même couple, attendu 1", len(s.files))
+	}
+	if err := s.AddFile("absent.test", filepath.Join(dir, "absent.crt"), keyFile); err == nil {
+		t.Error("certificat absent accepté")
+	}
+}
@@ -0,0 +1,146 @@
+package certstore
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// Vérification périodique, au cas où fsnotify manque un événement ou
+	// n'est pas disponible (NFS...).
+	pollInterval = time.Minute
+	// Délai après un événement, le temps que certificat et clé soient écrits.
+	reloadDelay = 500 * time.Millisecond
+)
+
+// fileStamp identifie une version d'un couple certificat/clé.
+type fileStamp struct {
+	certMod  time.Time
+	certSize int64
+	keyMod   time.Time
+	keySize  int64
+}
+
+func stampOf(certFile, keyFile string) fileStamp {
+	var st fileStamp
+	if info, err := os.Stat(certFile); err == nil {
+		st.certMod, st.certSize = info.ModTime(), info.Size()
+	}
+	if info, err := os.Stat(keyFile); err == nil {
+		st.keyMod, st.keySize = info.ModTime(), info.Size()
+	}
+	return st
+}
+
+// Watch recharge à chaud les certificats fichiers modifiés. Les dossiers
+// sont surveillés plutôt que les fichiers, pour suivre les remplacements par
+// renommage ou lien symbolique.
+func (s *Store) Watch() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	dirs := make(map[string]bool)
+	for key := range s.files {
+		dirs[filepath.Dir(key[0])] = true
+		dirs[filepath.Dir(key[1])] = true
+	}
+	stop := s.stop
+	s.mu.Unlock()
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("fsnotify indisponible, certificats vérifiés toutes les %s : %v", pollInterval, err)
+		w = nil
+	} else {
+		for dir := range dirs {
+			if err := w.Add(dir); err != nil {
+				log.Printf("Surveillance de %s impossible, vérification toutes les %s : %v", dir, pollInterval, err)
+			}
+		}
+	}
+	go s.watch(w, stop)
+}
+
+// Close arrête la surveillance des fichiers.
+func (s *Store) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
+
+func (s *Store) watch(w *fsnotify.Watcher, stop chan struct{}) {
+	var events chan fsnotify.Event
+	var errs chan error
+	if w != nil {
+		defer w.Close()
+		events, errs = w.Events, w.Errors
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			pending = time.After(reloadDelay)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			log.Printf("Erreur fsnotify certificats : %v", err)
+		case <-pending:
+			pending = nil
+			s.reloadChanged()
+		case <-ticker.C:
+			s.reloadChanged()
+		}
+	}
+}
+
+// reloadChanged recharge les couples dont un fichier a changé. Un nouveau
+// couple invalide est refusé et l'ancien certificat reste servi.
+func (s *Store) reloadChanged() {
+	s.mu.RLock()
+	list := make([]*fileCert, 0, len(s.files))
+	for _, fc := range s.files {
+		list = append(list, fc)
+	}
+	s.mu.RUnlock()
+
+	for _, fc := range list {
+		st := stampOf(fc.certFile, fc.keyFile)
+		if st == fc.stamp {
+			continue
+		}
+		fc.stamp = st
+
+		cert, err := loadKeyPair(fc.certFile, fc.keyFile)
+		if err == nil && time.Now().After(cert.Leaf.NotAfter) {
+			err = fmt.Errorf("certificat expiré depuis le %s", cert.Leaf.NotAfter.Format("2006-01-02"))
+		}
+		if err != nil {
+			log.Printf("Nouveau certificat %s refusé, l'ancien reste en service : %v", fc.certFile, err)
+			continue
+		}
+		fc.cert.Store(cert)
+		log.Printf("Certificat %s rechargé (%s, expire le %s)", fc.certFile, cert.Leaf.Subject.CommonName, cert.Leaf.NotAfter.Format("2006-01-02"))
+	}
+}
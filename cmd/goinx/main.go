@@ -11,6 +11,19 @@ func main() {
 	flag.BoolVar(&cliMode, "cli", false, "Mode console interactif")
 	flag.Parse()
 
+	switch flag.Arg(0) {
+	case "certs":
+		if err := config.RunCertsCommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "ca":
+		if err := config.RunCACommand(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	log.Println("Initialisation de Goinx...")
 
 	err := config.SetupGoinx()
@@ -50,6 +63,8 @@ func main() {
 
 	go config.StartMainListener()
 	go config.LaunchHttpsServers()
+	config.StartMetricsListener()
+	config.StartAdminListener()
 
 	log.Printf("Tous les serveurs démarrés. Ctrl+C pour quitter.")
 	select {}
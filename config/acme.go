@@ -0,0 +1,330 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/OxiWanV2/Goinx/certstore"
+)
+
+const acmeStagingDirectory = "https://acme-staging-v02.api.letsencrypt.org/directory"
+
+// ACMEConfig paramètre l'autorité ACME. Dans un site, les champs vides
+// reprennent ceux de goinx.conf.
+type ACMEConfig struct {
+	Directory string // acme_directory, défaut Let's Encrypt production
+	CARoot    string // acme_ca_root : CA de confiance pour joindre l'annuaire (Pebble, step-ca)
+	Email     string // acme_email
+	EABKeyID  string // acme_eab <kid> <clé HMAC base64url>
+	EABKey    string
+	Staging   *bool // acme_staging on|off, ignoré si acme_directory est fixé
+
+	Preflight         *bool  // acme_preflight on|off, défaut on
+	PreflightResolver string // acme_preflight_resolver <ip[:port]>, vide = résolveur système
+}
+
+// acmeAccount est la configuration ACME effective d'un site ; un
+// gestionnaire autocert est partagé par compte.
+type acmeAccount struct {
+	Directory string
+	CARoot    string
+	Email     string
+	EABKeyID  string
+	EABKey    string
+}
+
+var (
+	acmeManagersMu sync.Mutex
+	acmeManagers   = make(map[acmeAccount]*autocert.Manager)
+)
+
+// parseACME lit les directives acme_*, communes à goinx.conf et aux sites.
+func parseACME(conf *ACMEConfig, parts []string) error {
+	switch parts[0] {
+	case "acme_directory":
+		if len(parts) != 2 {
+			return fmt.Errorf("syntaxe attendue : acme_directory <url>")
+		}
+		u, err := url.Parse(parts[1])
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("acme_directory invalide : %s", parts[1])
+		}
+		conf.Directory = parts[1]
+	case "acme_ca_root":
+		if len(parts) != 2 {
+			return fmt.Errorf("syntaxe attendue : acme_ca_root <fichier.pem>")
+		}
+		conf.CARoot = parts[1]
+	case "acme_email":
+		if len(parts) != 2 || !strings.Contains(parts[1], "@") {
+			return fmt.Errorf("syntaxe attendue : acme_email <adresse>")
+		}
+		conf.Email = parts[1]
+	case "acme_eab":
+		if len(parts) != 3 {
+			return fmt.Errorf("syntaxe attendue : acme_eab <kid> <clé HMAC base64url>")
+		}
+		if _, err := decodeEABKey(parts[2]); err != nil {
+			return fmt.Errorf("clé acme_eab invalide : %v", err)
+		}
+		conf.EABKeyID, conf.EABKey = parts[1], parts[2]
+	case "acme_staging":
+		if len(parts) != 2 {
+			return fmt.Errorf("syntaxe attendue : acme_staging on|off")
+		}
+		staging := parseSwitch(parts[1])
+		conf.Staging = &staging
+	case "acme_preflight":
+		if len(parts) != 2 {
+			return fmt.Errorf("syntaxe attendue : acme_preflight on|off")
+		}
+		preflight := parseSwitch(parts[1])
+		conf.Preflight = &preflight
+	case "acme_preflight_resolver":
+		if len(parts) != 2 {
+			return fmt.Errorf("syntaxe attendue : acme_preflight_resolver <ip[:port]>")
+		}
+		addr := parts[1]
+		if net.ParseIP(addr) != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		if host, _, err := net.SplitHostPort(addr); err != nil || net.ParseIP(host) == nil {
+			return fmt.Errorf("acme_preflight_resolver invalide : %s", parts[1])
+		}
+		conf.PreflightResolver = addr
+	}
+	return nil
+}
+
+// decodeEABKey accepte la clé HMAC en base64url, avec ou sans padding.
+func decodeEABKey(key string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+}
+
+// acmeAccountFor fusionne la config ACME du site avec celle de goinx.conf.
+func acmeAccountFor(cfg SiteConfig) acmeAccount {
+	global := currentGlobalConfig().ACME
+	site := cfg.ACME
+	pick := func(siteValue, globalValue string) string {
+		if siteValue != "" {
+			return siteValue
+		}
+		return globalValue
+	}
+
+	account := acmeAccount{
+		Directory: pick(site.Directory, global.Directory),
+		CARoot:    pick(site.CARoot, global.CARoot),
+		Email:     pick(site.Email, global.Email),
+		EABKeyID:  global.EABKeyID,
+		EABKey:    global.EABKey,
+	}
+	if site.EABKeyID != "" {
+		account.EABKeyID, account.EABKey = site.EABKeyID, site.EABKey
+	}
+	if account.Directory == "" {
+		staging := global.Staging
+		if site.Staging != nil {
+			staging = site.Staging
+		}
+		account.Directory = autocert.DefaultACMEDirectory
+		if staging != nil && *staging {
+			account.Directory = acmeStagingDirectory
+		}
+	}
+	return account
+}
+
+func acmePreflightEnabled(cfg SiteConfig) bool {
+	preflight := currentGlobalConfig().ACME.Preflight
+	if cfg.ACME.Preflight != nil {
+		preflight = cfg.ACME.Preflight
+	}
+	return preflight == nil || *preflight
+}
+
+func acmePreflightResolver(cfg SiteConfig) string {
+	if cfg.ACME.PreflightResolver != "" {
+		return cfg.ACME.PreflightResolver
+	}
+	return currentGlobalConfig().ACME.PreflightResolver
+}
+
+// cacheDir garde les certificats Let's Encrypt production à l'emplacement
+// historique ; chaque autre annuaire a son sous-dossier, avec son compte.
+func (a acmeAccount) cacheDir() string {
+	if a.Directory == autocert.DefaultACMEDirectory {
+		return certCacheDir
+	}
+	u, _ := url.Parse(a.Directory)
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, strings.Trim(u.Host+u.Path, "/"))
+	if a.EABKeyID != "" {
+		// Une clé de compte ne peut être liée qu'à un seul compte externe.
+		name += "_" + a.EABKeyID
+	}
+	return filepath.Join(certCacheDir, "acme", name)
+}
+
+// acmeCertFile renvoie le fichier du cache autocert contenant le certificat
+// du site.
+func acmeCertFile(cfg SiteConfig) string {
+	return filepath.Join(acmeAccountFor(cfg).cacheDir(), cfg.ServerName)
+}
+
+// checkACME vérifie que le compte ACME du site est utilisable.
+func checkACME(cfg SiteConfig) error {
+	if !cfg.UseLetsEncrypt {
+		return nil
+	}
+	account := acmeAccountFor(cfg)
+	if account.CARoot != "" {
+		if _, err := loadCARoot(account.CARoot); err != nil {
+			return fmt.Errorf("acme_ca_root : %v", err)
+		}
+	}
+	return nil
+}
+
+func loadCARoot(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("aucun certificat dans %s", path)
+	}
+	return pool, nil
+}
+
+// acmeManager renvoie le gestionnaire autocert du compte ACME du site et y
+// inscrit son domaine.
+func acmeManager(cfg SiteConfig) (*autocert.Manager, error) {
+	account := acmeAccountFor(cfg)
+
+	acmeManagersMu.Lock()
+	m, ok := acmeManagers[account]
+	if !ok {
+		var err error
+		m, err = newACMEManager(account)
+		if err != nil {
+			acmeManagersMu.Unlock()
+			return nil, err
+		}
+		acmeManagers[account] = m
+	}
+	acmeManagersMu.Unlock()
+
+	autocertMgrsMu.Lock()
+	autocertMgrs[cfg.ServerName] = m
+	autocertMgrsMu.Unlock()
+	return m, nil
+}
+
+// resetACMEManager remplace le gestionnaire du compte ACME du site : le
+// suivant relit le cache, sans les certificats gardés en mémoire.
+func resetACMEManager(cfg SiteConfig) error {
+	account := acmeAccountFor(cfg)
+	m, err := newACMEManager(account)
+	if err != nil {
+		return err
+	}
+
+	acmeManagersMu.Lock()
+	old := acmeManagers[account]
+	acmeManagers[account] = m
+	acmeManagersMu.Unlock()
+
+	autocertMgrsMu.Lock()
+	for host, current := range autocertMgrs {
+		if current == old {
+			autocertMgrs[host] = m
+		}
+	}
+	autocertMgrsMu.Unlock()
+	return nil
+}
+
+// acmeGetCertificate sert host par le gestionnaire qui lui est inscrit au
+// moment de la poignée de main.
+func acmeGetCertificate(host string) certstore.GetCertificateFunc {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		autocertMgrsMu.Lock()
+		m, ok := autocertMgrs[host]
+		autocertMgrsMu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("ACME inactif pour %s", host)
+		}
+		return m.GetCertificate(hello)
+	}
+}
+
+// acmeActive indique si le domaine est confié à un gestionnaire ACME.
+func acmeActive(host string) bool {
+	autocertMgrsMu.Lock()
+	defer autocertMgrsMu.Unlock()
+	_, ok := autocertMgrs[host]
+	return ok
+}
+
+func newACMEManager(account acmeAccount) (*autocert.Manager, error) {
+	client := &acme.Client{DirectoryURL: account.Directory}
+	if account.CARoot != "" {
+		pool, err := loadCARoot(account.CARoot)
+		if err != nil {
+			return nil, fmt.Errorf("acme_ca_root : %v", err)
+		}
+		client.HTTPClient = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}}
+	}
+
+	m := &autocert.Manager{
+		Cache:  autocert.DirCache(account.cacheDir()),
+		Client: client,
+		Email:  account.Email,
+		Prompt: func(tosURL string) bool {
+			log.Printf("Conditions d'utilisation ACME acceptées pour %s : %s", account.Directory, tosURL)
+			return true
+		},
+	}
+	// Les domaines sont ceux inscrits par acmeManager, y compris après reload.
+	m.HostPolicy = func(_ context.Context, host string) error {
+		autocertMgrsMu.Lock()
+		defer autocertMgrsMu.Unlock()
+		if autocertMgrs[host] != m {
+			return fmt.Errorf("domaine %s non géré par %s", host, account.Directory)
+		}
+		return nil
+	}
+	if account.EABKeyID != "" {
+		key, _ := decodeEABKey(account.EABKey)
+		m.ExternalAccountBinding = &acme.ExternalAccountBinding{KID: account.EABKeyID, Key: key}
+	}
+
+	if account.Email == "" {
+		log.Printf("Compte ACME %s sans acme_email : aucun avis d'expiration ne sera reçu", account.Directory)
+	}
+	return m, nil
+}
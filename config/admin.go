@@ -0,0 +1,333 @@
+package config
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OxiWanV2/Goinx/metrics"
+)
+
+const (
+	defaultAdminListen = "127.0.0.1:9180"
+	minAdminTokenLen   = 16
+	sseKeepAlive       = 30 * time.Second
+	maxConfSize        = 1 << 20
+)
+
+var (
+	adminServerMu sync.Mutex
+	adminServer   *http.Server
+)
+
+// StartAdminListener lance, déplace ou arrête l'API d'admin selon
+// goinx.conf. Sans admin_token, l'API reste fermée.
+func StartAdminListener() {
+	global := currentGlobalConfig()
+	addr := global.AdminListen
+	if addr == "" {
+		addr = defaultAdminListen
+	}
+	if global.AdminToken == "" {
+		addr = ""
+	} else if len(global.AdminToken) < minAdminTokenLen {
+		log.Printf("API d'admin désactivée : admin_token doit faire au moins %d caractères", minAdminTokenLen)
+		addr = ""
+	}
+
+	adminServerMu.Lock()
+	defer adminServerMu.Unlock()
+	if adminServer != nil {
+		if adminServer.Addr == addr {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		adminServer.Shutdown(ctx)
+		cancel()
+		adminServer = nil
+		log.Println("API d'admin arrêtée")
+	}
+	if addr == "" {
+		return
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           adminHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	adminServer = srv
+	go func() {
+		log.Printf("API d'admin lancée sur %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Erreur API d'admin : %v", err)
+		}
+	}()
+}
+
+// adminHandler sert l'API sous /api/ et le tableau de bord, dont les
+// fichiers ne contiennent rien de sensible : le jeton est demandé par la page.
+func adminHandler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("GET /api/sites", apiListSites)
+	api.HandleFunc("GET /api/sites/{name}", apiSiteConfig)
+	api.HandleFunc("GET /api/sites/{name}/testconf", apiTestConf)
+	api.HandleFunc("GET /api/sites/{name}/conf", apiGetConf)
+	api.HandleFunc("PUT /api/sites/{name}/conf", apiSaveConf)
+	api.HandleFunc("POST /api/sites/{name}/enable", apiEnableSite)
+	api.HandleFunc("POST /api/sites/{name}/disable", apiDisableSite)
+	api.HandleFunc("POST /api/sites/{name}/redeploy", apiRedeploySite)
+	api.HandleFunc("POST /api/sites/{name}/backend/restart", apiRestartBackend)
+	api.HandleFunc("GET /api/sites/{name}/logs", apiSiteLogs)
+	api.HandleFunc("POST /api/reload", apiReload)
+	api.HandleFunc("GET /api/certificates", apiCertificates)
+	api.HandleFunc("GET /api/certificates/inventory", apiCertInventory)
+	api.HandleFunc("POST /api/certificates/{host}/renew", apiRenewCertificate)
+	api.HandleFunc("GET /api/stats", apiStats)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", adminAuth(api))
+	dashboard := dashboardHandler()
+	mux.Handle("GET /{$}", dashboard)
+	mux.Handle("GET /assets/", dashboard)
+	return mux
+}
+
+// adminAuth exige "Authorization: Bearer <admin_token>".
+func adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := currentGlobalConfig().AdminToken
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goinx"`)
+			writeJSON(w, http.StatusUnauthorized, apiErrorBody{"jeton d'admin manquant ou invalide"})
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method != http.MethodGet {
+			log.Printf("API d'admin : %s %s depuis %s", r.Method, r.URL.Path, r.RemoteAddr)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type apiErrorBody struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeAPIError répond 404 pour un site inconnu, status sinon.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	var unknown ErrUnknownSite
+	if errors.As(err, &unknown) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, apiErrorBody{err.Error()})
+}
+
+func apiListSites(w http.ResponseWriter, r *http.Request) {
+	states, err := ListSites()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+func apiSiteConfig(w http.ResponseWriter, r *http.Request) {
+	conf, err := readSiteConf(r.PathValue("name"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, conf)
+}
+
+// apiTestConf teste la config et, pour un site Let's Encrypt, relance le
+// contrôle ACME ; un échec de ce contrôle n'invalide pas la config.
+func apiTestConf(w http.ResponseWriter, r *http.Request) {
+	if _, err := TestSiteConf(r.PathValue("name")); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	preflight, err := CheckACMEPreflight(r.PathValue("name"))
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		OK            bool             `json:"ok"`
+		ACMEPreflight *PreflightResult `json:"acme_preflight,omitempty"`
+	}{true, preflight})
+}
+
+func apiGetConf(w http.ResponseWriter, r *http.Request) {
+	content, err := SiteConfText(r.PathValue("name"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(content)
+}
+
+// apiSaveConf enregistre la config reçue si elle passe testconf (422 sinon).
+func apiSaveConf(w http.ResponseWriter, r *http.Request) {
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfSize))
+	if err != nil {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if err := SaveSiteConf(r.PathValue("name"), content); err != nil {
+		status := http.StatusInternalServerError
+		var invalid ErrInvalidConf
+		if errors.As(err, &invalid) {
+			status = http.StatusUnprocessableEntity
+		}
+		writeAPIError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func apiEnableSite(w http.ResponseWriter, r *http.Request) {
+	if err := ActivateSite(r.PathValue("name")); err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func apiDisableSite(w http.ResponseWriter, r *http.Request) {
+	if err := DeactivateSite(r.PathValue("name")); err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func apiRedeploySite(w http.ResponseWriter, r *http.Request) {
+	if err := RedeploySite(r.PathValue("name")); err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func apiRestartBackend(w http.ResponseWriter, r *http.Request) {
+	if err := RestartBackend(r.PathValue("name")); err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func apiReload(w http.ResponseWriter, r *http.Request) {
+	if err := ReloadServers(); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func apiCertificates(w http.ResponseWriter, r *http.Request) {
+	certs := Certificates()
+	if certs == nil {
+		certs = []CertificateInfo{}
+	}
+	writeJSON(w, http.StatusOK, certs)
+}
+
+func apiCertInventory(w http.ResponseWriter, r *http.Request) {
+	certs := CertInventory(loadedConfigs())
+	if certs == nil {
+		certs = []CertificateFile{}
+	}
+	writeJSON(w, http.StatusOK, certs)
+}
+
+// apiRenewCertificate attend la fin du renouvellement (409 en cas d'échec).
+func apiRenewCertificate(w http.ResponseWriter, r *http.Request) {
+	if err := RenewCertificate(r.PathValue("host")); err != nil {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// apiStats donne l'activité par server_name et les dernières erreurs 5xx ;
+// le tableau de bord en déduit le débit de requêtes.
+func apiStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Time   time.Time                       `json:"time"`
+		Sites  map[string]metrics.SiteSnapshot `json:"sites"`
+		Errors []metrics.ErrorEntry            `json:"errors"`
+	}{time.Now(), metrics.Snapshot(), metrics.RecentErrors()})
+}
+
+// apiSiteLogs diffuse les logs du backend en Server-Sent Events : les
+// dernières lignes, puis le direct jusqu'à l'arrêt du backend.
+func apiSiteLogs(w http.ResponseWriter, r *http.Request) {
+	recent, lines, cancel, err := SiteLogs(r.PathValue("name"))
+	if err != nil && recent == nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, line := range recent {
+		writeEvent(w, "", line)
+	}
+	if err != nil {
+		writeEvent(w, "end", err.Error())
+		rc.Flush()
+		return
+	}
+	defer cancel()
+	rc.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				writeEvent(w, "end", "backend arrêté")
+				rc.Flush()
+				return
+			}
+			writeEvent(w, "", line)
+		case <-keepAlive.C:
+			w.Write([]byte(": keepalive\n\n"))
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event, data string) {
+	if event != "" {
+		w.Write([]byte("event: " + event + "\n"))
+	}
+	w.Write([]byte("data: " + strings.ReplaceAll(data, "\n", "\ndata: ") + "\n\n"))
+}
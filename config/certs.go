@@ -0,0 +1,139 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const certCacheDir = "/etc/goinx/certs-cache"
+
+// CertificateInfo décrit le certificat servi pour un site.
+type CertificateInfo struct {
+	Site      string    `json:"site"`
+	Source    string    `json:"source"` // "acme" ou "file"
+	File      string    `json:"file"`
+	Subject   string    `json:"subject,omitempty"`
+	DNSNames  []string  `json:"dns_names,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	NotBefore time.Time `json:"not_before,omitzero"`
+	NotAfter  time.Time `json:"not_after,omitzero"`
+	KeyType   string    `json:"key_type,omitempty"`
+	Level     string    `json:"level,omitempty"` // "warn", "critical" ou "expired" selon cert_expiry_warn
+	Error     string    `json:"error,omitempty"` // Fichier absent ou illisible
+}
+
+// Certificates inspecte les certificats des sites chargés en HTTPS.
+func Certificates() []CertificateInfo {
+	var out []CertificateInfo
+	for _, site := range sslSites() {
+		info := CertificateInfo{Site: site.name, Source: site.source, File: site.file}
+		cert, err := readCertificate(site.file)
+		if err != nil {
+			info.Error = err.Error()
+			out = append(out, info)
+			continue
+		}
+		info.Subject = cert.Subject.String()
+		info.DNSNames = cert.DNSNames
+		info.Issuer = cert.Issuer.String()
+		info.NotBefore = cert.NotBefore
+		info.NotAfter = cert.NotAfter
+		info.KeyType = keyType(cert)
+		info.Level = expiryLevel(cert.NotAfter)
+		out = append(out, info)
+	}
+	return out
+}
+
+func keyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + strings.ReplaceAll(key.Curve.Params().Name, "-", "")
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+type sslSite struct {
+	name   string
+	file   string
+	source string // "acme" ou "file"
+}
+
+// sslSites liste les sites chargés servis en HTTPS et le fichier de leur
+// certificat.
+func sslSites() []sslSite {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	var out []sslSite
+	for name, site := range sites {
+		switch {
+		case site.Config.UseLetsEncrypt:
+			out = append(out, sslSite{name, acmeCertFile(site.Config), "acme"})
+		case site.Config.SSLEnabled:
+			out = append(out, sslSite{name, site.Config.SSLCertFile, "file"})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+type parsedCert struct {
+	modTime time.Time
+	cert    *x509.Certificate
+}
+
+var (
+	parsedCertsMu sync.Mutex
+	parsedCerts   = make(map[string]parsedCert)
+)
+
+// readCertificate renvoie le premier certificat PEM du fichier (le cache
+// autocert y place aussi la clé), relu seulement s'il a changé.
+func readCertificate(path string) (*x509.Certificate, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	parsedCertsMu.Lock()
+	cached, ok := parsedCerts[path]
+	parsedCertsMu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.cert, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("aucun certificat dans %s", path)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		parsedCertsMu.Lock()
+		parsedCerts[path] = parsedCert{modTime: info.ModTime(), cert: cert}
+		parsedCertsMu.Unlock()
+		return cert, nil
+	}
+}
@@ -7,12 +7,12 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 	"github.com/OxiWanV2/Goinx/backend"
-	"github.com/OxiWanV2/Goinx/utils"
+	"github.com/OxiWanV2/Goinx/proxy"
 )
 
 func stopAllServers() {
@@ -53,8 +53,10 @@ func StartCLI() {
 
 	go StartMainListener()
 	go LaunchHttpsServers()
+	StartMetricsListener()
+	StartAdminListener()
 
-	fmt.Println("Goinx CLI - Commandes: list, enable <site>, disable <site>, testconf <site>, reload, log <site>, help, exit")
+	fmt.Println("Goinx CLI - Commandes: list, status, enable <site>, disable <site>, testconf <site>, restart <site>, reload, log <site>, certs [renew <domaine>], cache purge <site> <motif>, help, exit")
 
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
@@ -73,43 +75,34 @@ func StartCLI() {
 		case "help":
 			fmt.Println("Commandes disponibles :")
 			fmt.Println("  list                   - liste les sites disponibles et leur état")
+			fmt.Println("  status                 - affiche les connexions longues par site, les contrôles ACME et l’état des circuits backend")
 			fmt.Println("  enable <site>          - active un site (crée lien et initialise frontend+backend)")
 			fmt.Println("  disable <site>         - désactive un site (arrête serveur + backend, supprime lien)")
-			fmt.Println("  testconf <site>        - teste la config d’un site")
+			fmt.Println("  testconf <site>        - teste la config d’un site (et le contrôle ACME)")
+			fmt.Println("  restart <site>         - relance le backend du site")
 			fmt.Println("  reload                 - recharge la configuration des sites et relance tous serveurs")
 			fmt.Println("  log <site>             - affiche les logs en temps réel du backend du site")
+			fmt.Println("  certs                  - liste les certificats (cache ACME et fichiers) et les sites qui les servent")
+			fmt.Println("  certs renew <domaine>  - force le renouvellement ACME du certificat du domaine")
+			fmt.Println("  ca export [fichier]    - exporte le certificat racine de la CA locale (ssl_mode local)")
+			fmt.Println("  cache purge <site> <motif> - vide le cache proxy du site pour les chemins correspondants (ex: /api/*)")
 			fmt.Println("  exit                   - quitte le CLI")
 
 		case "list":
 			handleList()
 
+		case "status":
+			handleStatus()
+
 		case "enable":
 			if len(args) < 2 {
 				fmt.Println("Usage : enable <nom_site>")
 				continue
 			}
-			siteName := args[1]
-			if err := EnableSite(siteName); err != nil {
+			if err := ActivateSite(args[1]); err != nil {
 				fmt.Println("Erreur activer site :", err)
-				continue
-			}
-
-			confPath := filepath.Join("/etc/goinx/sites-available", siteName, siteName+".conf")
-			conf, err := ParseConf(confPath)
-			if err != nil {
-				fmt.Println("Erreur lecture config :", err)
-				continue
-			}
-
-			if err := ValidateConfigs([]SiteConfig{conf}); err != nil {
-				fmt.Println("Config invalide :", err)
-				continue
-			}
-
-			if err := InitSite(conf); err != nil {
-				fmt.Println("Erreur initialisation site :", err)
 			} else {
-				fmt.Println("Site activé et initialisé :", siteName)
+				fmt.Println("Site activé et initialisé :", args[1])
 			}
 
 		case "disable":
@@ -117,19 +110,10 @@ func StartCLI() {
 				fmt.Println("Usage : disable <nom_site>")
 				continue
 			}
-			siteName := args[1]
-			if err := StopServer(siteName); err != nil {
-				fmt.Println("Erreur arrêt serveur :", err)
-			}
-
-			if err := backend.StopBackend(siteName); err != nil {
-				fmt.Println("Erreur arrêt backend :", err)
-			}
-
-			if err := DisableSite(siteName); err != nil {
+			if err := DeactivateSite(args[1]); err != nil {
 				fmt.Println("Erreur désactivation site :", err)
 			} else {
-				fmt.Println("Site désactivé et serveur arrêté :", siteName)
+				fmt.Println("Site désactivé et serveur arrêté :", args[1])
 			}
 
 		case "testconf":
@@ -137,14 +121,28 @@ func StartCLI() {
 				fmt.Println("Usage : testconf <nom_site>")
 				continue
 			}
-			siteName := args[1]
-			confPath := filepath.Join("/etc/goinx/sites-available", siteName, siteName+".conf")
-			conf, err := ParseConf(confPath)
+			conf, err := TestSiteConf(args[1])
 			if err != nil {
-				fmt.Printf("Erreur lecture config : %v\n", err)
+				fmt.Printf("Config %s invalide : %v\n", args[1], err)
 				continue
 			}
-			fmt.Printf("Config %s testée : %+v\n", siteName, conf)
+			fmt.Printf("Config %s testée : %+v\n", args[1], conf)
+			if preflight, err := CheckACMEPreflight(args[1]); err != nil {
+				fmt.Println("Contrôle ACME impossible :", err)
+			} else if preflight != nil {
+				fmt.Printf("Contrôle ACME %s : %s\n", preflight.Host, preflightVerdict(*preflight))
+			}
+
+		case "restart":
+			if len(args) < 2 {
+				fmt.Println("Usage : restart <nom_site>")
+				continue
+			}
+			if err := RestartBackend(args[1]); err != nil {
+				fmt.Println("Erreur relance backend :", err)
+			} else {
+				fmt.Println("Backend relancé :", args[1])
+			}
 
 		case "reload":
 			err := ReloadServers()
@@ -161,15 +159,12 @@ func StartCLI() {
 			}
 			siteName := args[1]
 
-			enabledPath := filepath.Join("/etc/goinx/sites-enabled", siteName)
-			if !util.LinkExists(enabledPath) {
-				fmt.Printf("Site \"%s\" non trouvé ou non activé.\n", siteName)
-				continue
+			recent, logChan, cancel, err := SiteLogs(siteName)
+			for _, line := range recent {
+				fmt.Println(line)
 			}
-
-			logChan, exists := backend.GetBackendLogChannel(siteName)
-			if !exists {
-				fmt.Printf("Aucun backend en cours ou pas de logs disponibles pour le site \"%s\".\n", siteName)
+			if err != nil {
+				fmt.Printf("%v.\n", err)
 
 				activeBackends := backend.GetActiveBackends()
 				if len(activeBackends) == 0 {
@@ -202,6 +197,45 @@ func StartCLI() {
 					break loop
 				}
 			}
+			signal.Stop(done)
+			cancel()
+
+		case "certs":
+			if len(args) == 1 {
+				printCertInventory(os.Stdout, CertInventory(loadedConfigs()))
+				continue
+			}
+			if len(args) != 3 || args[1] != "renew" {
+				fmt.Println("Usage : certs [renew <domaine>]")
+				continue
+			}
+			fmt.Printf("Renouvellement du certificat de %s...\n", args[2])
+			if err := RenewCertificate(args[2]); err != nil {
+				fmt.Println("Erreur :", err)
+			} else {
+				fmt.Println("Certificat renouvelé :", args[2])
+			}
+
+		case "ca":
+			if err := RunCACommand(args[1:]); err != nil {
+				fmt.Println("Erreur :", err)
+			}
+
+		case "cache":
+			if len(args) < 4 || args[1] != "purge" {
+				fmt.Println("Usage : cache purge <nom_site> <motif>")
+				continue
+			}
+			site, err := loadedSite(args[2])
+			if err != nil {
+				fmt.Println("Erreur :", err)
+				continue
+			}
+			if site.Proxy == nil || !site.Proxy.CacheEnabled() {
+				fmt.Printf("Pas de proxy_cache configuré pour le site %s\n", args[2])
+				continue
+			}
+			fmt.Printf("%d entrées supprimées du cache pour %s\n", site.Proxy.Purge(args[3]), args[3])
 
 		case "exit":
 			fmt.Println("Sortie.")
@@ -215,30 +249,101 @@ func StartCLI() {
 }
 
 func handleList() {
-	availableDir := "/etc/goinx/sites-available"
-	enabledDir := "/etc/goinx/sites-enabled"
-
-	sitesAvailable, err := os.ReadDir(availableDir)
+	states, err := ListSites()
 	if err != nil {
-		fmt.Printf("Erreur lecture %s : %v\n", availableDir, err)
+		fmt.Printf("Erreur : %v\n", err)
 		return
 	}
 
 	fmt.Println("Liste des sites disponibles :")
-	for _, site := range sitesAvailable {
-		siteName := site.Name()
-		if !site.IsDir() {
-			continue
-		}
-		enabledPath := filepath.Join(enabledDir, siteName)
+	for _, site := range states {
 		state := "Désactivé"
-		if util.LinkExists(enabledPath) {
-			if IsServerRunning(siteName) {
+		if site.Enabled {
+			if site.Loaded {
 				state = "Activé (serveur en cours)"
 			} else {
 				state = "Activé (serveur arrêté)"
 			}
 		}
-		fmt.Printf("  - %s : %s\n", siteName, state)
+		if site.Error != "" {
+			state += " - config illisible : " + site.Error
+		}
+		fmt.Printf("  - %s : %s\n", site.Name, state)
+	}
+}
+
+func handleStatus() {
+	sitesMu.Lock()
+	names := make([]string, 0, len(sites))
+	for name := range sites {
+		names = append(names, name)
+	}
+	sitesMu.Unlock()
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		fmt.Println("Aucun site chargé.")
+		return
 	}
-}
\ No newline at end of file
+
+	stats := proxy.Stats()
+	fmt.Println("État des sites chargés :")
+	for _, name := range names {
+		st := stats[name]
+		fmt.Printf("  - %s : %d WebSocket, %d flux SSE (%d upgrades depuis le démarrage)\n", name, st.WebSockets, st.SSE, st.Upgrades)
+	}
+
+	for _, z := range proxy.CacheZones() {
+		ratio := 0.0
+		if total := z.Hits + z.Misses + z.Stale; total > 0 {
+			ratio = float64(z.Hits+z.Stale) / float64(total) * 100
+		}
+		fmt.Printf("  Cache %s : %d hits, %d miss, %d périmés servis (%.1f%% de hits), %d Ko en mémoire\n", z.Zone, z.Hits, z.Misses, z.Stale, ratio, z.Memory/1024)
+	}
+
+	if results := PreflightResults(); len(results) > 0 {
+		fmt.Println("Contrôles ACME :")
+		for _, result := range results {
+			fmt.Printf("  - %s : %s (%s)\n", result.Host, preflightVerdict(result), result.Time.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	breakers := proxy.Breakers()
+	if len(breakers) == 0 {
+		return
+	}
+	fmt.Println("Circuits des backends :")
+	for _, b := range breakers {
+		line := fmt.Sprintf("  - %s → %s : %s (%d échecs consécutifs)", b.Site, b.Upstream, b.State, b.Failures)
+		if !b.OpenedAt.IsZero() {
+			line += fmt.Sprintf(", dernière ouverture %s", b.OpenedAt.Format("2006-01-02 15:04:05"))
+		}
+		fmt.Println(line)
+	}
+}
+
+func preflightVerdict(result PreflightResult) string {
+	switch {
+	case result.Forced:
+		return "forcé, " + result.Reason
+	case result.OK:
+		return "OK, " + result.Reason
+	}
+	return "échec, " + result.Reason
+}
+
+// loadedSite retrouve le site chargé correspondant à un dossier de
+// sites-available.
+func loadedSite(siteName string) (*Site, error) {
+	conf, err := readSiteConf(siteName)
+	if err != nil {
+		return nil, err
+	}
+	sitesMu.Lock()
+	site, ok := sites[conf.ServerName]
+	sitesMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("site %s non chargé", siteName)
+	}
+	return site, nil
+}
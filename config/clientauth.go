@@ -0,0 +1,64 @@
+package config
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/OxiWanV2/Goinx/server"
+)
+
+// loadClientCAs lit les CA de ssl_client_certificate (PEM, plusieurs
+// certificats possibles).
+func loadClientCAs(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cas []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("lecture %s : %v", path, err)
+		}
+		cas = append(cas, cert)
+	}
+	if len(cas) == 0 {
+		return nil, fmt.Errorf("aucun certificat dans %s", path)
+	}
+	return cas, nil
+}
+
+// clientAuthOptions prépare la vérification des certificats clients du
+// site ; Mode vide si ssl_verify_client n'est pas actif.
+func clientAuthOptions(cfg SiteConfig, locations []server.Location) (server.ClientAuthOptions, error) {
+	opts := server.ClientAuthOptions{Mode: cfg.SSLVerifyClient, Locations: locations}
+	if opts.Mode == "" {
+		return opts, nil
+	}
+	cas, err := loadClientCAs(cfg.SSLClientCertificate)
+	if err != nil {
+		return opts, fmt.Errorf("ssl_client_certificate : %v", err)
+	}
+	opts.CAs = cas
+	if cfg.SSLCRL != "" {
+		if _, err := server.LoadCRL(cfg.SSLCRL, cas); err != nil {
+			return opts, fmt.Errorf("ssl_crl : %v", err)
+		}
+		opts.CRLFile = cfg.SSLCRL
+	}
+	opts.ErrorHandler = func(w http.ResponseWriter, r *http.Request, status int) {
+		WriteErrorPage(w, status, cfg)
+	}
+	return opts, nil
+}
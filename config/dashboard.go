@@ -0,0 +1,24 @@
+package config
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// Tableau de bord d'admin, embarqué dans le binaire.
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+func dashboardHandler() http.Handler {
+	root, _ := fs.Sub(dashboardFiles, "dashboard")
+	files := http.FileServerFS(root)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "no-referrer")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,366 @@
+// Tableau de bord Goinx : consomme l'API d'admin avec le jeton gardé pour
+// la session de l'onglet.
+'use strict';
+
+const $ = (id) => document.getElementById(id);
+const STATS_INTERVAL = 2000;
+const SITES_INTERVAL = 10000;
+
+let token = sessionStorage.getItem('goinx-token') || '';
+let sites = [];
+let certs = [];
+let lastStats = null;
+let rates = {};
+let timers = [];
+let logsAbort = null;
+let editorSite = '';
+
+class Unauthorized extends Error {}
+
+async function api(method, path, body, raw) {
+  const opts = { method, headers: { Authorization: 'Bearer ' + token } };
+  if (body !== undefined) {
+    opts.body = body;
+    opts.headers['Content-Type'] = 'text/plain; charset=utf-8';
+  }
+  const resp = await fetch(path, opts);
+  if (resp.status === 401) throw new Unauthorized();
+  if (raw) {
+    if (!resp.ok) throw new Error(await errorText(resp));
+    return resp;
+  }
+  const type = resp.headers.get('Content-Type') || '';
+  const data = type.startsWith('application/json') ? await resp.json() : await resp.text();
+  if (!resp.ok) throw new Error(data.error || data || resp.statusText);
+  return data;
+}
+
+async function errorText(resp) {
+  try {
+    return (await resp.json()).error;
+  } catch {
+    return resp.statusText;
+  }
+}
+
+// el crée un élément ; les textes passent par textContent, jamais par innerHTML.
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs || {})) {
+    if (key.startsWith('on')) node.addEventListener(key.slice(2), value);
+    else if (key === 'class') node.className = value;
+    else node.setAttribute(key, value);
+  }
+  for (const child of children) {
+    if (child === null || child === undefined) continue;
+    node.append(child instanceof Node ? child : String(child));
+  }
+  return node;
+}
+
+function badge(text, kind) {
+  return el('span', { class: 'badge ' + (kind || '') }, text);
+}
+
+function setStatus(text, isError) {
+  const node = $('status');
+  node.textContent = text;
+  node.className = isError ? 'bad-text' : 'muted';
+}
+
+function handleError(err) {
+  if (err instanceof Unauthorized) {
+    logout('Jeton refusé.');
+    return;
+  }
+  setStatus(err.message, true);
+}
+
+// --- Connexion ---
+
+function showLogin(message) {
+  $('login').hidden = false;
+  $('app').hidden = true;
+  $('reload').hidden = true;
+  $('logout').hidden = true;
+  $('login-error').textContent = message || '';
+  $('token').focus();
+}
+
+function logout(message) {
+  token = '';
+  sessionStorage.removeItem('goinx-token');
+  timers.forEach(clearInterval);
+  timers = [];
+  closeLogs();
+  showLogin(message);
+}
+
+async function start() {
+  try {
+    await refreshSites();
+  } catch (err) {
+    if (err instanceof Unauthorized) {
+      logout(token ? 'Jeton refusé.' : '');
+      return;
+    }
+    setStatus(err.message, true);
+  }
+  sessionStorage.setItem('goinx-token', token);
+  $('login').hidden = true;
+  $('app').hidden = false;
+  $('reload').hidden = false;
+  $('logout').hidden = false;
+  refreshStats();
+  timers.push(setInterval(refreshStats, STATS_INTERVAL));
+  timers.push(setInterval(() => refreshSites().catch(handleError), SITES_INTERVAL));
+}
+
+// --- Données ---
+
+async function refreshSites() {
+  [sites, certs] = await Promise.all([api('GET', '/api/sites'), api('GET', '/api/certificates')]);
+  sites = sites || [];
+  renderSites();
+  renderCerts();
+}
+
+async function refreshStats() {
+  try {
+    const stats = await api('GET', '/api/stats');
+    if (lastStats) {
+      const elapsed = (new Date(stats.time) - new Date(lastStats.time)) / 1000;
+      for (const [name, snap] of Object.entries(stats.sites)) {
+        const before = lastStats.sites[name];
+        rates[name] = before && elapsed > 0 ? Math.max(0, snap.requests - before.requests) / elapsed : 0;
+      }
+    }
+    lastStats = stats;
+    renderSites();
+    renderErrors(stats.errors || []);
+    setStatus('Mis à jour à ' + new Date().toLocaleTimeString('fr-FR'));
+  } catch (err) {
+    handleError(err);
+  }
+}
+
+function daysLeft(date) {
+  return Math.floor((new Date(date) - Date.now()) / 86400000);
+}
+
+function certBadge(cert) {
+  if (!cert) return el('span', { class: 'muted' }, '-');
+  if (cert.error) return badge('erreur', 'bad');
+  const days = daysLeft(cert.not_after);
+  // Niveau calculé par Goinx selon cert_expiry_warn.
+  const kind = { expired: 'bad', critical: 'bad', warn: 'warn' }[cert.level] || 'ok';
+  return badge(days < 0 ? 'expiré' : days + ' j', kind);
+}
+
+// --- Rendu ---
+
+function renderSites() {
+  const body = $('sites');
+  body.replaceChildren();
+  for (const site of sites) {
+    const snap = lastStats && lastStats.sites[site.server_name];
+    const cert = certs.find((c) => c.site === site.server_name);
+
+    let state = badge('désactivé');
+    if (site.error) state = badge('config illisible', 'bad');
+    else if (site.enabled) state = site.loaded ? badge('en service', 'ok') : badge('activé, non chargé', 'warn');
+
+    let backend = el('span', { class: 'muted' }, '-');
+    if (site.backend) {
+      backend = el('span', null,
+        site.backend_running ? badge('actif', 'ok') : badge('arrêté', 'bad'),
+        site.backend_restarts ? ' ' + site.backend_restarts + ' relance(s)' : '');
+    }
+
+    const actions = el('td', null,
+      site.enabled
+        ? action('Désactiver', () => siteAction(site.name, 'disable', 'Désactiver ' + site.name + ' ?'))
+        : action('Activer', () => siteAction(site.name, 'enable')),
+      site.enabled ? action('Redéployer', () => siteAction(site.name, 'redeploy')) : null,
+      site.backend ? action('Relancer le backend', () => siteAction(site.name, 'backend/restart')) : null,
+      action('Config', () => openEditor(site.name)),
+      site.backend ? action('Logs', () => openLogs(site.name)) : null);
+
+    body.append(el('tr', null,
+      el('td', null, site.name),
+      el('td', null, site.server_name || '-'),
+      el('td', { title: site.error || '' }, state),
+      el('td', null, backend),
+      el('td', null, rates[site.server_name] !== undefined ? rates[site.server_name].toFixed(1) : '-'),
+      el('td', null, snap ? snap.errors : '-'),
+      el('td', null, snap ? snap.in_flight : '-'),
+      el('td', null, certBadge(cert)),
+      actions));
+  }
+}
+
+function renderErrors(errors) {
+  const body = $('errors');
+  body.replaceChildren();
+  if (errors.length === 0) {
+    body.append(el('tr', null, el('td', { colspan: 4, class: 'muted' }, 'Aucune erreur 5xx récente.')));
+    return;
+  }
+  for (const e of errors) {
+    body.append(el('tr', null,
+      el('td', null, new Date(e.time).toLocaleTimeString('fr-FR')),
+      el('td', null, e.site),
+      el('td', null, e.method + ' ' + e.path),
+      el('td', null, badge(e.status, 'bad'))));
+  }
+}
+
+function renderCerts() {
+  const body = $('certs');
+  body.replaceChildren();
+  if (!certs || certs.length === 0) {
+    body.append(el('tr', null, el('td', { colspan: 5, class: 'muted' }, 'Aucun site HTTPS chargé.')));
+    return;
+  }
+  for (const c of certs) {
+    body.append(el('tr', null,
+      el('td', null, c.site),
+      el('td', null, c.source),
+      el('td', { title: c.error || '' }, c.error ? c.error : (c.dns_names || []).join(', ')),
+      el('td', null, c.issuer || '-'),
+      el('td', null, certBadge(c), c.not_after ? ' ' + new Date(c.not_after).toLocaleDateString('fr-FR') : '')));
+  }
+}
+
+function action(label, fn) {
+  return el('button', { class: 'secondary', onclick: (e) => run(e.target, fn) }, label);
+}
+
+async function run(button, fn) {
+  button.disabled = true;
+  try {
+    await fn();
+  } catch (err) {
+    handleError(err);
+  } finally {
+    button.disabled = false;
+  }
+}
+
+async function siteAction(name, what, confirmText) {
+  if (confirmText && !confirm(confirmText)) return;
+  setStatus(name + ' : ' + what + '...');
+  await api('POST', '/api/sites/' + encodeURIComponent(name) + '/' + what);
+  setStatus(name + ' : ' + what + ' terminé.');
+  await refreshSites();
+}
+
+// --- Éditeur de configuration ---
+
+async function openEditor(name) {
+  const text = await api('GET', '/api/sites/' + encodeURIComponent(name) + '/conf');
+  editorSite = name;
+  $('editor-site').textContent = name;
+  $('editor-text').value = text;
+  $('editor-message').textContent = '';
+  $('editor-redeploy').hidden = true;
+  $('editor').hidden = false;
+  $('editor').scrollIntoView({ behavior: 'smooth' });
+}
+
+async function saveEditor() {
+  const message = $('editor-message');
+  try {
+    await api('PUT', '/api/sites/' + encodeURIComponent(editorSite) + '/conf', $('editor-text').value);
+    message.className = 'ok-text';
+    message.textContent = 'Config testée et enregistrée. Redéployez le site pour l’appliquer.';
+    const site = sites.find((s) => s.name === editorSite);
+    $('editor-redeploy').hidden = !(site && site.enabled);
+  } catch (err) {
+    if (err instanceof Unauthorized) throw err;
+    message.className = 'bad-text';
+    message.textContent = err.message;
+  }
+}
+
+// --- Logs en direct ---
+
+async function openLogs(name) {
+  closeLogs();
+  const out = $('logs-text');
+  out.textContent = '';
+  $('logs-site').textContent = name;
+  $('logs').hidden = false;
+  $('logs').scrollIntoView({ behavior: 'smooth' });
+
+  // fetch plutôt qu'EventSource, qui ne peut pas envoyer le jeton.
+  logsAbort = new AbortController();
+  const resp = await api('GET', '/api/sites/' + encodeURIComponent(name) + '/logs', undefined, true);
+  const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+  const signal = logsAbort.signal;
+  signal.addEventListener('abort', () => reader.cancel());
+
+  let buffer = '';
+  try {
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) break;
+      buffer += value;
+      let end;
+      while ((end = buffer.indexOf('\n\n')) >= 0) {
+        appendEvent(out, buffer.slice(0, end));
+        buffer = buffer.slice(end + 2);
+      }
+    }
+  } catch (err) {
+    if (!signal.aborted) throw err;
+  }
+}
+
+function appendEvent(out, block) {
+  let event = '';
+  const data = [];
+  for (const line of block.split('\n')) {
+    if (line.startsWith('event: ')) event = line.slice(7);
+    else if (line.startsWith('data: ')) data.push(line.slice(6));
+  }
+  if (data.length === 0) return;
+  const stick = out.scrollTop + out.clientHeight >= out.scrollHeight - 4;
+  out.append((event === 'end' ? '-- ' + data.join('\n') + ' --' : data.join('\n')) + '\n');
+  if (stick) out.scrollTop = out.scrollHeight;
+}
+
+function closeLogs() {
+  if (logsAbort) logsAbort.abort();
+  logsAbort = null;
+  $('logs').hidden = true;
+}
+
+// --- Initialisation ---
+
+document.addEventListener('DOMContentLoaded', () => {
+  $('login').addEventListener('submit', (e) => {
+    e.preventDefault();
+    token = $('token').value.trim();
+    $('token').value = '';
+    start();
+  });
+  $('logout').addEventListener('click', () => logout());
+  $('reload').addEventListener('click', (e) => run(e.target, async () => {
+    if (!confirm('Recharger la configuration de tous les sites ?')) return;
+    setStatus('Reload en cours...');
+    await api('POST', '/api/reload');
+    await refreshSites();
+    setStatus('Reload terminé.');
+  }));
+  $('editor-save').addEventListener('click', (e) => run(e.target, saveEditor));
+  $('editor-redeploy').addEventListener('click', (e) => run(e.target, async () => {
+    await siteAction(editorSite, 'redeploy');
+    $('editor-redeploy').hidden = true;
+  }));
+  $('editor-close').addEventListener('click', () => { $('editor').hidden = true; });
+  $('logs-close').addEventListener('click', closeLogs);
+
+  if (token) start();
+  else showLogin();
+});
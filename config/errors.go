@@ -6,24 +6,40 @@ import (
     "os"
     "path/filepath"
     "github.com/gin-gonic/gin"
+
+    "github.com/OxiWanV2/Goinx/server"
 )
 
 func ServeErrorPage(c *gin.Context, code int, siteConfig SiteConfig) {
+    WriteErrorPage(c.Writer, code, siteConfig)
+}
+
+// WriteErrorPage écrit la page d'erreur du site hors contexte gin (proxy).
+func WriteErrorPage(w http.ResponseWriter, code int, siteConfig SiteConfig) {
     errorsDir := filepath.Join(siteConfig.Root, "errors")
     errPage := filepath.Join(errorsDir, fmt.Sprintf("%d.html", code))
 
+    body := []byte(defaultErrorPage(code))
     info, err := os.Stat(errPage)
     if err == nil && !info.IsDir() {
-        c.Status(code)
-        c.File(errPage)
-        return
+        if content, err := os.ReadFile(errPage); err == nil {
+            body = content
+        }
     }
 
-    c.Data(code, "text/html; charset=utf-8", []byte(defaultErrorPage(code)))
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.WriteHeader(code)
+    w.Write(body)
 }
 
 func defaultErrorPage(code int) string {
     message := http.StatusText(code)
+    switch code {
+    case server.StatusCertError:
+        message = "Certificat client invalide"
+    case server.StatusNoCert:
+        message = "Certificat client requis"
+    }
     if message == "" {
         message = "Erreur inconnue"
     }
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const globalConfigPath = "/etc/goinx/goinx.conf"
+
+// GlobalConfig regroupe les directives de /etc/goinx/goinx.conf, communes à
+// tous les sites.
+type GlobalConfig struct {
+	AccessLog  *AccessLogConfig  // access_log par défaut des sites
+	LogFormats map[string]string // log_format nommés, utilisables par les sites
+
+	MetricsListen string // metrics_listen 127.0.0.1:9145, vide = désactivé
+
+	AdminListen string // admin_listen, défaut 127.0.0.1:9180
+	AdminToken  string // admin_token ou contenu de admin_token_file, vide = API désactivée
+
+	ACME ACMEConfig // acme_* par défaut des sites Let's Encrypt
+
+	TLS TLSPolicyConfig // tls_profile et ssl_* par défaut des sites HTTPS
+
+	CertWarnDays     int // cert_expiry_warn <jours> [<jours critiques>], défaut 30 et 7
+	CertCriticalDays int
+}
+
+type AccessLogConfig struct {
+	Path       string        // Fichier, "stdout" ou "stderr"
+	Format     string        // common, combined (défaut), json ou un log_format
+	Off        bool          // access_log off
+	Buffer     int           // buffer=64k
+	Flush      time.Duration // flush=1s
+	RotateSize int64         // rotate_size=100m
+	RotateTime time.Duration // rotate_time=24h
+	Keep       int           // keep=7
+}
+
+var (
+	globalMu     sync.Mutex
+	globalConfig GlobalConfig
+)
+
+// LoadGlobalConfig relit goinx.conf ; le fichier est facultatif.
+func LoadGlobalConfig() error {
+	conf, err := ParseGlobalConf(globalConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("lecture %s : %v", globalConfigPath, err)
+	}
+	globalMu.Lock()
+	globalConfig = conf
+	globalMu.Unlock()
+	return nil
+}
+
+func currentGlobalConfig() GlobalConfig {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	return globalConfig
+}
+
+func ParseGlobalConf(path string) (GlobalConfig, error) {
+	config := GlobalConfig{LogFormats: make(map[string]string)}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Fields(line)
+
+		switch parts[0] {
+		case "access_log":
+			accessLog, err := parseAccessLog(parts)
+			if err != nil {
+				return config, err
+			}
+			config.AccessLog = accessLog
+		case "log_format":
+			name, template, err := parseLogFormat(parts)
+			if err != nil {
+				return config, err
+			}
+			config.LogFormats[name] = template
+		case "metrics_listen":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : metrics_listen <adresse:port|off>")
+			}
+			if parts[1] != "off" {
+				config.MetricsListen = parts[1]
+			}
+		case "admin_listen":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : admin_listen <adresse:port>")
+			}
+			config.AdminListen = parts[1]
+		case "admin_token":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : admin_token <jeton>")
+			}
+			config.AdminToken = unquote(parts[1])
+		case "admin_token_file":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : admin_token_file <fichier>")
+			}
+			token, err := os.ReadFile(parts[1])
+			if err != nil {
+				return config, fmt.Errorf("admin_token_file : %v", err)
+			}
+			config.AdminToken = strings.TrimSpace(string(token))
+		case "tls_profile", "ssl_protocols", "ssl_ciphers", "ssl_ecdh_curve", "ssl_alpn", "ssl_session_tickets", "ssl_session_ticket_rotation", "ssl_stapling":
+			if err := parseTLSPolicy(&config.TLS, parts); err != nil {
+				return config, err
+			}
+		case "acme_directory", "acme_ca_root", "acme_email", "acme_eab", "acme_staging", "acme_preflight", "acme_preflight_resolver":
+			if err := parseACME(&config.ACME, parts); err != nil {
+				return config, err
+			}
+		case "cert_expiry_warn":
+			if len(parts) < 2 || len(parts) > 3 {
+				return config, fmt.Errorf("syntaxe attendue : cert_expiry_warn <jours> [<jours critiques>]")
+			}
+			warn, err := strconv.Atoi(parts[1])
+			critical := defaultCertCriticalDays
+			if err == nil && len(parts) == 3 {
+				critical, err = strconv.Atoi(parts[2])
+			}
+			if err != nil || warn <= 0 || critical <= 0 || critical > warn {
+				return config, fmt.Errorf("valeurs cert_expiry_warn invalides : %s", strings.Join(parts[1:], " "))
+			}
+			config.CertWarnDays, config.CertCriticalDays = warn, critical
+		default:
+			return config, fmt.Errorf("directive globale inconnue : %s", parts[0])
+		}
+	}
+	return config, scanner.Err()
+}
+
+// parseAccessLog lit "access_log <chemin|stdout|off> [format] [buffer=64k]
+// [flush=1s] [rotate_size=100m] [rotate_time=24h] [keep=7]".
+func parseAccessLog(parts []string) (*AccessLogConfig, error) {
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("syntaxe attendue : access_log <chemin|stdout|off> [format] [options]")
+	}
+	if parts[1] == "off" {
+		return &AccessLogConfig{Off: true}, nil
+	}
+
+	accessLog := &AccessLogConfig{Path: parts[1]}
+	for _, arg := range parts[2:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			accessLog.Format = arg
+			continue
+		}
+		valid := true
+		switch key {
+		case "buffer":
+			n, ok := parseSize(value)
+			accessLog.Buffer, valid = int(n), ok
+		case "flush":
+			accessLog.Flush, valid = parseDuration(value)
+		case "rotate_size":
+			accessLog.RotateSize, valid = parseSize(value)
+		case "rotate_time":
+			accessLog.RotateTime, valid = parseDuration(value)
+		case "keep":
+			n, err := strconv.Atoi(value)
+			accessLog.Keep, valid = n, err == nil && n >= 0
+		default:
+			return nil, fmt.Errorf("option access_log inconnue : %s", key)
+		}
+		if !valid {
+			return nil, fmt.Errorf("valeur invalide pour access_log %s : %s", key, value)
+		}
+	}
+	return accessLog, nil
+}
+
+// parseLogFormat lit "log_format <nom> [escape=json] <modèle>", le modèle
+// pouvant être entre guillemets.
+func parseLogFormat(parts []string) (string, string, error) {
+	if len(parts) < 3 {
+		return "", "", fmt.Errorf("syntaxe attendue : log_format <nom> [escape=json] <modèle>")
+	}
+	prefix := ""
+	values := parts[2:]
+	if values[0] == "escape=json" && len(values) > 1 {
+		prefix, values = "escape=json ", values[1:]
+	}
+	return parts[1], prefix + unquote(strings.Join(values, " ")), nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Listener est le serveur HTTP/3 (QUIC, UDP) d'un port HTTPS.
+type http3Listener struct {
+	srv  *http3.Server
+	conn net.PacketConn
+}
+
+var http3Listeners = make(map[string]*http3Listener) // Par port, sous httpsServersMu
+
+func hasHTTP3Site(configs []SiteConfig) bool {
+	for _, cfg := range configs {
+		if cfg.HTTP3 {
+			return true
+		}
+	}
+	return false
+}
+
+// start ouvre le port UDP à côté du listener TCP, avec la même config TLS
+// (choix du certificat et politique par SNI) et le même handler.
+func (l *http3Listener) start(port string, tlsConfig *tls.Config, handler http.Handler) {
+	addr := ":" + port
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		log.Printf("HTTP/3 indisponible sur le port %s : %v", port, err)
+		return
+	}
+	l.conn = conn
+	l.srv = &http3.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+	}
+	http3Listeners[port] = l
+	go func() {
+		log.Printf("Serveur HTTP/3 lancé sur port %s (UDP)", port)
+		if err := l.srv.Serve(conn); err != nil && err != http.ErrServerClosed && err != net.ErrClosed {
+			log.Printf("Erreur serveur HTTP/3 port %s : %v", port, err)
+		}
+	}()
+}
+
+// advertise annonce HTTP/3 par Alt-Svc aux clients d'un site http3 on.
+func (l *http3Listener) advertise(w http.ResponseWriter, site *Site) {
+	if l == nil || l.srv == nil || !site.Config.HTTP3 {
+		return
+	}
+	l.srv.SetQUICHeaders(w.Header())
+}
+
+// stopHTTP3 arrête le serveur HTTP/3 du port : GOAWAY puis attente des
+// requêtes en cours jusqu'à l'échéance de ctx.
+func stopHTTP3(ctx context.Context, port string) {
+	l := http3Listeners[port]
+	if l == nil {
+		return
+	}
+	if err := l.srv.Shutdown(ctx); err != nil {
+		log.Printf("Erreur arrêt serveur HTTP/3 port %s : %v", port, err)
+	}
+	l.conn.Close()
+}
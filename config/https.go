@@ -0,0 +1,254 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OxiWanV2/Goinx/certstore"
+	"github.com/OxiWanV2/Goinx/metrics"
+)
+
+var (
+	httpsServersMu sync.Mutex
+	httpsServers   = make(map[string]*http.Server) // Par port
+	httpsStores    = make(map[string]*certstore.Store)
+)
+
+// sslPort renvoie le port HTTPS du site, "" s'il n'est pas servi en HTTPS.
+// Le port 80 reste au listener principal : un site SSL qui l'indique est
+// servi sur 443.
+func sslPort(cfg SiteConfig) string {
+	switch {
+	case cfg.UseLetsEncrypt:
+		return "443"
+	case !cfg.SSLEnabled:
+		return ""
+	case cfg.Listen == "" || cfg.Listen == "80":
+		return "443"
+	}
+	return cfg.Listen
+}
+
+// LaunchHttpsServers ouvre un listener TLS par port. Le certificat est choisi
+// par SNI entre certificats fichiers (wildcards compris) et Let's Encrypt.
+func LaunchHttpsServers() {
+	sitesMu.Lock()
+	byPort := make(map[string][]SiteConfig)
+	var acmeSites []SiteConfig
+	for _, site := range sites {
+		port := sslPort(site.Config)
+		if port == "" {
+			continue
+		}
+		byPort[port] = append(byPort[port], site.Config)
+		if site.Config.UseLetsEncrypt {
+			acmeSites = append(acmeSites, site.Config)
+		}
+	}
+	sitesMu.Unlock()
+
+	if len(byPort) == 0 {
+		log.Println("Aucun site SSL actif, serveur HTTPS non lancé")
+		return
+	}
+
+	httpsServersMu.Lock()
+	defer httpsServersMu.Unlock()
+	if len(httpsServers) > 0 {
+		log.Println("Serveurs HTTPS déjà actifs, skip lancement")
+		return
+	}
+
+	stores := make(map[string]*certstore.Store)
+	for port, configs := range byPort {
+		store, defaultHost := portCertStore(port, configs)
+		store.Watch()
+		httpsStores[port] = store
+		stores[port] = store
+		tlsConfig := &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: store.GetCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+		}
+		if hasACMESite(configs) {
+			tlsConfig.NextProtos = append(tlsConfig.NextProtos, "acme-tls/1")
+		}
+		tlsConfig.GetConfigForClient = siteTLSConfig(tlsConfig, defaultHost)
+
+		var h3 *http3Listener
+		if hasHTTP3Site(configs) {
+			h3 = &http3Listener{}
+		}
+		handler := httpsHandler(port, defaultHost, h3)
+		if h3 != nil {
+			h3.start(port, tlsConfig, handler)
+		}
+
+		addr := ":" + port
+		srv := &http.Server{
+			Addr:      addr,
+			TLSConfig: tlsConfig,
+			Handler:   handler,
+			ConnState: metrics.ConnState(addr),
+		}
+		httpsServers[port] = srv
+		go func() {
+			log.Printf("Serveur HTTPS lancé sur port %s (%d sites)", port, len(configs))
+			ln, err := listen(port)
+			if err != nil {
+				log.Printf("Erreur serveur HTTPS port %s : %v", port, err)
+				return
+			}
+			if err := srv.ServeTLS(ln, "", ""); err != nil && err != http.ErrServerClosed {
+				log.Printf("Erreur serveur HTTPS port %s : %v", port, err)
+			}
+		}()
+	}
+	go enableACME(acmeSites, stores)
+	startCertExpiryCheck()
+}
+
+func hasACMESite(configs []SiteConfig) bool {
+	for _, cfg := range configs {
+		if cfg.UseLetsEncrypt {
+			return true
+		}
+	}
+	return false
+}
+
+// enableACME confie à ACME les domaines validables, une fois les serveurs
+// lancés : le contrôle préalable ne retarde pas les certificats fichiers.
+func enableACME(acmeSites []SiteConfig, stores map[string]*certstore.Store) {
+	ready := preflightSites(acmeSites)
+
+	httpsServersMu.Lock()
+	defer httpsServersMu.Unlock()
+	for _, cfg := range ready {
+		port := sslPort(cfg)
+		if httpsStores[port] != stores[port] {
+			return // Serveurs relancés entre-temps
+		}
+		if _, err := acmeManager(cfg); err != nil {
+			log.Printf("ACME indisponible pour %s : %v", cfg.ServerName, err)
+			continue
+		}
+		stores[port].AddACME(cfg.ServerName, acmeGetCertificate(cfg.ServerName))
+	}
+}
+
+// portCertStore prépare les certificats des sites d'un port. Le certificat
+// par défaut (client sans SNI ou nom inconnu) est celui du site
+// default_server, sinon du premier site à certificat fichier ou local.
+func portCertStore(port string, configs []SiteConfig) (*certstore.Store, string) {
+	sort.Slice(configs, func(i, j int) bool { return configs[i].ServerName < configs[j].ServerName })
+
+	store := certstore.New()
+	defaultHost, explicit := "", false
+	for _, cfg := range configs {
+		if cfg.SSLMode == "local" {
+			ca, err := localAuthority()
+			if err != nil {
+				log.Printf("CA locale indisponible pour site %s : %v", cfg.ServerName, err)
+				continue
+			}
+			store.AddIssuer(cfg.ServerName, ca.GetCertificate)
+			if defaultHost == "" {
+				defaultHost = cfg.ServerName
+			}
+		} else if !cfg.UseLetsEncrypt {
+			if !fileExists(cfg.SSLCertFile) || !fileExists(cfg.SSLKeyFile) {
+				log.Printf("Certificat ou clé ssl introuvable pour site %s", cfg.ServerName)
+				continue
+			}
+			if err := store.AddFile(cfg.ServerName, cfg.SSLCertFile, cfg.SSLKeyFile); err != nil {
+				log.Printf("Certificat ssl invalide pour site %s : %v", cfg.ServerName, err)
+				continue
+			}
+			if defaultHost == "" {
+				defaultHost = cfg.ServerName
+			}
+		}
+		if cfg.DefaultServer {
+			if explicit {
+				log.Printf("Plusieurs default_server sur le port %s, %s ignoré", port, cfg.ServerName)
+				continue
+			}
+			defaultHost, explicit = cfg.ServerName, true
+		}
+	}
+	if defaultHost != "" {
+		store.SetDefault(defaultHost)
+	}
+	return store, defaultHost
+}
+
+// httpsHandler route par Host vers les sites du port ; un nom inconnu va au
+// site par défaut du port s'il est déclaré default_server. Les sites http3 on
+// annoncent le listener HTTP/3 du port par Alt-Svc.
+func httpsHandler(port, defaultHost string, h3 *http3Listener) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if strings.Contains(host, ":") {
+			host = strings.Split(host, ":")[0]
+		}
+		site := siteForHost(host)
+		if site == nil || sslPort(site.Config) != port {
+			site = siteForHost(defaultHost)
+			if site == nil || !site.Config.DefaultServer {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		h3.advertise(w, site)
+		site.Handler.ServeHTTP(w, r)
+	})
+}
+
+// siteForHost cherche le site du host, puis un site wildcard "*.domaine".
+func siteForHost(host string) *Site {
+	host = strings.ToLower(host)
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	if site, ok := sites[host]; ok {
+		return site
+	}
+	if _, base, ok := strings.Cut(host, "."); ok {
+		return sites["*."+base]
+	}
+	return nil
+}
+
+func stopHttpsServers() {
+	httpsServersMu.Lock()
+	defer httpsServersMu.Unlock()
+	for port, srv := range httpsServers {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopHTTP3(ctx, port)
+		}()
+		err := srv.Shutdown(ctx)
+		wg.Wait()
+		cancel()
+		if err != nil {
+			log.Printf("Erreur arrêt serveur HTTPS port %s : %v", port, err)
+		} else {
+			log.Printf("Serveur HTTPS port %s arrêté", port)
+		}
+	}
+	httpsServers = make(map[string]*http.Server)
+	http3Listeners = make(map[string]*http3Listener)
+	for _, store := range httpsStores {
+		store.Close()
+	}
+	httpsStores = make(map[string]*certstore.Store)
+}
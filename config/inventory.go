@@ -0,0 +1,324 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OxiWanV2/Goinx/localca"
+)
+
+const (
+	defaultCertWarnDays     = 30
+	defaultCertCriticalDays = 7
+	certExpiryCheckInterval = 12 * time.Hour
+	renewBackupSuffix       = ".renew-bak"
+)
+
+// CertificateFile décrit un certificat présent sur disque : entrée du cache
+// ACME ou fichier ssl_cert_file.
+type CertificateFile struct {
+	File     string    `json:"file"`
+	Source   string    `json:"source"` // "acme", "file" ou "local-ca"
+	Subject  string    `json:"subject,omitempty"`
+	DNSNames []string  `json:"dns_names,omitempty"`
+	Issuer   string    `json:"issuer,omitempty"`
+	NotAfter time.Time `json:"not_after,omitzero"`
+	KeyType  string    `json:"key_type,omitempty"`
+	Sites    []string  `json:"sites,omitempty"` // server_name des sites qui le servent
+	Level    string    `json:"level,omitempty"` // "warn", "critical" ou "expired"
+	Error    string    `json:"error,omitempty"`
+}
+
+// CertInventory liste les certificats du cache ACME et ceux des sites
+// donnés, avec les sites qui les utilisent.
+func CertInventory(configs []SiteConfig) []CertificateFile {
+	users := make(map[string][]string) // Fichier -> server_name
+	files := make(map[string]string)   // Fichier -> source
+	for _, cfg := range configs {
+		switch {
+		case cfg.UseLetsEncrypt:
+			file := acmeCertFile(cfg)
+			users[file] = append(users[file], cfg.ServerName)
+			users[file+"+rsa"] = append(users[file+"+rsa"], cfg.ServerName)
+		case cfg.SSLEnabled && cfg.SSLCertFile != "":
+			users[cfg.SSLCertFile] = append(users[cfg.SSLCertFile], cfg.ServerName)
+			files[cfg.SSLCertFile] = "file"
+		}
+	}
+	for _, file := range acmeCacheFiles() {
+		files[file] = "acme"
+	}
+	// Les certificats locaux ne vivent qu'en mémoire : la CA les représente.
+	caFile := filepath.Join(localCADir, localca.CertName)
+	for _, cfg := range configs {
+		if cfg.SSLMode == "local" {
+			users[caFile] = append(users[caFile], cfg.ServerName)
+		}
+	}
+	if fileExists(caFile) {
+		files[caFile] = "local-ca"
+	}
+
+	var out []CertificateFile
+	for file, source := range files {
+		entry := CertificateFile{File: file, Source: source, Sites: users[file]}
+		sort.Strings(entry.Sites)
+		cert, err := readCertificate(file)
+		if err != nil {
+			entry.Error = err.Error()
+			out = append(out, entry)
+			continue
+		}
+		entry.Subject = cert.Subject.String()
+		entry.DNSNames = cert.DNSNames
+		entry.Issuer = cert.Issuer.String()
+		entry.NotAfter = cert.NotAfter
+		entry.KeyType = keyType(cert)
+		entry.Level = expiryLevel(cert.NotAfter)
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].File < out[j].File })
+	return out
+}
+
+// acmeCacheFiles renvoie les certificats du cache autocert, annuaire par
+// défaut et sous-dossiers acme/ ; comptes et jetons sont ignorés.
+func acmeCacheFiles() []string {
+	dirs := []string{certCacheDir}
+	if entries, err := os.ReadDir(filepath.Join(certCacheDir, "acme")); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, filepath.Join(certCacheDir, "acme", entry.Name()))
+			}
+		}
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, renewBackupSuffix) {
+				continue
+			}
+			if strings.Contains(strings.TrimSuffix(name, "+rsa"), "+") {
+				continue // acme_account+key, <jeton>+http-01...
+			}
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files
+}
+
+// certThresholds renvoie les seuils cert_expiry_warn en jours.
+func certThresholds() (warn, critical int) {
+	global := currentGlobalConfig()
+	warn, critical = global.CertWarnDays, global.CertCriticalDays
+	if warn == 0 {
+		warn = defaultCertWarnDays
+	}
+	if critical == 0 {
+		critical = defaultCertCriticalDays
+	}
+	return warn, critical
+}
+
+func expiryLevel(notAfter time.Time) string {
+	warn, critical := certThresholds()
+	left := time.Until(notAfter)
+	switch {
+	case left <= 0:
+		return "expired"
+	case left < time.Duration(critical)*24*time.Hour:
+		return "critical"
+	case left < time.Duration(warn)*24*time.Hour:
+		return "warn"
+	}
+	return ""
+}
+
+func printCertInventory(w io.Writer, certs []CertificateFile) {
+	if len(certs) == 0 {
+		fmt.Fprintln(w, "Aucun certificat trouvé.")
+		return
+	}
+	labels := map[string]string{"warn": "ATTENTION ", "critical": "CRITIQUE ", "expired": "EXPIRÉ "}
+	for _, c := range certs {
+		fmt.Fprintf(w, "%s%s (%s)\n", labels[c.Level], c.File, c.Source)
+		if c.Error != "" {
+			fmt.Fprintf(w, "    illisible : %s\n", c.Error)
+			continue
+		}
+		fmt.Fprintf(w, "    sujet : %s\n", c.Subject)
+		if len(c.DNSNames) > 0 {
+			fmt.Fprintf(w, "    SAN : %s\n", strings.Join(c.DNSNames, ", "))
+		}
+		fmt.Fprintf(w, "    émetteur : %s\n", c.Issuer)
+		fmt.Fprintf(w, "    expire le %s (%d jours), clé %s\n", c.NotAfter.Format("2006-01-02 15:04"), int(time.Until(c.NotAfter).Hours()/24), c.KeyType)
+		if len(c.Sites) > 0 {
+			fmt.Fprintf(w, "    sites : %s\n", strings.Join(c.Sites, ", "))
+		} else {
+			fmt.Fprintln(w, "    sites : aucun")
+		}
+	}
+}
+
+func loadedConfigs() []SiteConfig {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	configs := make([]SiteConfig, 0, len(sites))
+	for _, site := range sites {
+		configs = append(configs, site.Config)
+	}
+	return configs
+}
+
+var certExpiryOnce sync.Once
+
+// startCertExpiryCheck logue régulièrement les certificats proches de
+// l'expiration.
+func startCertExpiryCheck() {
+	certExpiryOnce.Do(func() {
+		go func() {
+			for {
+				for _, c := range CertInventory(loadedConfigs()) {
+					if c.Level != "" && len(c.Sites) > 0 {
+						log.Printf("Certificat %s (%s) : expire le %s", c.File, strings.Join(c.Sites, ", "), c.NotAfter.Format("2006-01-02"))
+					}
+				}
+				time.Sleep(certExpiryCheckInterval)
+			}
+		}()
+	})
+}
+
+// RenewCertificate force le renouvellement ACME de host : le certificat en
+// cache est mis de côté et un nouveau est demandé aussitôt. En cas d'échec,
+// l'ancien est remis en place.
+func RenewCertificate(host string) error {
+	cfg := loadedSiteConfig(strings.ToLower(host))
+	if cfg == nil || !cfg.UseLetsEncrypt {
+		return fmt.Errorf("%s n'est pas un site Let's Encrypt chargé", host)
+	}
+	if !acmeActive(cfg.ServerName) {
+		return fmt.Errorf("ACME inactif pour %s (voir le contrôle préalable dans status)", cfg.ServerName)
+	}
+
+	cached := acmeCertFile(*cfg)
+	var moved []string
+	for _, file := range []string{cached, cached + "+rsa"} {
+		if err := os.Rename(file, file+renewBackupSuffix); err == nil {
+			moved = append(moved, file)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// Un nouveau gestionnaire, sans le certificat gardé en mémoire.
+	if err := resetACMEManager(*cfg); err != nil {
+		restoreRenewBackups(moved)
+		return err
+	}
+	m, _ := acmeManager(*cfg)
+	// Hello ECDSA, comme les navigateurs actuels.
+	_, err := m.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:       cfg.ServerName,
+		SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:  []tls.CurveID{tls.CurveP256},
+		CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	})
+	if err != nil {
+		restoreRenewBackups(moved)
+		resetACMEManager(*cfg)
+		return fmt.Errorf("renouvellement %s : %v", cfg.ServerName, err)
+	}
+	for _, file := range moved {
+		os.Remove(file + renewBackupSuffix)
+	}
+	log.Printf("Certificat ACME de %s renouvelé", cfg.ServerName)
+	return nil
+}
+
+func restoreRenewBackups(moved []string) {
+	for _, file := range moved {
+		if err := os.Rename(file+renewBackupSuffix, file); err != nil {
+			log.Printf("Restauration de %s impossible : %v", file, err)
+		}
+	}
+}
+
+// RunCertsCommand exécute "goinx certs [renew <host>]" hors du serveur :
+// l'inventaire est lu sur disque, le renouvellement passe par l'API d'admin
+// du serveur en cours.
+func RunCertsCommand(args []string) error {
+	sitesConfig, err := LoadSitesConfigWithNames()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		configs := make([]SiteConfig, len(sitesConfig))
+		for i, site := range sitesConfig {
+			configs[i] = site.Config
+		}
+		printCertInventory(os.Stdout, CertInventory(configs))
+		return nil
+	}
+	if args[0] != "renew" || len(args) != 2 {
+		return fmt.Errorf("usage : goinx certs [renew <domaine>]")
+	}
+	return requestRenewal(args[1])
+}
+
+func requestRenewal(host string) error {
+	global := currentGlobalConfig()
+	if global.AdminToken == "" {
+		return fmt.Errorf("renouvellement impossible : API d'admin désactivée (admin_token)")
+	}
+	addr := global.AdminListen
+	if addr == "" {
+		addr = defaultAdminListen
+	}
+	if h, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(h); h == "" || (ip != nil && ip.IsUnspecified()) {
+			addr = net.JoinHostPort("127.0.0.1", port)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+"/api/certificates/"+url.PathEscape(host)+"/renew", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+global.AdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("API d'admin injoignable : %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body apiErrorBody
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+			return fmt.Errorf("renouvellement refusé : %s", resp.Status)
+		}
+		return fmt.Errorf("renouvellement refusé : %s", body.Error)
+	}
+	fmt.Printf("Certificat de %s renouvelé.\n", host)
+	return nil
+}
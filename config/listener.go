@@ -0,0 +1,36 @@
+package config
+
+import (
+	"net"
+
+	"github.com/OxiWanV2/Goinx/listener"
+)
+
+// listenerOptions rassemble les options des sites servis sur port : PROXY
+// protocol depuis leurs proxy_protocol_from, h2c sur :80 dès qu'un site
+// l'accepte (les autres sites y répondent 421).
+func listenerOptions(port string) listener.Options {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	opts := listener.Options{RejectH2C: port == "80"}
+	for _, site := range sites {
+		// Tous les sites passent par :80, ne serait-ce que pour la redirection HTTPS.
+		if port != "80" && sslPort(site.Config) != port {
+			continue
+		}
+		opts.ProxyFrom = append(opts.ProxyFrom, site.ProxyFrom...)
+		if port == "80" && site.Config.H2C {
+			opts.RejectH2C = false
+		}
+	}
+	return opts
+}
+
+// listen ouvre le port TCP avec PROXY protocol et contrôle h2c.
+func listen(port string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return nil, err
+	}
+	return listener.Wrap(ln, func() listener.Options { return listenerOptions(port) }), nil
+}
@@ -19,6 +19,10 @@ func LoadSitesConfigWithNames() ([]SiteWithName, error) {
 
     var sites []SiteWithName
 
+    if err := LoadGlobalConfig(); err != nil {
+        return nil, err
+    }
+
     entries, err := os.ReadDir(enabledDir)
     if err != nil {
         return nil, fmt.Errorf("lecture %s impossible : %v", enabledDir, err)
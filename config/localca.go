@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/OxiWanV2/Goinx/localca"
+)
+
+const localCADir = "/etc/goinx/local-ca"
+
+var (
+	localCAMu sync.Mutex
+	localCA   *localca.Authority
+)
+
+// localAuthority charge la CA locale, créée au premier site ssl_mode local.
+func localAuthority() (*localca.Authority, error) {
+	localCAMu.Lock()
+	defer localCAMu.Unlock()
+	if localCA != nil {
+		return localCA, nil
+	}
+	ca, err := localca.Load(localCADir)
+	if err != nil {
+		return nil, err
+	}
+	localCA = ca
+	return ca, nil
+}
+
+// RunCACommand exécute "goinx ca export [fichier]" : le certificat racine de
+// la CA locale, à faire approuver par les postes de développement.
+func RunCACommand(args []string) error {
+	if len(args) == 0 || args[0] != "export" || len(args) > 2 {
+		return fmt.Errorf("usage : goinx ca export [fichier]")
+	}
+	ca, err := localAuthority()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		_, err := os.Stdout.Write(ca.CertPEM())
+		return err
+	}
+	if err := os.WriteFile(args[1], ca.CertPEM(), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "CA locale exportée dans %s\n", args[1])
+	return nil
+}
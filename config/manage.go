@@ -0,0 +1,318 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/OxiWanV2/Goinx/backend"
+	"github.com/OxiWanV2/Goinx/server"
+	"github.com/OxiWanV2/Goinx/utils"
+)
+
+// Opérations sur les sites partagées par le CLI et l'API d'admin. Un site
+// est désigné par son dossier dans sites-available.
+
+// SiteState décrit un site de sites-available.
+type SiteState struct {
+	Name            string `json:"name"`
+	ServerName      string `json:"server_name,omitempty"`
+	Enabled         bool   `json:"enabled"`
+	Loaded          bool   `json:"loaded"` // Servi par les listeners
+	Backend         bool   `json:"backend"`
+	BackendRunning  bool   `json:"backend_running"`
+	BackendRestarts uint64 `json:"backend_restarts"`
+	Error           string `json:"error,omitempty"` // Config illisible
+
+	ACMEPreflight *PreflightResult `json:"acme_preflight,omitempty"` // Dernier contrôle ACME
+}
+
+// ErrUnknownSite signale un site absent de sites-available.
+type ErrUnknownSite string
+
+func (e ErrUnknownSite) Error() string {
+	return fmt.Sprintf("site %s introuvable dans sites-available", string(e))
+}
+
+func siteConfPath(siteName string) string {
+	return filepath.Join(sitesAvailableDir, siteName, siteName+".conf")
+}
+
+// checkSiteName refuse les noms qui sortiraient de sites-available.
+func checkSiteName(siteName string) error {
+	if siteName == "" || siteName == "." || siteName == ".." || strings.ContainsAny(siteName, `/\`) {
+		return fmt.Errorf("nom de site invalide : %q", siteName)
+	}
+	if !util.IsDir(filepath.Join(sitesAvailableDir, siteName)) {
+		return ErrUnknownSite(siteName)
+	}
+	return nil
+}
+
+func readSiteConf(siteName string) (SiteConfig, error) {
+	if err := checkSiteName(siteName); err != nil {
+		return SiteConfig{}, err
+	}
+	return ParseConf(siteConfPath(siteName))
+}
+
+func ListSites() ([]SiteState, error) {
+	entries, err := os.ReadDir(sitesAvailableDir)
+	if err != nil {
+		return nil, fmt.Errorf("lecture %s : %v", sitesAvailableDir, err)
+	}
+	backends := backend.Stats()
+
+	var states []SiteState
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		state := SiteState{
+			Name:    entry.Name(),
+			Enabled: util.LinkExists(filepath.Join(sitesEnabledDir, entry.Name())),
+		}
+		conf, err := ParseConf(siteConfPath(entry.Name()))
+		if err != nil {
+			state.Error = err.Error()
+			states = append(states, state)
+			continue
+		}
+		state.ServerName = conf.ServerName
+		state.Backend = conf.Backend != ""
+		state.Loaded = loadedSiteConfig(conf.ServerName) != nil
+		if b, ok := backends[conf.ServerName]; ok {
+			state.BackendRunning = b.Running
+			state.BackendRestarts = b.Restarts
+		}
+		if conf.UseLetsEncrypt {
+			state.ACMEPreflight = lastPreflight(conf.ServerName)
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func loadedSiteConfig(serverName string) *SiteConfig {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	if site, ok := sites[serverName]; ok {
+		return &site.Config
+	}
+	return nil
+}
+
+// TestSiteConf vérifie qu'un site pourrait être chargé tel quel.
+func TestSiteConf(siteName string) (SiteConfig, error) {
+	conf, err := readSiteConf(siteName)
+	if err != nil {
+		return conf, err
+	}
+	return conf, checkSiteConf(conf)
+}
+
+func checkSiteConf(conf SiteConfig) error {
+	if conf.ServerName == "" || conf.Root == "" {
+		return fmt.Errorf("server_name et root sont obligatoires")
+	}
+	if err := ValidateConfigs([]SiteConfig{conf}); err != nil {
+		return err
+	}
+	if err := checkACME(conf); err != nil {
+		return err
+	}
+	if _, err := clientAuthOptions(conf, nil); err != nil {
+		return err
+	}
+	if conf.RedirectsFile != "" {
+		if _, err := server.LoadRedirects(conf.RedirectsFile); err != nil {
+			return fmt.Errorf("redirects_file : %v", err)
+		}
+	}
+	return nil
+}
+
+// SiteConfText renvoie le fichier de config brut du site.
+func SiteConfText(siteName string) ([]byte, error) {
+	if err := checkSiteName(siteName); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(siteConfPath(siteName))
+}
+
+// SaveSiteConf remplace la config du site après l'avoir testée ; l'ancienne
+// version est gardée en .conf.bak. Le site n'est pas rechargé.
+func SaveSiteConf(siteName string, content []byte) error {
+	if err := checkSiteName(siteName); err != nil {
+		return err
+	}
+	path := siteConfPath(siteName)
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+siteName+".conf.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	conf, err := ParseConf(tmp.Name())
+	if err != nil {
+		return ErrInvalidConf{err}
+	}
+	if err := checkSiteConf(conf); err != nil {
+		return ErrInvalidConf{err}
+	}
+
+	if old, err := os.ReadFile(path); err == nil {
+		os.WriteFile(path+".bak", old, 0644)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	log.Printf("Config du site %s enregistrée", siteName)
+	return nil
+}
+
+// ErrInvalidConf signale une config refusée par testconf.
+type ErrInvalidConf struct{ Err error }
+
+func (e ErrInvalidConf) Error() string { return "config invalide : " + e.Err.Error() }
+func (e ErrInvalidConf) Unwrap() error { return e.Err }
+
+// RedeploySite recharge un site activé avec sa config actuelle et relance
+// son backend, sans toucher aux autres sites.
+func RedeploySite(siteName string) error {
+	conf, err := TestSiteConf(siteName)
+	if err != nil {
+		return err
+	}
+	if !util.LinkExists(filepath.Join(sitesEnabledDir, siteName)) {
+		return fmt.Errorf("site %s non activé", siteName)
+	}
+	sitesMu.Lock()
+	old := sites[conf.ServerName]
+	sitesMu.Unlock()
+
+	if conf.Backend != "" {
+		if err := backend.StopBackend(conf.ServerName); err != nil {
+			return err
+		}
+	}
+	// InitSite remplace l'ancien site : ses connexions longues finissent
+	// pendant le drain.
+	if err := InitSite(conf); err != nil {
+		return err
+	}
+	if old != nil && old.Proxy != nil {
+		go old.Proxy.Drain()
+	}
+	log.Printf("Site %s redéployé", siteName)
+	return nil
+}
+
+// ActivateSite crée le lien dans sites-enabled et charge le site. Le lien
+// est retiré si le site ne peut pas être chargé.
+func ActivateSite(siteName string) error {
+	conf, err := TestSiteConf(siteName)
+	if err != nil {
+		return err
+	}
+	if err := EnableSite(siteName); err != nil {
+		return err
+	}
+	if err := InitSite(conf); err != nil {
+		DisableSite(siteName)
+		return err
+	}
+	log.Printf("Site %s activé", siteName)
+	return nil
+}
+
+// DeactivateSite arrête de servir le site, stoppe son backend et retire le
+// lien de sites-enabled.
+func DeactivateSite(siteName string) error {
+	conf, err := readSiteConf(siteName)
+	if _, unknown := err.(ErrUnknownSite); unknown {
+		return err
+	}
+	if err == nil {
+		unloadSite(conf.ServerName)
+		if err := backend.StopBackend(conf.ServerName); err != nil {
+			return fmt.Errorf("arrêt backend : %v", err)
+		}
+	}
+	if err := StopServer(siteName); err != nil {
+		return fmt.Errorf("arrêt serveur : %v", err)
+	}
+	return DisableSite(siteName)
+}
+
+// unloadSite retire un site des listeners ; ses connexions longues ont le
+// délai de drain pour se terminer.
+func unloadSite(serverName string) {
+	sitesMu.Lock()
+	site, ok := sites[serverName]
+	delete(sites, serverName)
+	sitesMu.Unlock()
+	autocertMgrsMu.Lock()
+	delete(autocertMgrs, serverName)
+	autocertMgrsMu.Unlock()
+	if ok && site.Proxy != nil {
+		go site.Proxy.Drain()
+	}
+}
+
+// RestartBackend relance le backend du site avec sa config actuelle.
+func RestartBackend(siteName string) error {
+	conf, err := readSiteConf(siteName)
+	if err != nil {
+		return err
+	}
+	if conf.Backend == "" {
+		return fmt.Errorf("aucun backend configuré pour le site %s", siteName)
+	}
+	if err := backend.StopBackend(conf.ServerName); err != nil {
+		return err
+	}
+	return launchBackend(conf)
+}
+
+// launchBackend installe les dépendances puis démarre le backend du site.
+func launchBackend(cfg SiteConfig) error {
+	backendType, backendPath, ok := strings.Cut(cfg.Backend, ":")
+	if !ok {
+		return fmt.Errorf("backend mal formé : %s", cfg.Backend)
+	}
+	if backendType != "nodejs" {
+		return fmt.Errorf("backend non supporté : %s", backendType)
+	}
+	if err := backend.SetupNodeModules(backendPath); err != nil {
+		log.Printf("npm install erreur backend site %s : %v", cfg.ServerName, err)
+	}
+	return backend.LaunchNodeBackend(cfg.ServerName, backendPath, cfg.BackendFile)
+}
+
+// SiteLogs abonne aux logs du backend d'un site et renvoie les dernières
+// lignes déjà émises.
+func SiteLogs(siteName string) (recent []string, lines <-chan string, cancel func(), err error) {
+	conf, err := readSiteConf(siteName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	recent = backend.RecentLogs(conf.ServerName)
+	lines, cancel, ok := backend.SubscribeLogs(conf.ServerName)
+	if !ok {
+		return recent, nil, nil, fmt.Errorf("aucun backend en cours pour le site %s", siteName)
+	}
+	return recent, lines, cancel, nil
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/OxiWanV2/Goinx/backend"
+	"github.com/OxiWanV2/Goinx/metrics"
+	"github.com/OxiWanV2/Goinx/proxy"
+)
+
+var (
+	metricsServerMu sync.Mutex
+	metricsServer   *http.Server
+)
+
+func init() {
+	metrics.RegisterCollector(collectMetrics)
+}
+
+// StartMetricsListener lance, déplace ou arrête l'écoute metrics_listen
+// selon goinx.conf.
+func StartMetricsListener() {
+	addr := currentGlobalConfig().MetricsListen
+
+	metricsServerMu.Lock()
+	defer metricsServerMu.Unlock()
+	if metricsServer != nil {
+		if metricsServer.Addr == addr {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		metricsServer.Shutdown(ctx)
+		cancel()
+		metricsServer = nil
+		log.Println("Serveur de métriques arrêté")
+	}
+	if addr == "" {
+		return
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           metrics.Endpoint(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	metricsServer = srv
+	go func() {
+		log.Printf("Métriques Prometheus exposées sur %s", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Erreur serveur de métriques : %v", err)
+		}
+	}()
+}
+
+// collectMetrics ajoute au scrape l'état lu à la demande : backends,
+// erreurs upstream, caches et expiration des certificats.
+func collectMetrics(w *metrics.Writer) {
+	backends := backend.Stats()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.Family("goinx_backend_up", "gauge", "1 si le backend du site tourne.")
+	for _, name := range names {
+		up := 0.0
+		if backends[name].Running {
+			up = 1
+		}
+		w.Sample("goinx_backend_up", up, "site", name)
+	}
+	w.Family("goinx_backend_restarts_total", "counter", "Relances du backend du site depuis le démarrage.")
+	for _, name := range names {
+		w.Sample("goinx_backend_restarts_total", float64(backends[name].Restarts), "site", name)
+	}
+
+	stats := proxy.Stats()
+	names = names[:0]
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.Family("goinx_upstream_errors_total", "counter", "Échecs du proxy vers le backend par code renvoyé au client.")
+	for _, name := range names {
+		for _, code := range []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+			w.Sample("goinx_upstream_errors_total", float64(stats[name].UpstreamErrors[code]), "site", name, "code", strconv.Itoa(code))
+		}
+	}
+	w.Family("goinx_upstream_connections", "gauge", "Connexions longues ouvertes vers le backend par type.")
+	for _, name := range names {
+		w.Sample("goinx_upstream_connections", float64(stats[name].WebSockets), "site", name, "type", "websocket")
+		w.Sample("goinx_upstream_connections", float64(stats[name].SSE), "site", name, "type", "sse")
+	}
+	w.Family("goinx_upstream_circuit_open", "gauge", "1 si le disjoncteur du backend est ouvert ou semi-ouvert.")
+	for _, b := range proxy.Breakers() {
+		open := 0.0
+		if b.State != proxy.BreakerClosed {
+			open = 1
+		}
+		w.Sample("goinx_upstream_circuit_open", open, "site", b.Site, "upstream", b.Upstream)
+	}
+
+	zones := proxy.CacheZones()
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Zone < zones[j].Zone })
+	w.Family("goinx_cache_requests_total", "counter", "Requêtes du cache proxy par zone et résultat.")
+	for _, z := range zones {
+		w.Sample("goinx_cache_requests_total", float64(z.Hits), "zone", z.Zone, "result", "hit")
+		w.Sample("goinx_cache_requests_total", float64(z.Misses), "zone", z.Zone, "result", "miss")
+		w.Sample("goinx_cache_requests_total", float64(z.Stale), "zone", z.Zone, "result", "stale")
+	}
+	w.Family("goinx_cache_hit_ratio", "gauge", "Part des requêtes servies depuis le cache (copies périmées comprises).")
+	for _, z := range zones {
+		ratio := 0.0
+		if total := z.Hits + z.Misses + z.Stale; total > 0 {
+			ratio = float64(z.Hits+z.Stale) / float64(total)
+		}
+		w.Sample("goinx_cache_hit_ratio", ratio, "zone", z.Zone)
+	}
+	w.Family("goinx_cache_memory_bytes", "gauge", "Mémoire occupée par la zone de cache.")
+	for _, z := range zones {
+		w.Sample("goinx_cache_memory_bytes", float64(z.Memory), "zone", z.Zone)
+	}
+
+	w.Family("goinx_ssl_certificate_expiry_timestamp_seconds", "gauge", "Date d'expiration (Unix) du certificat servi pour le site.")
+	for _, site := range sslSites() {
+		cert, err := readCertificate(site.file)
+		if err != nil {
+			continue
+		}
+		w.Sample("goinx_ssl_certificate_expiry_timestamp_seconds", float64(cert.NotAfter.Unix()), "site", site.name, "source", site.source)
+	}
+}
@@ -2,13 +2,22 @@ package config
 
 import (
 	"bufio"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"strconv"
+	"time"
 )
 
 func ParseConf(path string) (SiteConfig, error) {
-	var config SiteConfig
+	config := SiteConfig{
+		ImmutableAssets: true,
+		Precompressed:   true,
+	}
 
 	file, err := os.Open(path)
 	if err != nil {
@@ -16,6 +25,8 @@ func ParseConf(path string) (SiteConfig, error) {
 	}
 	defer file.Close()
 
+	var location *Location
+	var cors *CorsConfig
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -26,6 +37,53 @@ func ParseConf(path string) (SiteConfig, error) {
 		if len(parts) == 0 {
 			continue
 		}
+
+		switch {
+		case parts[0] == "cors":
+			if cors != nil || len(parts) != 2 || parts[1] != "{" {
+				return config, fmt.Errorf("syntaxe attendue : cors {")
+			}
+			cors = &CorsConfig{}
+			continue
+		case parts[0] == "}" && cors != nil:
+			if cors.AllowCredentials && slices.Contains(cors.AllowOrigins, "*") {
+				return config, fmt.Errorf("cors : allow_origins * est incompatible avec allow_credentials on")
+			}
+			if location != nil {
+				location.Cors = cors
+			} else {
+				config.Cors = cors
+			}
+			cors = nil
+			continue
+		case cors != nil:
+			if err := parseCorsDirective(cors, parts); err != nil {
+				return config, err
+			}
+			continue
+		case parts[0] == "location":
+			if location != nil {
+				return config, fmt.Errorf("bloc location %s imbriqué dans %s", parts[1], location.Prefix)
+			}
+			if len(parts) != 3 || parts[2] != "{" || !strings.HasPrefix(parts[1], "/") {
+				return config, fmt.Errorf("syntaxe attendue : location /prefixe {")
+			}
+			location = &Location{Prefix: parts[1]}
+			continue
+		case parts[0] == "}":
+			if location == nil {
+				return config, fmt.Errorf("accolade fermante sans bloc location")
+			}
+			config.Locations = append(config.Locations, *location)
+			location = nil
+			continue
+		case location != nil:
+			if err := parseLocationDirective(location, parts); err != nil {
+				return config, err
+			}
+			continue
+		}
+
 		switch parts[0] {
 		case "server_name":
 			if len(parts) >= 2 {
@@ -35,6 +93,12 @@ func ParseConf(path string) (SiteConfig, error) {
 			if len(parts) >= 2 {
 				config.Listen = parts[1]
 			}
+			for _, opt := range parts[2:] {
+				if opt != "default_server" {
+					return config, fmt.Errorf("option listen inconnue : %s", opt)
+				}
+				config.DefaultServer = true
+			}
 		case "root":
 			if len(parts) >= 2 {
 				config.Root = parts[1]
@@ -60,11 +124,78 @@ func ParseConf(path string) (SiteConfig, error) {
 			if len(parts) >= 2 {
 				config.SSLKeyFile = parts[1]
 			}
+		case "ssl_mode":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : ssl_mode local|acme|file")
+			}
+			switch parts[1] {
+			case "local":
+				config.SSLMode, config.SSLEnabled = "local", true
+			case "acme":
+				config.UseLetsEncrypt = true
+			case "file":
+				config.SSLEnabled = true
+			default:
+				return config, fmt.Errorf("valeur ssl_mode invalide : %s (local, acme ou file)", parts[1])
+			}
+		case "h2c":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : h2c on|off")
+			}
+			config.H2C = parseSwitch(parts[1])
+		case "proxy_protocol":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : proxy_protocol on|off")
+			}
+			config.ProxyProtocol = parseSwitch(parts[1])
+		case "proxy_protocol_from":
+			if len(parts) < 2 {
+				return config, fmt.Errorf("syntaxe attendue : proxy_protocol_from <ip|cidr>...")
+			}
+			if err := checkNetworks(parts); err != nil {
+				return config, err
+			}
+			config.ProxyProtocolFrom = append(config.ProxyProtocolFrom, parts[1:]...)
+		case "http3":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : http3 on|off")
+			}
+			config.HTTP3 = parseSwitch(parts[1])
+		case "ssl_client_certificate":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : ssl_client_certificate <ca.pem>")
+			}
+			config.SSLClientCertificate = parts[1]
+		case "ssl_verify_client":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : ssl_verify_client on|optional|off")
+			}
+			switch parts[1] {
+			case "on", "optional":
+				config.SSLVerifyClient = parts[1]
+			case "off":
+				config.SSLVerifyClient = ""
+			default:
+				return config, fmt.Errorf("valeur ssl_verify_client invalide : %s (on, optional ou off)", parts[1])
+			}
+		case "ssl_crl":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : ssl_crl <fichier>")
+			}
+			config.SSLCRL = parts[1]
 		case "use_lets_encrypt":
 			if len(parts) >= 2 {
 				val := strings.ToLower(parts[1])
 				config.UseLetsEncrypt = (val == "true" || val == "1")
 			}
+		case "tls_profile", "ssl_protocols", "ssl_ciphers", "ssl_ecdh_curve", "ssl_alpn", "ssl_session_tickets", "ssl_session_ticket_rotation", "ssl_stapling":
+			if err := parseTLSPolicy(&config.TLS, parts); err != nil {
+				return config, err
+			}
+		case "acme_directory", "acme_ca_root", "acme_email", "acme_eab", "acme_staging", "acme_preflight", "acme_preflight_resolver":
+			if err := parseACME(&config.ACME, parts); err != nil {
+				return config, err
+			}
 		case "backend":
 			if len(parts) >= 3 {
 				config.BackendRoute = parts[1]
@@ -81,11 +212,541 @@ func ParseConf(path string) (SiteConfig, error) {
 					config.BackendInternalPort = port
 				}
 			}
+		case "proxy_stream_read_timeout":
+			d, err := durationArg(parts, false)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyStreamReadTimeout = d
+		case "proxy_stream_idle_timeout":
+			d, err := durationArg(parts, false)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyStreamIdleTimeout = d
+		case "proxy_flush_interval":
+			d, err := durationArg(parts, true)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyFlushInterval = d
+		case "proxy_keepalive_interval":
+			d, err := durationArg(parts, false)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyKeepAliveInterval = d
+		case "proxy_drain_timeout":
+			d, err := durationArg(parts, false)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyDrainTimeout = d
+		case "proxy_set_header":
+			if len(parts) < 2 {
+				return config, fmt.Errorf("syntaxe attendue : proxy_set_header <nom> <valeur>")
+			}
+			config.ProxySetHeaders = append(config.ProxySetHeaders, HeaderDirective{
+				Name:  parts[1],
+				Value: unquote(strings.Join(parts[2:], " ")),
+			})
+		case "proxy_hide_header":
+			if len(parts) < 2 {
+				return config, fmt.Errorf("syntaxe attendue : proxy_hide_header <nom>...")
+			}
+			config.ProxyHideHeaders = append(config.ProxyHideHeaders, parts[1:]...)
+		case "proxy_redirect":
+			switch len(parts) {
+			case 2:
+				if parts[1] != "default" && parts[1] != "off" {
+					return config, fmt.Errorf("valeur proxy_redirect invalide : %s (default, off ou <de> <vers>)", parts[1])
+				}
+				config.ProxyRedirect = parts[1]
+			case 3:
+				config.ProxyRedirects = append(config.ProxyRedirects, PathRewrite{From: parts[1], To: parts[2]})
+			default:
+				return config, fmt.Errorf("syntaxe attendue : proxy_redirect default|off|<de> <vers>")
+			}
+		case "proxy_cookie_path":
+			if len(parts) != 3 {
+				return config, fmt.Errorf("syntaxe attendue : proxy_cookie_path <de> <vers>")
+			}
+			config.ProxyCookiePaths = append(config.ProxyCookiePaths, PathRewrite{From: parts[1], To: parts[2]})
+		case "set_real_ip_from":
+			if len(parts) < 2 {
+				return config, fmt.Errorf("syntaxe attendue : set_real_ip_from <ip|cidr>...")
+			}
+			if err := checkNetworks(parts); err != nil {
+				return config, err
+			}
+			config.RealIPFrom = append(config.RealIPFrom, parts[1:]...)
+		case "proxy_connect_timeout":
+			d, err := durationArg(parts, false)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyConnectTimeout = d
+		case "proxy_read_timeout":
+			d, err := durationArg(parts, false)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyReadTimeout = d
+		case "proxy_retries":
+			n, err := intArg(parts, 0, 100)
+			if err != nil {
+				return config, err
+			}
+			if n == 0 {
+				n = -1 // 0 désactive, la valeur nulle du champ reste le défaut
+			}
+			config.ProxyRetries = n
+		case "proxy_retry_budget":
+			if len(parts) == 2 {
+				parts = []string{parts[0], strings.TrimSuffix(parts[1], "%")}
+			}
+			n, err := intArg(parts, 1, 100)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyRetryBudget = n
+		case "proxy_breaker_threshold":
+			n, err := intArg(parts, 1, 1000)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyBreakerThreshold = n
+		case "proxy_breaker_cooldown":
+			d, err := durationArg(parts, false)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyBreakerCooldown = d
+		case "proxy_cache":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : proxy_cache <zone>|off")
+			}
+			if parts[1] != "off" {
+				config.ProxyCache = parts[1]
+			}
+		case "proxy_cache_path":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : proxy_cache_path <dossier>")
+			}
+			config.ProxyCachePath = parts[1]
+		case "proxy_cache_key":
+			if len(parts) < 2 {
+				return config, fmt.Errorf("syntaxe attendue : proxy_cache_key <modèle>")
+			}
+			config.ProxyCacheKey = unquote(strings.Join(parts[1:], " "))
+		case "proxy_cache_valid":
+			d, err := durationArg(parts, false)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyCacheValid = d
+		case "proxy_cache_stale":
+			if len(parts) == 2 && parts[1] == "off" {
+				config.ProxyCacheStale = -1
+				break
+			}
+			d, err := durationArg(parts, false)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyCacheStale = d
+		case "proxy_cache_max_size":
+			n, err := sizeArg(parts)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyCacheMaxSize = n
+		case "proxy_cache_max_object":
+			n, err := sizeArg(parts)
+			if err != nil {
+				return config, err
+			}
+			config.ProxyCacheMaxObject = n
+		case "expires":
+			if len(parts) != 3 {
+				return config, fmt.Errorf("syntaxe attendue : expires <motif> <durée>|off|epoch|max")
+			}
+			switch parts[2] {
+			case "off", "epoch", "max":
+			default:
+				if d, ok := parseDuration(parts[2]); !ok || d < 0 {
+					return config, fmt.Errorf("valeur expires invalide : %s (durée, off, epoch ou max)", parts[2])
+				}
+			}
+			config.StaticCacheRules = append(config.StaticCacheRules, StaticCacheRule{Pattern: parts[1], Expires: parts[2]})
+		case "cache_control":
+			if len(parts) < 3 {
+				return config, fmt.Errorf("syntaxe attendue : cache_control <motif> <valeur>")
+			}
+			config.StaticCacheRules = append(config.StaticCacheRules, StaticCacheRule{
+				Pattern:      parts[1],
+				CacheControl: unquote(strings.Join(parts[2:], " ")),
+			})
+		case "immutable_assets":
+			if len(parts) >= 2 {
+				config.ImmutableAssets = parseSwitch(parts[1])
+			}
+		case "precompressed":
+			if len(parts) >= 2 {
+				config.Precompressed = parseSwitch(parts[1])
+			}
+		case "try_files":
+			if len(parts) >= 2 {
+				config.TryFiles = parts[1:]
+			}
+		case "rewrite", "return":
+			rule, err := parseRewrite(parts)
+			if err != nil {
+				return config, err
+			}
+			config.Rewrites = append(config.Rewrites, rule)
+		case "add_header":
+			header, err := parseAddHeader(parts)
+			if err != nil {
+				return config, err
+			}
+			config.AddHeaders = append(config.AddHeaders, header)
+		case "remove_header":
+			if len(parts) < 2 {
+				return config, fmt.Errorf("syntaxe attendue : remove_header <nom>...")
+			}
+			config.RemoveHeaders = append(config.RemoveHeaders, parts[1:]...)
+		case "security_headers":
+			if len(parts) >= 2 {
+				switch parts[1] {
+				case "strict":
+					config.SecurityHeaders = parts[1]
+				case "off":
+					config.SecurityHeaders = ""
+				default:
+					return config, fmt.Errorf("valeur security_headers invalide : %s (strict ou off)", parts[1])
+				}
+			}
+		case "access_log":
+			accessLog, err := parseAccessLog(parts)
+			if err != nil {
+				return config, err
+			}
+			config.AccessLog = accessLog
+		case "log_format":
+			name, template, err := parseLogFormat(parts)
+			if err != nil {
+				return config, err
+			}
+			if config.LogFormats == nil {
+				config.LogFormats = make(map[string]string)
+			}
+			config.LogFormats[name] = template
+		case "redirects_file":
+			if len(parts) >= 2 {
+				config.RedirectsFile = parts[1]
+			}
+		case "allow_hidden":
+			if len(parts) >= 2 {
+				config.AllowHidden = parseSwitch(parts[1])
+			}
+		case "disable_symlinks":
+			if len(parts) >= 2 {
+				switch parts[1] {
+				case "on", "off", "if_not_owner":
+					config.DisableSymlinks = parts[1]
+				default:
+					return config, fmt.Errorf("valeur disable_symlinks invalide : %s (on, off ou if_not_owner)", parts[1])
+				}
+			}
+		case "compression":
+			if len(parts) != 2 {
+				return config, fmt.Errorf("syntaxe attendue : compression on|off")
+			}
+			config.Compression = parseSwitch(parts[1])
+		case "compression_types":
+			if len(parts) < 2 {
+				return config, fmt.Errorf("syntaxe attendue : compression_types <type mime>...")
+			}
+			config.CompressionTypes = append(config.CompressionTypes, parts[1:]...)
+		case "compression_min_length":
+			n, err := sizeArg(parts)
+			if err != nil {
+				return config, err
+			}
+			config.CompressionMinLength = int(n)
+		case "compression_level":
+			n, err := intArg(parts, 1, 11)
+			if err != nil {
+				return config, err
+			}
+			config.CompressionLevel = n
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
 		return config, err
 	}
+	if cors != nil {
+		return config, fmt.Errorf("bloc cors non fermé")
+	}
+	if location != nil {
+		return config, fmt.Errorf("bloc location %s non fermé", location.Prefix)
+	}
+	if config.SSLMode == "local" {
+		config.UseLetsEncrypt = false // La CA locale l'emporte
+	}
+	if config.ProxyProtocol && len(config.ProxyProtocolFrom) == 0 {
+		// Sans liste, n'importe quel client pourrait annoncer une fausse adresse.
+		return config, fmt.Errorf("proxy_protocol on exige proxy_protocol_from")
+	}
+	if config.HTTP3 && sslPort(config) == "" {
+		return config, fmt.Errorf("http3 on exige un site HTTPS")
+	}
+	if config.SSLVerifyClient != "" && config.SSLClientCertificate == "" {
+		return config, fmt.Errorf("ssl_verify_client exige ssl_client_certificate")
+	}
+	for _, loc := range config.Locations {
+		if loc.VerifyClient && config.SSLVerifyClient == "" {
+			// Le certificat n'est demandé pendant la poignée de main que si le site le prévoit.
+			return config, fmt.Errorf("ssl_verify_client on dans location %s exige ssl_verify_client optional au niveau du site", loc.Prefix)
+		}
+	}
 	return config, nil
-}
\ No newline at end of file
+}
+
+// parseLocationDirective lit une directive à l'intérieur d'un bloc location.
+func parseLocationDirective(location *Location, parts []string) error {
+	switch parts[0] {
+	case "root":
+		if len(parts) >= 2 {
+			location.Root = parts[1]
+		}
+	case "try_files":
+		if len(parts) >= 2 {
+			location.TryFiles = parts[1:]
+		}
+	case "rewrite", "return":
+		rule, err := parseRewrite(parts)
+		if err != nil {
+			return err
+		}
+		location.Rewrites = append(location.Rewrites, rule)
+	case "add_header":
+		header, err := parseAddHeader(parts)
+		if err != nil {
+			return err
+		}
+		location.AddHeaders = append(location.AddHeaders, header)
+	case "ssl_verify_client":
+		if len(parts) != 2 || (parts[1] != "on" && parts[1] != "off") {
+			return fmt.Errorf("syntaxe attendue dans une location : ssl_verify_client on|off")
+		}
+		location.VerifyClient = parts[1] == "on"
+	case "remove_header":
+		if len(parts) < 2 {
+			return fmt.Errorf("syntaxe attendue : remove_header <nom>...")
+		}
+		location.RemoveHeaders = append(location.RemoveHeaders, parts[1:]...)
+	default:
+		return fmt.Errorf("directive %s non supportée dans location %s", parts[0], location.Prefix)
+	}
+	return nil
+}
+
+// parseRewrite lit "rewrite <regex> <remplacement> [flag]" ou
+// "return <code> [url|texte]".
+func parseRewrite(parts []string) (RewriteDirective, error) {
+	if parts[0] == "return" {
+		if len(parts) < 2 {
+			return RewriteDirective{}, fmt.Errorf("syntaxe attendue : return <code> [url|texte]")
+		}
+		if strings.HasPrefix(parts[1], "http://") || strings.HasPrefix(parts[1], "https://") || strings.HasPrefix(parts[1], "$scheme") {
+			// "return <url>" équivaut à "return 302 <url>", comme nginx.
+			return RewriteDirective{Code: http.StatusFound, Replacement: parts[1]}, nil
+		}
+		code, err := strconv.Atoi(parts[1])
+		if err != nil || code < 200 || code > 599 {
+			return RewriteDirective{}, fmt.Errorf("code de return invalide : %s", parts[1])
+		}
+		return RewriteDirective{Code: code, Replacement: unquote(strings.Join(parts[2:], " "))}, nil
+	}
+
+	if len(parts) < 3 || len(parts) > 4 {
+		return RewriteDirective{}, fmt.Errorf("syntaxe attendue : rewrite <regex> <remplacement> [last|break|redirect|permanent]")
+	}
+	if _, err := regexp.Compile(parts[1]); err != nil {
+		return RewriteDirective{}, fmt.Errorf("regex rewrite invalide %s : %v", parts[1], err)
+	}
+	rule := RewriteDirective{Pattern: parts[1], Replacement: parts[2]}
+	if len(parts) == 4 {
+		switch parts[3] {
+		case "last", "break", "redirect", "permanent":
+			rule.Flag = parts[3]
+		default:
+			return RewriteDirective{}, fmt.Errorf("flag rewrite inconnu : %s", parts[3])
+		}
+	}
+	return rule, nil
+}
+
+// parseCorsDirective lit une directive à l'intérieur d'un bloc cors.
+func parseCorsDirective(cors *CorsConfig, parts []string) error {
+	values := parts[1:]
+	switch parts[0] {
+	case "allow_origins", "allow_origin":
+		for _, origin := range values {
+			if expr, ok := strings.CutPrefix(origin, "~"); ok {
+				if _, err := regexp.Compile(expr); err != nil {
+					return fmt.Errorf("regex d'origine cors invalide %s : %v", origin, err)
+				}
+			}
+		}
+		cors.AllowOrigins = append(cors.AllowOrigins, values...)
+	case "allow_methods":
+		for _, m := range values {
+			cors.AllowMethods = append(cors.AllowMethods, strings.ToUpper(m))
+		}
+	case "allow_headers":
+		cors.AllowHeaders = append(cors.AllowHeaders, values...)
+	case "expose_headers":
+		cors.ExposeHeaders = append(cors.ExposeHeaders, values...)
+	case "allow_credentials":
+		if len(values) >= 1 {
+			cors.AllowCredentials = parseSwitch(values[0])
+		}
+	case "max_age":
+		if len(values) >= 1 {
+			if d, ok := parseDuration(values[0]); ok && d > 0 {
+				cors.MaxAge = d
+			}
+		}
+	default:
+		return fmt.Errorf("directive %s non supportée dans cors", parts[0])
+	}
+	return nil
+}
+
+// parseAddHeader lit "add_header <nom> <valeur> [always]", la valeur pouvant
+// être entre guillemets et contenir des espaces.
+func parseAddHeader(parts []string) (ResponseHeader, error) {
+	if len(parts) < 3 {
+		return ResponseHeader{}, fmt.Errorf("syntaxe attendue : add_header <nom> <valeur> [always]")
+	}
+	header := ResponseHeader{Name: parts[1]}
+	values := parts[2:]
+	if len(values) > 1 && values[len(values)-1] == "always" {
+		header.Always = true
+		values = values[:len(values)-1]
+	}
+	header.Value = unquote(strings.Join(values, " "))
+	return header, nil
+}
+
+// unquote retire les guillemets entourant une valeur ("" = valeur vide).
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// parseSwitch lit une valeur on/off (ou true/false, 1/0).
+func parseSwitch(value string) bool {
+	value = strings.ToLower(value)
+	return value == "on" || value == "true" || value == "1"
+}
+
+// parseSize accepte une taille en octets avec suffixe optionnel k, m ou g.
+func parseSize(value string) (int64, bool) {
+	multiplier := int64(1)
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n * multiplier, true
+}
+
+// checkNetworks vérifie les IP ou CIDR d'une directive (set_real_ip_from,
+// proxy_protocol_from).
+func checkNetworks(parts []string) error {
+	for _, source := range parts[1:] {
+		if _, _, err := net.ParseCIDR(source); err != nil && net.ParseIP(source) == nil {
+			return fmt.Errorf("%s invalide : %s", parts[0], source)
+		}
+	}
+	return nil
+}
+
+// sizeArg lit l'unique taille d'une directive (octets, k, m ou g).
+func sizeArg(parts []string) (int64, error) {
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("syntaxe attendue : %s <taille>", parts[0])
+	}
+	n, ok := parseSize(parts[1])
+	if !ok {
+		return 0, fmt.Errorf("taille %s invalide : %s", parts[0], parts[1])
+	}
+	return n, nil
+}
+
+// intArg lit l'unique entier d'une directive, borné entre low et high.
+func intArg(parts []string, low, high int) (int, error) {
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("syntaxe attendue : %s <nombre>", parts[0])
+	}
+	n, err := strconv.Atoi(parts[1])
+	if err != nil || n < low || n > high {
+		return 0, fmt.Errorf("valeur %s invalide : %s (%d à %d)", parts[0], parts[1], low, high)
+	}
+	return n, nil
+}
+
+// durationArg lit l'unique durée d'une directive ; une valeur négative est
+// refusée sauf si negative (proxy_flush_interval -1).
+func durationArg(parts []string, negative bool) (time.Duration, error) {
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("syntaxe attendue : %s <durée>", parts[0])
+	}
+	d, ok := parseDuration(parts[1])
+	if !ok || (d < 0 && !negative) {
+		return 0, fmt.Errorf("durée %s invalide : %s", parts[0], parts[1])
+	}
+	return d, nil
+}
+
+// parseDuration accepte un nombre de secondes ("60"), de jours ("30d") ou une
+// durée Go ("10m"). Une valeur négative vaut -1 (utilisé par
+// proxy_flush_interval).
+func parseDuration(value string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, true
+		}
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 0 {
+			return -1, true
+		}
+		return time.Duration(n) * time.Second, true
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false
+	}
+	if d < 0 {
+		return -1, true
+	}
+	return d, true
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// parseError lit un site réduit à directive et renvoie l'erreur du parser.
+func parseError(t *testing.T, directive string) error {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "site.conf")
+	if err := os.WriteFile(file, []byte("server_name exemple.com\n"+directive+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ParseConf(file)
+	return err
+}
+
+func TestParseDirectiveErrors(t *testing.T) {
+	tests := []struct {
+		directive string
+		ok        bool
+	}{
+		{"proxy_stream_read_timeout 30s", true},
+		{"proxy_stream_read_timeout 30x", false},
+		{"proxy_stream_idle_timeout", false},
+		{"proxy_stream_idle_timeout -5", false},
+		{"proxy_flush_interval -1", true},
+		{"proxy_flush_interval vite", false},
+		{"proxy_keepalive_interval 15s 20s", false},
+		{"proxy_drain_timeout 1m", true},
+		{"proxy_hide_header X-Powered-By Server", true},
+		{"proxy_hide_header", false},
+		{"set_real_ip_from 10.0.0.0/8 192.168.1.10 ::1", true},
+		{"set_real_ip_from", false},
+		{"set_real_ip_from 10.0.0.0/33", false},
+		{"set_real_ip_from proxy.local", false},
+		{"proxy_set_header", false},
+		{"proxy_redirect off", true},
+		{"proxy_redirect / /api/", true},
+		{"proxy_redirect defaut", false},
+		{"proxy_cookie_path /", false},
+		{"proxy_connect_timeout 5s", true},
+		{"proxy_connect_timeout 5 s", false},
+		{"proxy_read_timeout -1", false},
+		{"proxy_retries 0", true},
+		{"proxy_retries deux", false},
+		{"proxy_retries -3", false},
+		{"proxy_retry_budget 20%", true},
+		{"proxy_retry_budget 150%", false},
+		{"proxy_breaker_threshold 0", false},
+		{"proxy_breaker_cooldown 30s", true},
+		{"proxy_breaker_cooldown 30sec", false},
+		{"proxy_cache", false},
+		{"proxy_cache off", true},
+		{"proxy_cache_key", false},
+		{"proxy_cache_valid 10m", true},
+		{"proxy_cache_valid 10 minutes", false},
+		{"proxy_cache_stale off", true},
+		{"proxy_cache_stale jamais", false},
+		{"proxy_cache_max_size 256m", true},
+		{"proxy_cache_max_size 256mo", false},
+		{"proxy_cache_max_object -1", false},
+		{"expires *.js 30d", true},
+		{"expires /assets/* max", true},
+		{"expires *.html epoch", true},
+		{"expires *.css 30jours", false},
+		{"expires *.css", false},
+		{"cache_control *.html", false},
+		{"compression", false},
+		{"compression_types", false},
+		{"compression_types text/html application/json", true},
+		{"compression_min_length 1k", true},
+		{"compression_min_length 1ko", false},
+		{"compression_level 11", true},
+		{"compression_level 12", false},
+		{"compression_level max", false},
+		{"remove_header X-Powered-By", true},
+		{"remove_header", false},
+		{"location /api {\nremove_header\n}", false},
+	}
+	for _, tt := range tests {
+		if err := parseError(t, tt.directive); (err == nil) != tt.ok {
+			t.Errorf("%q : erreur %v", tt.directive, err)
+		}
+	}
+}
+
+func TestParseRetries(t *testing.T) {
+	if cfg := parseTestConf(t, "proxy_retries 0\nproxy_retry_budget 35%\n"); cfg.ProxyRetries != -1 || cfg.ProxyRetryBudget != 35 {
+		t.Errorf("proxy_retries %d, proxy_retry_budget %d", cfg.ProxyRetries, cfg.ProxyRetryBudget)
+	}
+}
+
+func TestParseDurations(t *testing.T) {
+	cfg := parseTestConf(t, "proxy_stream_idle_timeout 2d\nproxy_drain_timeout 45\nproxy_flush_interval -1\n")
+	if cfg.ProxyStreamIdleTimeout != 48*time.Hour || cfg.ProxyDrainTimeout != 45*time.Second || cfg.ProxyFlushInterval != -1 {
+		t.Errorf("durées lues : %s %s %s", cfg.ProxyStreamIdleTimeout, cfg.ProxyDrainTimeout, cfg.ProxyFlushInterval)
+	}
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	acmeChallengePrefix = "/.well-known/acme-challenge/"
+	preflightTimeout    = 10 * time.Second
+)
+
+// PreflightResult est le verdict du contrôle préalable ACME d'un domaine.
+type PreflightResult struct {
+	Host   string    `json:"host"`
+	OK     bool      `json:"ok"`
+	Forced bool      `json:"forced,omitempty"` // acme_preflight off : ACME lancé sans contrôle
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// Preflight vérifie qu'une autorité ACME joindra Goinx par le nom public :
+// un jeton aléatoire servi sous /.well-known/acme-challenge/ doit revenir en
+// HTTP sur le port 80 du domaine, quel que soit le chemin réseau (NAT,
+// load balancer, redirection de port).
+type Preflight struct {
+	Resolver *net.Resolver // nil = résolveur système
+	Client   *http.Client  // nil = client HTTP passant par Resolver
+	Timeout  time.Duration // 0 = 10s
+}
+
+var (
+	preflightTokensMu sync.Mutex
+	preflightTokens   = make(map[string]string) // Jeton -> domaine
+
+	preflightResultsMu sync.Mutex
+	preflightResults   = make(map[string]PreflightResult)
+)
+
+// Check lance le contrôle pour host.
+func (p *Preflight) Check(ctx context.Context, host string) PreflightResult {
+	result := PreflightResult{Host: host, Time: time.Now()}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = preflightTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resolver := p.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		result.Reason = fmt.Sprintf("résolution DNS impossible : %v", err)
+		return result
+	}
+	ips := make([]string, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP.String()
+	}
+
+	token, err := newPreflightToken()
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	preflightTokensMu.Lock()
+	preflightTokens[token] = host
+	preflightTokensMu.Unlock()
+	defer func() {
+		preflightTokensMu.Lock()
+		delete(preflightTokens, token)
+		preflightTokensMu.Unlock()
+	}()
+
+	client := p.Client
+	if client == nil {
+		dialer := &net.Dialer{Resolver: resolver, Timeout: timeout}
+		client = &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext, DisableKeepAlives: true}}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+acmeChallengePrefix+token, nil)
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+	resp, err := client.Do(req)
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err // L'URL du jeton n'apporte rien au verdict
+	}
+	if err != nil {
+		result.Reason = fmt.Sprintf("%s (%s) injoignable sur le port 80 : %v", host, strings.Join(ips, ", "), err)
+		return result
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != token {
+		result.Reason = fmt.Sprintf("%s (%s) répond %s sans le jeton : le trafic n'arrive pas à ce Goinx", host, strings.Join(ips, ", "), resp.Status)
+		return result
+	}
+
+	result.OK = true
+	result.Reason = fmt.Sprintf("jeton relu via %s (%s)", host, strings.Join(ips, ", "))
+	return result
+}
+
+func newPreflightToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("génération du jeton : %v", err)
+	}
+	return "goinx-preflight-" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// servePreflight répond aux jetons de contrôle en cours ; false si la
+// requête n'en est pas un.
+func servePreflight(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.URL.Path, acmeChallengePrefix)
+	if !ok || !strings.HasPrefix(token, "goinx-preflight-") {
+		return false
+	}
+	preflightTokensMu.Lock()
+	_, known := preflightTokens[token]
+	preflightTokensMu.Unlock()
+	if !known {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, token)
+	return true
+}
+
+// sitePreflight construit le contrôle du site selon acme_preflight_resolver.
+func sitePreflight(cfg SiteConfig) *Preflight {
+	p := &Preflight{}
+	if addr := acmePreflightResolver(cfg); addr != "" {
+		p.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	return p
+}
+
+// runPreflight contrôle le domaine du site, sauf acme_preflight off, et
+// garde le verdict pour status.
+func runPreflight(cfg SiteConfig) PreflightResult {
+	var result PreflightResult
+	if acmePreflightEnabled(cfg) {
+		result = sitePreflight(cfg).Check(context.Background(), cfg.ServerName)
+	} else {
+		result = PreflightResult{
+			Host:   cfg.ServerName,
+			OK:     true,
+			Forced: true,
+			Reason: "contrôle désactivé (acme_preflight off)",
+			Time:   time.Now(),
+		}
+	}
+	preflightResultsMu.Lock()
+	preflightResults[cfg.ServerName] = result
+	preflightResultsMu.Unlock()
+	return result
+}
+
+// PreflightResults renvoie les derniers verdicts, triés par domaine.
+func PreflightResults() []PreflightResult {
+	preflightResultsMu.Lock()
+	defer preflightResultsMu.Unlock()
+	out := make([]PreflightResult, 0, len(preflightResults))
+	for _, result := range preflightResults {
+		out = append(out, result)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+func lastPreflight(host string) *PreflightResult {
+	preflightResultsMu.Lock()
+	defer preflightResultsMu.Unlock()
+	if result, ok := preflightResults[host]; ok {
+		return &result
+	}
+	return nil
+}
+
+// CheckACMEPreflight relance le contrôle pour un site Let's Encrypt ; nil
+// pour un site sans ACME.
+func CheckACMEPreflight(siteName string) (*PreflightResult, error) {
+	conf, err := readSiteConf(siteName)
+	if err != nil {
+		return nil, err
+	}
+	if !conf.UseLetsEncrypt {
+		return nil, nil
+	}
+	if !waitMainListener(preflightTimeout) {
+		return &PreflightResult{Host: conf.ServerName, Reason: "listener :80 non démarré", Time: time.Now()}, nil
+	}
+	result := runPreflight(conf)
+	return &result, nil
+}
+
+// preflightSites contrôle en parallèle les sites ACME et ne garde que ceux
+// qu'une autorité pourra valider.
+func preflightSites(configs []SiteConfig) []SiteConfig {
+	if len(configs) == 0 {
+		return nil
+	}
+	if !waitMainListener(preflightTimeout) {
+		log.Println("Listener :80 non démarré, contrôle ACME impossible")
+	}
+
+	results := make([]PreflightResult, len(configs))
+	var wg sync.WaitGroup
+	for i, cfg := range configs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runPreflight(cfg)
+		}()
+	}
+	wg.Wait()
+
+	var ready []SiteConfig
+	for i, cfg := range configs {
+		if results[i].OK {
+			ready = append(ready, cfg)
+			continue
+		}
+		log.Printf("Let's Encrypt ignoré pour %s : %s (acme_preflight off pour forcer)", cfg.ServerName, results[i].Reason)
+	}
+	return ready
+}
+
+var (
+	mainListenerOnce  sync.Once
+	mainListenerReady = make(chan struct{})
+)
+
+func markMainListenerReady() {
+	mainListenerOnce.Do(func() { close(mainListenerReady) })
+}
+
+func waitMainListener(timeout time.Duration) bool {
+	select {
+	case <-mainListenerReady:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
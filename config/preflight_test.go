@@ -0,0 +1,79 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialTo renvoie un client HTTP qui joint addr quel que soit le domaine
+// demandé, comme le ferait le DNS public du site.
+func dialTo(addr string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+		DisableKeepAlives: true,
+	}}
+}
+
+func TestPreflightCheck(t *testing.T) {
+	// Ce Goinx : répond aux jetons en cours.
+	goinx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !servePreflight(w, r) {
+			http.NotFound(w, r)
+		}
+	}))
+	defer goinx.Close()
+	// Un autre serveur derrière le même nom.
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("autre serveur"))
+	}))
+	defer other.Close()
+	// Port fermé.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedAddr := closed.Listener.Addr().String()
+	closed.Close()
+
+	noDNS := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("serveur DNS injoignable")
+		},
+	}
+
+	tests := []struct {
+		name     string
+		host     string
+		resolver *net.Resolver
+		client   *http.Client
+		ok       bool
+		reason   string
+	}{
+		{"jeton relu", "localhost", nil, dialTo(goinx.Listener.Addr().String()), true, "jeton relu"},
+		{"mauvais corps", "localhost", nil, dialTo(other.Listener.Addr().String()), false, "sans le jeton"},
+		{"injoignable", "localhost", nil, dialTo(closedAddr), false, "injoignable"},
+		{"échec DNS", "preflight.goinx.test", noDNS, dialTo(goinx.Listener.Addr().String()), false, "résolution DNS impossible"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Preflight{Resolver: tt.resolver, Client: tt.client, Timeout: 2 * time.Second}
+			result := p.Check(context.Background(), tt.host)
+			if result.OK != tt.ok || !strings.Contains(result.Reason, tt.reason) {
+				t.Errorf("OK=%v %q, attendu OK=%v avec %q", result.OK, result.Reason, tt.ok, tt.reason)
+			}
+		})
+	}
+
+	preflightTokensMu.Lock()
+	defer preflightTokensMu.Unlock()
+	if len(preflightTokens) != 0 {
+		t.Errorf("%d jeton(s) restés actifs après contrôle", len(preflightTokens))
+	}
+}
@@ -2,22 +2,24 @@ package config
 
 import (
     "context"
-    "crypto/tls"
+    "crypto/x509"
     "fmt"
     "log"
     "net"
     "net/http"
-    "net/http/httputil"
     "net/url"
     "os"
-    "path/filepath"
+    "regexp"
     "strings"
     "sync"
     "time"
     "github.com/gin-gonic/gin"
     "golang.org/x/crypto/acme/autocert"
-    "github.com/OxiWanV2/Goinx/backend"
+    "github.com/OxiWanV2/Goinx/accesslog"
     "github.com/OxiWanV2/Goinx/errors"
+    "github.com/OxiWanV2/Goinx/metrics"
+    "github.com/OxiWanV2/Goinx/proxy"
+    "github.com/OxiWanV2/Goinx/server"
 )
 
 type SiteServer struct {
@@ -28,10 +30,15 @@ type SiteServer struct {
 }
 
 type Site struct {
-    Config  SiteConfig
-    Router  *gin.Engine
-    Running bool
-    Mutex   sync.Mutex
+    Config    SiteConfig
+    Router    *gin.Engine
+    Handler   http.Handler // Router précédé des rewrite/return et redirects_file
+    Proxy     *proxy.Proxy
+    ClientCAs *x509.CertPool // CA demandées au client TLS (ssl_verify_client), nil sinon
+    TLS       *tlsPolicy     // tls_profile et ssl_* effectifs
+    ProxyFrom []*net.IPNet   // Sources PROXY protocol de confiance (proxy_protocol on)
+    Running   bool
+    Mutex     sync.Mutex
 }
 
 var (
@@ -41,63 +48,52 @@ var (
     autocertMgrs    = make(map[string]*autocert.Manager)
     activeServersMu sync.Mutex
     activeServers   = make(map[string]*SiteServer)
-    httpsServerMu   sync.Mutex
-    httpsServer     *http.Server
 )
 
-func domainPointsToServerIP(domain string) bool {
-    domainIPs, err := net.LookupIP(domain)
-    if err != nil {
-        log.Printf("DNS lookup fail for %s: %v", domain, err)
-        return false
-    }
-
-    localIPs := map[string]bool{}
-    ifaces, err := net.Interfaces()
-    if err != nil {
-        log.Printf("Erreur récupération interfaces réseau: %v", err)
-        return false
-    }
-    for _, iface := range ifaces {
-        addrs, err := iface.Addrs()
-        if err != nil {
-            continue
-        }
-        for _, addr := range addrs {
-            var ip net.IP
-            switch v := addr.(type) {
-            case *net.IPNet:
-                ip = v.IP
-            case *net.IPAddr:
-                ip = v.IP
-            }
-            if ip != nil {
-                localIPs[ip.String()] = true
-            }
-        }
-    }
-
-    for _, ip := range domainIPs {
-        if localIPs[ip.String()] {
-            return true
-        }
-    }
-
-    return false
-}
-
 func InitSite(cfg SiteConfig) error {
     r := gin.New()
     r.Use(gin.Recovery())
+    if cfg.Compression {
+        r.Use(server.Compress(server.CompressOptions{
+            Types:     cfg.CompressionTypes,
+            MinLength: cfg.CompressionMinLength,
+            Level:     cfg.CompressionLevel,
+        }))
+    }
 
+    var backendProxy *proxy.Proxy
     if cfg.BackendRoute != "" && cfg.BackendInternalPort != 0 {
         remoteURL := fmt.Sprintf("http://localhost:%d", cfg.BackendInternalPort)
         remote, err := url.Parse(remoteURL)
         if err == nil {
-            proxy := httputil.NewSingleHostReverseProxy(remote)
+            backendProxy = proxy.New(proxy.Options{
+                Site:              cfg.ServerName,
+                Target:            remote,
+                StripPrefix:       cfg.BackendRoute,
+                StreamReadTimeout: cfg.ProxyStreamReadTimeout,
+                StreamIdleTimeout: cfg.ProxyStreamIdleTimeout,
+                FlushInterval:     cfg.ProxyFlushInterval,
+                KeepAliveInterval: cfg.ProxyKeepAliveInterval,
+                DrainTimeout:      cfg.ProxyDrainTimeout,
+                TrustedProxies:    cfg.RealIPFrom,
+                SetHeaders:        headerRules(cfg.ProxySetHeaders),
+                HideHeaders:       cfg.ProxyHideHeaders,
+                Redirect:          cfg.ProxyRedirect,
+                Redirects:         pathRules(cfg.ProxyRedirects),
+                CookiePaths:       pathRules(cfg.ProxyCookiePaths),
+                ConnectTimeout:    cfg.ProxyConnectTimeout,
+                ReadTimeout:       cfg.ProxyReadTimeout,
+                Retries:           cfg.ProxyRetries,
+                RetryBudget:       cfg.ProxyRetryBudget,
+                BreakerThreshold:  cfg.ProxyBreakerThreshold,
+                BreakerCooldown:   cfg.ProxyBreakerCooldown,
+                ErrorHandler: func(w http.ResponseWriter, r *http.Request, status int) {
+                    WriteErrorPage(w, status, cfg)
+                },
+                Cache: cacheOptions(cfg),
+            })
             r.Any(cfg.BackendRoute+"/*proxyPath", func(c *gin.Context) {
-                c.Request.URL.Path = strings.TrimPrefix(c.Request.URL.Path, cfg.BackendRoute)
-                proxy.ServeHTTP(c.Writer, c.Request)
+                backendProxy.ServeHTTP(c.Writer, c.Request)
             })
             log.Printf("Reverse proxy configuré : %s -> %s pour site %s", cfg.BackendRoute, remoteURL, cfg.ServerName)
         } else {
@@ -105,42 +101,56 @@ func InitSite(cfg SiteConfig) error {
         }
     }
 
-    r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("X-Powered-By", "Goinx")
-        if cfg.BackendRoute != "" && strings.HasPrefix(c.Request.URL.Path, cfg.BackendRoute) {
-            c.Next()
-            return
-        }
-        file := filepath.Join(cfg.Root, c.Request.URL.Path)
-        if info, err := os.Stat(file); err == nil && !info.IsDir() {
-            c.File(file)
-            c.Abort()
-            return
-        }
-        c.Next()
+    r.Use(server.PoweredBy())
+    static := staticOptions(cfg)
+    r.Use(server.Static(static))
+
+    r.NoRoute(func(c *gin.Context) {
+        errors.InjectBackendErrorPopup(r)
+        ServeErrorPage(c, http.StatusNotFound, cfg)
+        c.Abort()
     })
 
-    if cfg.VuejsRewrite.Path != "" && cfg.VuejsRewrite.Fallback != "" {
-        r.NoRoute(func(c *gin.Context) {
-            if strings.HasPrefix(c.Request.URL.Path, cfg.VuejsRewrite.Path) {
-                c.File(filepath.Join(cfg.Root, cfg.VuejsRewrite.Fallback))
-            } else {
-                errors.InjectBackendErrorPopup(r)
-                ServeErrorPage(c, http.StatusNotFound, cfg)
-                c.Abort()
-            }
-        })
-    } else {
-        r.NoRoute(func(c *gin.Context) {
-            errors.InjectBackendErrorPopup(r)
-            ServeErrorPage(c, http.StatusNotFound, cfg)
-            c.Abort()
-        })
+    rewrite := server.RewriteOptions{
+        Rules:     rewriteRules(cfg.Rewrites),
+        Locations: static.Locations,
+        ErrorHandler: func(w http.ResponseWriter, r *http.Request, status int) {
+            WriteErrorPage(w, status, cfg)
+        },
+    }
+    if cfg.RedirectsFile != "" {
+        redirects, err := server.LoadRedirects(cfg.RedirectsFile)
+        if err != nil {
+            return fmt.Errorf("redirects_file : %v", err)
+        }
+        rewrite.Redirects = redirects
+        log.Printf("%d redirections chargées depuis %s pour site %s", len(redirects), cfg.RedirectsFile, cfg.ServerName)
     }
 
+    clientAuth, err := clientAuthOptions(cfg, static.Locations)
+    if err != nil {
+        return err
+    }
+    var handler http.Handler = server.Headers(headerOptions(cfg, static.Locations),
+        server.Cors(server.CorsOptions{Policy: corsPolicy(cfg.Cors), Locations: static.Locations},
+            server.Rewrite(rewrite, server.RequireClientCert(clientAuth, r))))
+    handler = metrics.Instrument(cfg.ServerName, withAccessLog(cfg, server.ClientAuth(clientAuth, handler)))
+
     site := &Site{
-        Config: cfg,
-        Router: r,
+        Config:  cfg,
+        Router:  r,
+        Handler: handler,
+        Proxy:   backendProxy,
+        TLS:     siteTLSPolicy(cfg),
+    }
+    if cfg.ProxyProtocol {
+        site.ProxyFrom = proxy.ParseNetworks(cfg.ProxyProtocolFrom)
+    }
+    if clientAuth.Mode != "" {
+        site.ClientCAs = x509.NewCertPool()
+        for _, ca := range clientAuth.CAs {
+            site.ClientCAs.AddCert(ca)
+        }
     }
 
     sitesMu.Lock()
@@ -152,50 +162,90 @@ func InitSite(cfg SiteConfig) error {
     }
 
     if cfg.Backend != "" {
-        parts := strings.SplitN(cfg.Backend, ":", 2)
-        if len(parts) == 2 {
-            backendType := parts[0]
-            backendPath := parts[1]
-
-            if backendType == "nodejs" {
-                if err := backend.SetupNodeModules(backendPath); err != nil {
-                    log.Printf("npm install erreur backend site %s : %v", cfg.ServerName, err)
-                }
-                go func() {
-                    if err := backend.LaunchNodeBackend(cfg.ServerName, backendPath, cfg.BackendFile); err != nil {
-                        log.Printf("Erreur lancement backend site %s : %v", cfg.ServerName, err)
-                    }
-                }()
-            } else {
-                log.Printf("Backend non supporté pour site %s : %s", cfg.ServerName, backendType)
-            }
-        } else {
-            log.Printf("Backend mal formé pour site %s : %s", cfg.ServerName, cfg.Backend)
+        if err := launchBackend(cfg); err != nil {
+            log.Printf("Erreur lancement backend site %s : %v", cfg.ServerName, err)
         }
     }
 
     return nil
 }
 
+func headerRules(headers []HeaderDirective) []proxy.HeaderRule {
+    rules := make([]proxy.HeaderRule, 0, len(headers))
+    for _, h := range headers {
+        rules = append(rules, proxy.HeaderRule{Name: h.Name, Value: h.Value})
+    }
+    return rules
+}
+
+func pathRules(rewrites []PathRewrite) []proxy.PathRule {
+    rules := make([]proxy.PathRule, 0, len(rewrites))
+    for _, rw := range rewrites {
+        rules = append(rules, proxy.PathRule{From: rw.From, To: rw.To})
+    }
+    return rules
+}
+
+func cacheOptions(cfg SiteConfig) *proxy.CacheOptions {
+    if cfg.ProxyCache == "" {
+        return nil
+    }
+    return &proxy.CacheOptions{
+        Zone:      cfg.ProxyCache,
+        Dir:       cfg.ProxyCachePath,
+        MaxMemory: cfg.ProxyCacheMaxSize,
+        MaxObject: cfg.ProxyCacheMaxObject,
+        Key:       cfg.ProxyCacheKey,
+        Valid:     cfg.ProxyCacheValid,
+        Stale:     cfg.ProxyCacheStale,
+    }
+}
+
+func staticOptions(cfg SiteConfig) server.StaticOptions {
+    opts := server.StaticOptions{
+        Root:            cfg.Root,
+        SkipPrefixes:    []string{cfg.BackendRoute},
+        ImmutableAssets: cfg.ImmutableAssets,
+        Precompressed:   cfg.Precompressed,
+        AllowHidden:     cfg.AllowHidden,
+        DisableSymlinks: cfg.DisableSymlinks,
+        ErrorHandler: func(w http.ResponseWriter, r *http.Request, status int) {
+            WriteErrorPage(w, status, cfg)
+        },
+        Locations: locations(cfg),
+    }
+    for _, rule := range cfg.StaticCacheRules {
+        cr := server.CacheRule{Pattern: rule.Pattern, CacheControl: rule.CacheControl}
+        switch rule.Expires {
+        case "":
+        case "off":
+            cr.Off = true
+        case "epoch":
+            cr.Expires = -1
+        case "max":
+            cr.Expires = 10 * 365 * 24 * time.Hour
+        default:
+            d, ok := parseDuration(rule.Expires)
+            if !ok || d < 0 {
+                log.Printf("Directive expires invalide pour site %s : %s %s", cfg.ServerName, rule.Pattern, rule.Expires)
+                continue
+            }
+            cr.Expires = d
+        }
+        opts.CacheRules = append(opts.CacheRules, cr)
+    }
+    return opts
+}
+
 func setupLetsEncrypt(site *Site) {
     host := site.Config.ServerName
-    certCacheDir := "/etc/goinx/certs-cache"
 
-    if !domainPointsToServerIP(host) {
-        log.Printf("Le domaine %s ne pointe pas vers cette IP. Ignorer Let's Encrypt.", host)
+    if err := checkACME(site.Config); err != nil {
+        log.Printf("ACME indisponible pour %s : %v", host, err)
         return
     }
 
-    autocertMgrsMu.Lock()
-    m := &autocert.Manager{
-        Cache:      autocert.DirCache(certCacheDir),
-        Prompt:     autocert.AcceptTOS,
-        HostPolicy: autocert.HostWhitelist(host),
-    }
-    autocertMgrs[host] = m
-    autocertMgrsMu.Unlock()
-
-    certFile := filepath.Join(certCacheDir, host)
+    certFile := acmeCertFile(site.Config)
     if fileExists(certFile) {
         log.Printf("Certificat Let's Encrypt pour %s trouvé en cache", host)
     } else {
@@ -228,39 +278,47 @@ func ReloadServers() error {
 
     sitesConfig, err := LoadSitesConfigWithNames()
     if err != nil {
+        metrics.RecordReload(err)
         return err
     }
+    StartMetricsListener()
+    StartAdminListener()
 
-    httpsServerMu.Lock()
-    if httpsServer != nil {
-        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-        err := httpsServer.Shutdown(ctx)
-        cancel()
-        if err != nil {
-            log.Printf("Erreur arrêt serveur HTTPS : %v", err)
-        } else {
-            log.Println("Serveur HTTPS arrêté")
-        }
-        httpsServer = nil
-    }
-    httpsServerMu.Unlock()
+    stopHttpsServers()
 
     sitesMu.Lock()
+    oldSites := sites
     sites = make(map[string]*Site)
     sitesMu.Unlock()
 
+    // Les WebSocket ouvertes sur les anciens routers restent servies le
+    // temps du drain, les nouvelles connexions vont aux nouveaux routers.
+    for _, site := range oldSites {
+        if site.Proxy != nil {
+            go site.Proxy.Drain()
+        }
+    }
+
     autocertMgrsMu.Lock()
     autocertMgrs = make(map[string]*autocert.Manager)
     autocertMgrsMu.Unlock()
 
+    var initErr error
+    var cacheZones []string
     for _, site := range sitesConfig {
         err := InitSite(site.Config)
         if err != nil {
             log.Printf("Erreur initialisation site %s : %v", site.Name, err)
+            initErr = fmt.Errorf("site %s : %v", site.Name, err)
             continue
         }
+        if site.Config.ProxyCache != "" {
+            cacheZones = append(cacheZones, site.Config.ProxyCache)
+        }
         log.Printf("Site %s initialisé.", site.Name)
     }
+    proxy.RetainCacheZones(cacheZones)
+    metrics.RecordReload(initErr)
 
     go LaunchHttpsServers()
 
@@ -285,19 +343,26 @@ func StartMainListener() {
         }
 
         if site != nil {
-            if site.Config.UseLetsEncrypt {
+            if r.ProtoMajor == 2 && !site.Config.H2C {
+                http.Error(w, "h2c non activé pour ce site", http.StatusMisdirectedRequest)
+                return
+            }
+            if site.Config.UseLetsEncrypt && acmeActive(host) {
                 target := "https://" + host + r.URL.RequestURI()
                 http.Redirect(w, r, target, http.StatusMovedPermanently)
                 return
             }
-            site.Router.ServeHTTP(w, r)
+            site.Handler.ServeHTTP(w, r)
         } else {
             http.NotFound(w, r)
         }
     })
 
     finalHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        if r.URL.Path == "/.well-known/acme-challenge/" || strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+        if strings.HasPrefix(r.URL.Path, acmeChallengePrefix) {
+            if servePreflight(w, r) {
+                return
+            }
             host := r.Host
             if strings.Contains(host, ":") {
                 host = strings.Split(host, ":")[0]
@@ -313,123 +378,25 @@ func StartMainListener() {
         mux.ServeHTTP(w, r)
     })
 
+    // h2c est accepté ou refusé connexion par connexion, voir listenerOptions.
+    var protocols http.Protocols
+    protocols.SetHTTP1(true)
+    protocols.SetUnencryptedHTTP2(true)
     srv := &http.Server{
-        Addr:    ":80",
-        Handler: finalHandler,
+        Addr:      ":80",
+        Handler:   finalHandler,
+        ConnState: metrics.ConnState(":80"),
+        Protocols: &protocols,
     }
 
-    log.Println("Serveur principal (multi-site) lancé sur port 80")
-    if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+    ln, err := listen("80")
+    if err != nil {
         log.Fatalf("Serveur principal erreur: %v", err)
     }
-}
-
-func LaunchHttpsServers() {
-    sitesMu.Lock()
-    defer sitesMu.Unlock()
-
-    hasLetsEncrypt := false
-    hasManualSSL := false
-
-    for _, site := range sites {
-        if site.Config.UseLetsEncrypt {
-            hasLetsEncrypt = true
-        } else if site.Config.SSLEnabled {
-            hasManualSSL = true
-        }
-    }
-
-    if !hasLetsEncrypt && !hasManualSSL {
-        log.Println("Aucun site SSL actif, serveur HTTPS non lancé")
-        return
-    }
-
-    httpsServerMu.Lock()
-    defer httpsServerMu.Unlock()
-
-    if httpsServer != nil {
-        log.Println("Serveur HTTPS déjà actif, skip lancement")
-        return
-    }
-
-    if hasLetsEncrypt {
-        hosts := []string{}
-        for _, site := range sites {
-            if site.Config.UseLetsEncrypt {
-                hosts = append(hosts, site.Config.ServerName)
-            }
-        }
-        m := &autocert.Manager{
-            Cache:      autocert.DirCache("/etc/goinx/certs-cache"),
-            Prompt:     autocert.AcceptTOS,
-            HostPolicy: autocert.HostWhitelist(hosts...),
-        }
-
-        tlsConfig := &tls.Config{
-            GetCertificate: m.GetCertificate,
-            NextProtos:     []string{"h2", "http/1.1", "acme-tls/1"},
-        }
-
-        autocertMgrsMu.Lock()
-        for _, host := range hosts {
-            autocertMgrs[host] = m
-        }
-        autocertMgrsMu.Unlock()
-
-        httpsServer = &http.Server{
-            Addr:      ":443",
-            TLSConfig: tlsConfig,
-            Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-                host := r.Host
-                if strings.Contains(host, ":") {
-                    host = strings.Split(host, ":")[0]
-                }
-                sitesMu.Lock()
-                site, exists := sites[host]
-                sitesMu.Unlock()
-                if exists {
-                    site.Router.ServeHTTP(w, r)
-                } else {
-                    http.NotFound(w, r)
-                }
-            }),
-        }
-
-        go func() {
-            log.Println("Serveur HTTPS auto (Let's Encrypt) lancé sur port 443")
-            if err := httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
-                log.Printf("Erreur serveur HTTPS auto : %v", err)
-            }
-        }()
-        return
-    }
-
-    // SSL manuel : lancement serveur HTTPS par site manuel
-    for _, site := range sites {
-        if site.Config.SSLEnabled && !site.Config.UseLetsEncrypt {
-            if !fileExists(site.Config.SSLCertFile) || !fileExists(site.Config.SSLKeyFile) {
-                log.Printf("Certificat ou clé ssl introuvable pour site %s", site.Config.ServerName)
-                continue
-            }
-            listenPort := site.Config.Listen
-            if listenPort == "" {
-                listenPort = "443"
-            }
-            listenAddr := ":" + listenPort
-            srv := &http.Server{
-                Addr:    listenAddr,
-                Handler: site.Router,
-                TLSConfig: &tls.Config{
-                    MinVersion: tls.VersionTLS12,
-                },
-            }
-            go func(srv *http.Server, siteName, certFile, keyFile string) {
-                log.Printf("Serveur SSL manuel pour %s sur port %s", siteName, listenAddr)
-                if err := srv.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
-                    log.Printf("Erreur SSL manuel %s : %v", siteName, err)
-                }
-            }(srv, site.Config.ServerName, site.Config.SSLCertFile, site.Config.SSLKeyFile)
-        }
+    markMainListenerReady()
+    log.Println("Serveur principal (multi-site) lancé sur port 80")
+    if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+        log.Fatalf("Serveur principal erreur: %v", err)
     }
 }
 
@@ -461,4 +428,121 @@ func IsServerRunning(siteName string) bool {
     defer activeServersMu.Unlock()
     s, ok := activeServers[siteName]
     return ok && s.running
-}
\ No newline at end of file
+}
+
+// locations convertit les blocs location du site. try_files au niveau du site
+// et vuejs_rewrite deviennent des locations implicites, sauf si un bloc
+// explicite couvre déjà le même préfixe.
+func locations(cfg SiteConfig) []server.Location {
+    var list []server.Location
+    defined := make(map[string]bool)
+    for _, loc := range cfg.Locations {
+        list = append(list, server.Location{
+            Prefix:   loc.Prefix,
+            Root:     loc.Root,
+            TryFiles: loc.TryFiles,
+            Rewrites: rewriteRules(loc.Rewrites),
+
+            AddHeaders:    responseHeaders(loc.AddHeaders),
+            RemoveHeaders: loc.RemoveHeaders,
+            Cors:          corsPolicy(loc.Cors),
+            VerifyClient:  loc.VerifyClient,
+        })
+        defined[strings.TrimSuffix(loc.Prefix, "/")] = true
+    }
+    if len(cfg.TryFiles) > 0 && !defined[""] {
+        list = append(list, server.Location{Prefix: "/", TryFiles: cfg.TryFiles})
+        defined[""] = true
+    }
+    if cfg.VuejsRewrite.Path != "" && cfg.VuejsRewrite.Fallback != "" && !defined[strings.TrimSuffix(cfg.VuejsRewrite.Path, "/")] {
+        list = append(list, server.Location{
+            Prefix:   cfg.VuejsRewrite.Path,
+            TryFiles: []string{"$uri", "$uri/", "/" + strings.TrimPrefix(cfg.VuejsRewrite.Fallback, "/")},
+        })
+    }
+    return list
+}
+
+// rewriteRules compile les rewrite/return, déjà validés par le parser.
+func rewriteRules(directives []RewriteDirective) []server.RewriteRule {
+    rules := make([]server.RewriteRule, 0, len(directives))
+    for _, d := range directives {
+        rule := server.RewriteRule{Replacement: d.Replacement, Flag: d.Flag, Code: d.Code}
+        if d.Pattern != "" {
+            rule.Pattern = regexp.MustCompile(d.Pattern)
+        }
+        rules = append(rules, rule)
+    }
+    return rules
+}
+
+func headerOptions(cfg SiteConfig, locations []server.Location) server.HeaderOptions {
+    return server.HeaderOptions{
+        Add:       responseHeaders(cfg.AddHeaders),
+        Remove:    cfg.RemoveHeaders,
+        Security:  cfg.SecurityHeaders,
+        Locations: locations,
+    }
+}
+
+func responseHeaders(headers []ResponseHeader) []server.HeaderRule {
+    rules := make([]server.HeaderRule, 0, len(headers))
+    for _, h := range headers {
+        rules = append(rules, server.HeaderRule{Name: h.Name, Value: h.Value, Always: h.Always})
+    }
+    return rules
+}
+
+func corsPolicy(cors *CorsConfig) *server.CorsPolicy {
+    if cors == nil {
+        return nil
+    }
+    return &server.CorsPolicy{
+        Origins:     cors.AllowOrigins,
+        Methods:     cors.AllowMethods,
+        Headers:     cors.AllowHeaders,
+        Expose:      cors.ExposeHeaders,
+        Credentials: cors.AllowCredentials,
+        MaxAge:      cors.MaxAge,
+    }
+}
+
+// withAccessLog ajoute le log d'accès du site, ou à défaut celui de
+// goinx.conf. Un log impossible à ouvrir n'empêche pas le site de démarrer.
+func withAccessLog(cfg SiteConfig, next http.Handler) http.Handler {
+    global := currentGlobalConfig()
+    conf := cfg.AccessLog
+    if conf == nil {
+        conf = global.AccessLog
+    }
+    if conf == nil || conf.Off {
+        return next
+    }
+
+    formats := make(map[string]string)
+    for name, template := range global.LogFormats {
+        formats[name] = template
+    }
+    for name, template := range cfg.LogFormats {
+        formats[name] = template
+    }
+    format, err := accesslog.Lookup(conf.Format, formats)
+    if err != nil {
+        log.Printf("Log d'accès désactivé pour site %s : %v", cfg.ServerName, err)
+        return next
+    }
+
+    logger, err := accesslog.Open(accesslog.Options{
+        Path:       conf.Path,
+        Buffer:     conf.Buffer,
+        Flush:      conf.Flush,
+        RotateSize: conf.RotateSize,
+        RotateTime: conf.RotateTime,
+        Keep:       conf.Keep,
+    })
+    if err != nil {
+        log.Printf("Log d'accès désactivé pour site %s : %v", cfg.ServerName, err)
+        return next
+    }
+    return accesslog.Handler(logger, format, cfg.ServerName, next)
+}
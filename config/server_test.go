@@ -0,0 +1,89 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OxiWanV2/Goinx/server"
+	"github.com/gin-gonic/gin"
+)
+
+// parseTestConf écrit content dans un fichier de site et le lit.
+func parseTestConf(t *testing.T, content string) SiteConfig {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "site.conf")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseConf(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestVuejsRewriteLocations(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":       "spa",
+		"app.js":           "app",
+		"admin/index.html": "admin",
+	} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(file), 0o755)
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := parseTestConf(t, `server_name exemple.com
+vuejs_rewrite / index.html
+location /admin {
+    try_files $uri $uri/ /admin/index.html
+}
+`)
+
+	list := locations(cfg)
+	if len(list) != 2 || list[1].Prefix != "/" {
+		t.Fatalf("locations : %+v, attendu /admin puis / implicite", list)
+	}
+	if got := list[1].TryFiles; len(got) != 3 || got[0] != "$uri" || got[1] != "$uri/" || got[2] != "/index.html" {
+		t.Errorf("try_files implicite de vuejs_rewrite : %v", got)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(server.Static(server.StaticOptions{Root: root, Locations: list}))
+	tests := []struct {
+		target string
+		status int
+		body   string
+	}{
+		{"/app.js", http.StatusOK, "app"},
+		{"/users/42", http.StatusOK, "spa"},
+		{"/missing.js", http.StatusNotFound, ""},
+		{"/admin/users", http.StatusOK, "admin"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.status || (tt.body != "" && rec.Body.String() != tt.body) {
+			t.Errorf("%s : %d %q, attendu %d %q", tt.target, rec.Code, rec.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestVuejsRewriteYieldsToExplicitLocation(t *testing.T) {
+	cfg := parseTestConf(t, `server_name exemple.com
+vuejs_rewrite / index.html
+location / {
+    try_files $uri =404
+}
+`)
+	list := locations(cfg)
+	if len(list) != 1 || len(list[0].TryFiles) != 2 {
+		t.Errorf("locations : %+v, attendu la seule location explicite", list)
+	}
+}
@@ -0,0 +1,371 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OxiWanV2/Goinx/certstore"
+)
+
+const (
+	minTicketRotation = time.Minute
+	ticketKeysKept    = 3 // Clé courante et deux précédentes, encore acceptées
+)
+
+// TLSPolicyConfig regroupe tls_profile et les directives ssl_* de politique
+// TLS. Dans un site, les champs vides reprennent ceux de goinx.conf.
+type TLSPolicyConfig struct {
+	Profile        string // tls_profile modern|intermediate
+	MinVersion     uint16 // ssl_protocols TLSv1.2 TLSv1.3
+	MaxVersion     uint16
+	CipherSuites   []uint16      // ssl_ciphers, TLS 1.2 uniquement
+	Curves         []tls.CurveID // ssl_ecdh_curve X25519:P-256
+	ALPN           []string      // ssl_alpn h2 http/1.1
+	SessionTickets *bool         // ssl_session_tickets on|off
+	TicketRotation time.Duration // ssl_session_ticket_rotation <durée>, 0 = rotation de Go
+	Stapling       *bool         // ssl_stapling on|off
+}
+
+var tlsVersions = map[string]uint16{
+	"tlsv1":   tls.VersionTLS10,
+	"tlsv1.0": tls.VersionTLS10,
+	"tlsv1.1": tls.VersionTLS11,
+	"tlsv1.2": tls.VersionTLS12,
+	"tlsv1.3": tls.VersionTLS13,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"x25519mlkem768": tls.X25519MLKEM768,
+	"x25519":         tls.X25519,
+	"p-256":          tls.CurveP256,
+	"prime256v1":     tls.CurveP256,
+	"secp256r1":      tls.CurveP256,
+	"p-384":          tls.CurveP384,
+	"secp384r1":      tls.CurveP384,
+	"p-521":          tls.CurveP521,
+	"secp521r1":      tls.CurveP521,
+}
+
+// Noms OpenSSL des suites courantes, acceptés en plus des noms IANA.
+var opensslCiphers = map[string]string{
+	"ECDHE-ECDSA-AES128-GCM-SHA256": "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE-RSA-AES128-GCM-SHA256":   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	"ECDHE-ECDSA-AES256-GCM-SHA384": "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE-RSA-AES256-GCM-SHA384":   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	"ECDHE-ECDSA-CHACHA20-POLY1305": "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	"ECDHE-RSA-CHACHA20-POLY1305":   "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+// Profils d'après les recommandations TLS de Mozilla.
+var tlsProfiles = map[string]tlsPolicy{
+	"modern": {
+		minVersion: tls.VersionTLS13,
+		curves:     []tls.CurveID{tls.X25519MLKEM768, tls.X25519, tls.CurveP256, tls.CurveP384},
+	},
+	"intermediate": {
+		minVersion: tls.VersionTLS12,
+		ciphers: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		curves: []tls.CurveID{tls.X25519MLKEM768, tls.X25519, tls.CurveP256, tls.CurveP384},
+	},
+}
+
+// parseTLSPolicy lit les directives de politique TLS, communes à goinx.conf
+// et aux sites.
+func parseTLSPolicy(conf *TLSPolicyConfig, parts []string) error {
+	switch parts[0] {
+	case "tls_profile":
+		if len(parts) != 2 {
+			return fmt.Errorf("syntaxe attendue : tls_profile modern|intermediate")
+		}
+		if _, ok := tlsProfiles[parts[1]]; !ok {
+			return fmt.Errorf("tls_profile inconnu : %s (modern ou intermediate)", parts[1])
+		}
+		conf.Profile = parts[1]
+	case "ssl_protocols":
+		if len(parts) < 2 {
+			return fmt.Errorf("syntaxe attendue : ssl_protocols TLSv1.2 TLSv1.3")
+		}
+		var versions []uint16
+		for _, name := range parts[1:] {
+			version, ok := tlsVersions[strings.ToLower(name)]
+			if !ok {
+				return fmt.Errorf("version TLS inconnue : %s", name)
+			}
+			versions = append(versions, version)
+		}
+		slices.Sort(versions)
+		versions = slices.Compact(versions)
+		if int(versions[len(versions)-1]-versions[0]) != len(versions)-1 {
+			return fmt.Errorf("ssl_protocols : les versions doivent se suivre (%s)", strings.Join(parts[1:], " "))
+		}
+		conf.MinVersion, conf.MaxVersion = versions[0], versions[len(versions)-1]
+	case "ssl_ciphers":
+		if len(parts) < 2 {
+			return fmt.Errorf("syntaxe attendue : ssl_ciphers <suite>[:<suite>...]")
+		}
+		ciphers, err := parseCipherSuites(strings.Join(parts[1:], ":"))
+		if err != nil {
+			return err
+		}
+		conf.CipherSuites = ciphers
+	case "ssl_ecdh_curve":
+		if len(parts) < 2 {
+			return fmt.Errorf("syntaxe attendue : ssl_ecdh_curve X25519:P-256")
+		}
+		var curves []tls.CurveID
+		for _, name := range strings.FieldsFunc(strings.Join(parts[1:], ":"), isListSeparator) {
+			curve, ok := tlsCurves[strings.ToLower(name)]
+			if !ok {
+				return fmt.Errorf("courbe inconnue : %s", name)
+			}
+			curves = append(curves, curve)
+		}
+		conf.Curves = curves
+	case "ssl_alpn":
+		if len(parts) < 2 {
+			return fmt.Errorf("syntaxe attendue : ssl_alpn h2 http/1.1")
+		}
+		for _, proto := range parts[1:] {
+			if proto != "h2" && proto != "http/1.1" {
+				return fmt.Errorf("protocole ALPN non supporté : %s (h2 ou http/1.1)", proto)
+			}
+		}
+		conf.ALPN = parts[1:]
+	case "ssl_session_tickets":
+		if len(parts) != 2 {
+			return fmt.Errorf("syntaxe attendue : ssl_session_tickets on|off")
+		}
+		tickets := parseSwitch(parts[1])
+		conf.SessionTickets = &tickets
+	case "ssl_session_ticket_rotation":
+		if len(parts) != 2 {
+			return fmt.Errorf("syntaxe attendue : ssl_session_ticket_rotation <durée>")
+		}
+		d, ok := parseDuration(parts[1])
+		if !ok || d < minTicketRotation {
+			return fmt.Errorf("ssl_session_ticket_rotation invalide : %s (1m minimum)", parts[1])
+		}
+		conf.TicketRotation = d
+	case "ssl_stapling":
+		if len(parts) != 2 {
+			return fmt.Errorf("syntaxe attendue : ssl_stapling on|off")
+		}
+		stapling := parseSwitch(parts[1])
+		conf.Stapling = &stapling
+	}
+	return nil
+}
+
+func isListSeparator(r rune) bool {
+	return r == ':' || r == ','
+}
+
+func parseCipherSuites(list string) ([]uint16, error) {
+	known := make(map[string]*tls.CipherSuite)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	var ids []uint16
+	for _, name := range strings.FieldsFunc(list, isListSeparator) {
+		if iana, ok := opensslCiphers[name]; ok {
+			name = iana
+		}
+		suite, ok := known[name]
+		switch {
+		case insecure[name]:
+			return nil, fmt.Errorf("suite %s non sûre, refusée", name)
+		case !ok:
+			return nil, fmt.Errorf("suite inconnue : %s", name)
+		case !slices.Contains(suite.SupportedVersions, tls.VersionTLS12):
+			return nil, fmt.Errorf("suite %s : les suites TLS 1.3 ne sont pas configurables", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+// tlsPolicy est la politique effective d'un site, appliquée à chaque poignée
+// de main.
+type tlsPolicy struct {
+	minVersion uint16
+	maxVersion uint16
+	ciphers    []uint16
+	curves     []tls.CurveID
+	alpn       []string
+	tickets    bool
+	ticketKeys *ticketKeys // nil = rotation automatique de Go
+	stapling   bool
+}
+
+// resolve applique à p les champs renseignés de conf, profil d'abord. Un
+// profil fixe versions, suites et courbes, sans toucher ALPN, tickets ni
+// agrafage OCSP.
+func (p tlsPolicy) resolve(conf TLSPolicyConfig) tlsPolicy {
+	if profile, ok := tlsProfiles[conf.Profile]; ok {
+		p.minVersion, p.maxVersion = profile.minVersion, profile.maxVersion
+		p.ciphers, p.curves = profile.ciphers, profile.curves
+	}
+	if conf.MinVersion != 0 {
+		p.minVersion, p.maxVersion = conf.MinVersion, conf.MaxVersion
+	}
+	if conf.CipherSuites != nil {
+		p.ciphers = conf.CipherSuites
+	}
+	if conf.Curves != nil {
+		p.curves = conf.Curves
+	}
+	if conf.ALPN != nil {
+		p.alpn = conf.ALPN
+	}
+	if conf.SessionTickets != nil {
+		p.tickets = *conf.SessionTickets
+	}
+	if conf.Stapling != nil {
+		p.stapling = *conf.Stapling
+	}
+	return p
+}
+
+var defaultTLSPolicy = tlsPolicy{minVersion: tls.VersionTLS12, tickets: true}
+
+// globalTLSPolicy est la politique de goinx.conf, pour les noms sans site.
+func globalTLSPolicy() *tlsPolicy {
+	conf := currentGlobalConfig().TLS
+	p := defaultTLSPolicy.resolve(conf)
+	p.ticketKeys = ticketKeysFor("", conf.TicketRotation)
+	return &p
+}
+
+// siteTLSPolicy : site, puis goinx.conf, puis défauts de Goinx.
+func siteTLSPolicy(cfg SiteConfig) *tlsPolicy {
+	global := currentGlobalConfig().TLS
+	p := defaultTLSPolicy.resolve(global).resolve(cfg.TLS)
+	rotation := global.TicketRotation
+	if cfg.TLS.TicketRotation != 0 {
+		rotation = cfg.TLS.TicketRotation
+	}
+	p.ticketKeys = ticketKeysFor(cfg.ServerName, rotation)
+	return &p
+}
+
+// apply règle conf, clone de la config du port, selon la politique.
+func (p *tlsPolicy) apply(conf *tls.Config) {
+	if p.minVersion != 0 {
+		conf.MinVersion = p.minVersion
+	}
+	conf.MaxVersion = p.maxVersion
+	conf.CipherSuites = p.ciphers
+	conf.CurvePreferences = p.curves
+	if p.alpn != nil {
+		acme := slices.Contains(conf.NextProtos, "acme-tls/1")
+		conf.NextProtos = slices.Clone(p.alpn)
+		if acme {
+			conf.NextProtos = append(conf.NextProtos, "acme-tls/1")
+		}
+	}
+	conf.SessionTicketsDisabled = !p.tickets
+	if p.tickets && p.ticketKeys != nil {
+		conf.SetSessionTicketKeys(p.ticketKeys.current())
+	}
+	if p.stapling {
+		get := conf.GetCertificate
+		conf.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := get(hello)
+			if err != nil {
+				return nil, err
+			}
+			return ocspStapler.Staple(cert), nil
+		}
+	}
+}
+
+var ocspStapler = certstore.NewOCSPCache()
+
+// ticketKeys fait tourner les clés de tickets de session d'un site ; les
+// clés précédentes restent acceptées pour reprendre les sessions récentes.
+type ticketKeys struct {
+	mu       sync.Mutex
+	interval time.Duration
+	keys     [][32]byte
+	rotated  time.Time
+}
+
+var (
+	ticketKeysMu sync.Mutex
+	ticketKeySet = make(map[string]*ticketKeys) // Par server_name, "" pour goinx.conf
+)
+
+// ticketKeysFor garde les clés d'un site d'un reload à l'autre.
+func ticketKeysFor(name string, interval time.Duration) *ticketKeys {
+	if interval == 0 {
+		return nil
+	}
+	ticketKeysMu.Lock()
+	defer ticketKeysMu.Unlock()
+	keys, ok := ticketKeySet[name]
+	if !ok {
+		keys = &ticketKeys{}
+		ticketKeySet[name] = keys
+	}
+	keys.mu.Lock()
+	keys.interval = interval
+	keys.mu.Unlock()
+	return keys
+}
+
+func (k *ticketKeys) current() [][32]byte {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.keys) == 0 || time.Since(k.rotated) >= k.interval {
+		var key [32]byte
+		rand.Read(key[:])
+		k.keys = append([][32]byte{key}, k.keys...)
+		if len(k.keys) > ticketKeysKept {
+			k.keys = k.keys[:ticketKeysKept]
+		}
+		k.rotated = time.Now()
+	}
+	return slices.Clone(k.keys)
+}
+
+// siteTLSConfig choisit par SNI la config TLS du site : politique TLS et,
+// pour les sites mTLS, demande du certificat client. Celui-ci est vérifié
+// par server.ClientAuth : un certificat refusé reçoit la page 495 du site
+// plutôt qu'une erreur TLS.
+func siteTLSConfig(base *tls.Config, defaultHost string) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		site := siteForHost(hello.ServerName)
+		if site == nil {
+			site = siteForHost(defaultHost)
+		}
+		conf := base.Clone()
+		conf.GetConfigForClient = nil
+		if site == nil || site.TLS == nil {
+			globalTLSPolicy().apply(conf)
+			return conf, nil
+		}
+		site.TLS.apply(conf)
+		if site.ClientCAs != nil {
+			conf.ClientAuth = tls.RequestClientCert
+			conf.ClientCAs = site.ClientCAs
+		}
+		return conf, nil
+	}
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"crypto/tls"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTLSPolicy(t *testing.T) {
+	tests := []struct {
+		directive string
+		ok        bool
+	}{
+		{"tls_profile modern", true},
+		{"tls_profile old", false},
+		{"ssl_protocols TLSv1.2 TLSv1.3", true},
+		{"ssl_protocols TLSv1.1 TLSv1.3", false}, // Versions non consécutives
+		{"ssl_protocols SSLv3", false},
+		{"ssl_ciphers ECDHE-RSA-AES128-GCM-SHA256:TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", true},
+		{"ssl_ciphers TLS_RSA_WITH_RC4_128_SHA", false}, // Non sûre
+		{"ssl_ciphers TLS_AES_128_GCM_SHA256", false},   // TLS 1.3
+		{"ssl_ciphers AES-INCONNUE", false},
+		{"ssl_ecdh_curve X25519:prime256v1", true},
+		{"ssl_ecdh_curve brainpool", false},
+		{"ssl_alpn h2 http/1.1", true},
+		{"ssl_alpn h3", false},
+		{"ssl_session_ticket_rotation 12h", true},
+		{"ssl_session_ticket_rotation 30s", false},
+		{"ssl_stapling on", true},
+		{"ssl_stapling", false},
+	}
+	for _, tt := range tests {
+		var conf TLSPolicyConfig
+		if err := parseTLSPolicy(&conf, strings.Fields(tt.directive)); (err == nil) != tt.ok {
+			t.Errorf("%q : erreur %v", tt.directive, err)
+		}
+	}
+
+	var conf TLSPolicyConfig
+	parseTLSPolicy(&conf, strings.Fields("ssl_protocols TLSv1.3 TLSv1.2"))
+	if conf.MinVersion != tls.VersionTLS12 || conf.MaxVersion != tls.VersionTLS13 {
+		t.Errorf("ssl_protocols : %x..%x", conf.MinVersion, conf.MaxVersion)
+	}
+}
+
+func TestTLSPolicyResolve(t *testing.T) {
+	off := false
+	global := TLSPolicyConfig{Profile: "intermediate", ALPN: []string{"http/1.1"}, SessionTickets: &off}
+	site := TLSPolicyConfig{Profile: "modern", Curves: []tls.CurveID{tls.X25519}}
+
+	p := defaultTLSPolicy.resolve(global)
+	if p.minVersion != tls.VersionTLS12 || len(p.ciphers) == 0 || p.tickets {
+		t.Errorf("politique globale %+v", p)
+	}
+	p = p.resolve(site)
+	switch {
+	case p.minVersion != tls.VersionTLS13:
+		t.Errorf("profil du site ignoré : version min %x", p.minVersion)
+	case p.ciphers != nil:
+		t.Errorf("suites TLS 1.2 héritées d'intermediate : %v", p.ciphers)
+	case !slices.Equal(p.curves, []tls.CurveID{tls.X25519}):
+		t.Errorf("ssl_ecdh_curve du site ignoré : %v", p.curves)
+	case !slices.Equal(p.alpn, []string{"http/1.1"}) || p.tickets:
+		t.Error("ALPN et tickets de goinx.conf non hérités")
+	}
+}
+
+func TestTLSPolicyApply(t *testing.T) {
+	cert := &tls.Certificate{}
+	base := &tls.Config{
+		NextProtos:     []string{"h2", "http/1.1", "acme-tls/1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return cert, nil },
+	}
+	p := tlsPolicy{minVersion: tls.VersionTLS13, alpn: []string{"http/1.1"}, stapling: true}
+
+	conf := base.Clone()
+	p.apply(conf)
+	if conf.MinVersion != tls.VersionTLS13 || !conf.SessionTicketsDisabled {
+		t.Errorf("version %x, tickets désactivés %v", conf.MinVersion, conf.SessionTicketsDisabled)
+	}
+	if !slices.Equal(conf.NextProtos, []string{"http/1.1", "acme-tls/1"}) {
+		t.Errorf("ALPN %v, acme-tls/1 doit être conservé", conf.NextProtos)
+	}
+	if !slices.Equal(base.NextProtos, []string{"h2", "http/1.1", "acme-tls/1"}) {
+		t.Error("config du port modifiée")
+	}
+	// Sans répondeur OCSP, le certificat est servi tel quel.
+	if got, err := conf.GetCertificate(&tls.ClientHelloInfo{}); got != cert || err != nil {
+		t.Errorf("GetCertificate agrafé : %v, %v", got, err)
+	}
+}
+
+func TestTicketKeysRotation(t *testing.T) {
+	k := &ticketKeys{interval: time.Hour}
+	first := k.current()
+	if len(first) != 1 || !slices.Equal(k.current(), first) {
+		t.Fatal("clé renouvelée avant l'intervalle")
+	}
+	for want := 2; want <= ticketKeysKept+1; want++ {
+		k.rotated = time.Now().Add(-2 * time.Hour)
+		keys := k.current()
+		if len(keys) != min(want, ticketKeysKept) {
+			t.Fatalf("%d clés, attendu %d", len(keys), min(want, ticketKeysKept))
+		}
+		if keys[0] == first[0] || (want <= ticketKeysKept && keys[want-1] != first[0]) {
+			t.Errorf("rotation %d : clé courante ou ancienne clé incorrecte", want)
+		}
+	}
+	if ticketKeysFor("exemple.com", 0) != nil {
+		t.Error("clés gérées sans ssl_session_ticket_rotation")
+	}
+	if ticketKeysFor("exemple.com", time.Hour) != ticketKeysFor("exemple.com", 2*time.Hour) {
+		t.Error("clés non conservées d'un reload à l'autre")
+	}
+}
@@ -1,19 +1,125 @@
 package config
 
+import "time"
+
 type SiteConfig struct {
     ServerName   string       // Nom de domaine ou IP
     Listen       string       // Port d’écoute (exemple "80")
+    DefaultServer bool        // listen <port> default_server : site et certificat par défaut du port
     Root         string       // Chemin vers fichiers statiques
     VuejsRewrite VuejsRewrite // Config rewrite VueJS
 	ErrorPagesDir string // Directive pour les pages d'erreur custom
 	SSLEnabled   bool // Permet d'activer ou non le SSL
 	UseLetsEncrypt bool // Permet d'utiliser letsencrypt
+    SSLMode      string // ssl_mode local : certificats émis par la CA locale de Goinx
+    SSLClientCertificate string // CA des certificats clients (mTLS)
+    SSLVerifyClient      string // "on" ou "optional", vide = pas de certificat client
+    SSLCRL               string // Liste de révocation des certificats clients
     SSLCertFile  string // Fichier de certificat SSL
     SSLKeyFile   string // Fichier de clef SSL
+    ACME         ACMEConfig // acme_* propres au site, sinon ceux de goinx.conf
+    TLS          TLSPolicyConfig // tls_profile et ssl_* de politique TLS, sinon ceux de goinx.conf
+    HTTP3        bool // http3 on : HTTP/3 (QUIC) sur le port HTTPS du site
+    H2C          bool // h2c on : HTTP/2 en clair sur :80, derrière un load balancer
+    ProxyProtocol     bool     // proxy_protocol on : en-tête PROXY v1/v2 attendu des sources de confiance
+    ProxyProtocolFrom []string // proxy_protocol_from : IP/CIDR des load balancers
     BackendRoute string
     Backend       string // Path vers le backend
     BackendFile   string // Nom du fichier principal du backend
     BackendInternalPort int // Port pointer par le backend
+    ProxyStreamReadTimeout time.Duration // Attente max de la réponse backend à un upgrade WebSocket
+    ProxyStreamIdleTimeout time.Duration // Inactivité max d'une WebSocket ou d'un flux SSE
+    ProxyFlushInterval     time.Duration // Intervalle de flush des réponses proxifiées (-1 = immédiat)
+    ProxyKeepAliveInterval time.Duration // Intervalle des keepalive TCP et des pings SSE
+    ProxyDrainTimeout      time.Duration // Délai laissé aux WebSocket lors d'un reload
+    ProxySetHeaders  []HeaderDirective // En-têtes ajoutés aux requêtes vers le backend
+    ProxyHideHeaders []string          // En-têtes du backend retirés des réponses
+    ProxyRedirect    string            // "default" ou "off"
+    ProxyRedirects   []PathRewrite     // Réécritures explicites des en-têtes Location
+    ProxyCookiePaths []PathRewrite     // Réécritures du Path des cookies du backend
+    RealIPFrom       []string          // Proxys de confiance pour les en-têtes X-Forwarded-*
+    ProxyConnectTimeout   time.Duration // Délai max de connexion au backend
+    ProxyReadTimeout      time.Duration // Attente max de la réponse du backend (et entre deux lectures)
+    ProxyRetries          int           // Retries sur erreur de connexion, -1 = désactivé
+    ProxyRetryBudget      int           // Pourcentage max de requêtes rejouées
+    ProxyBreakerThreshold int           // Échecs consécutifs avant ouverture du circuit
+    ProxyBreakerCooldown  time.Duration // Durée d'ouverture du circuit
+    ProxyCache          string        // Zone de cache des réponses du backend ("" = désactivé)
+    ProxyCachePath      string        // Dossier disque de la zone (défaut /var/cache/goinx/<zone>)
+    ProxyCacheKey       string        // Modèle de clef de cache
+    ProxyCacheValid     time.Duration // Fraîcheur par défaut sans Cache-Control/Expires
+    ProxyCacheStale     time.Duration // Service d'une copie périmée sur erreur ou pendant la revalidation
+    ProxyCacheMaxSize   int64         // Taille max de la zone en mémoire
+    ProxyCacheMaxObject int64         // Taille max d'une réponse cachée
+    StaticCacheRules []StaticCacheRule // Directives expires/cache_control, dans l'ordre du fichier
+    ImmutableAssets  bool              // Cache immuable pour les assets hashés (défaut : activé)
+    Precompressed    bool              // Sert les variantes .br/.gz (défaut : activé)
+    AllowHidden      bool              // Sert les fichiers commençant par "." (défaut : refusés)
+    DisableSymlinks  string            // "off" (défaut), "on" ou "if_not_owner"
+    TryFiles         []string          // try_files au niveau du site
+    Locations        []Location        // Blocs location, dans l'ordre du fichier
+    Rewrites         []RewriteDirective // rewrite/return au niveau du site, dans l'ordre du fichier
+    RedirectsFile    string             // Fichier de redirections "<chemin> <destination> [code]"
+    AddHeaders       []ResponseHeader   // add_header
+    RemoveHeaders    []string           // remove_header (ex: X-Powered-By)
+    SecurityHeaders  string             // Préréglage security_headers : "strict" ou "" (aucun)
+    Cors             *CorsConfig        // Bloc cors du site
+    AccessLog        *AccessLogConfig   // access_log du site, nil = celui de goinx.conf
+    LogFormats       map[string]string  // log_format déclarés dans le site
+    Compression          bool     // Compression gzip/br/zstd à la volée
+    CompressionTypes     []string // Types MIME compressés (défaut : texte, JSON, JS, SVG...)
+    CompressionMinLength int      // Taille minimale d'une réponse compressée
+    CompressionLevel     int      // Niveau de compression 1-9
+}
+
+type StaticCacheRule struct {
+    Pattern      string // Exemple : "*.js" ou "/assets/*"
+    Expires      string // Valeur de expires : durée, "off", "epoch" ou "max"
+    CacheControl string // Valeur de cache_control
+}
+
+type HeaderDirective struct {
+    Name  string
+    Value string
+}
+
+type PathRewrite struct {
+    From string
+    To   string
+}
+
+type Location struct {
+    Prefix   string   // Exemple : "/admin"
+    Root     string   // root propre à la location, vide = root du site
+    TryFiles []string // Exemple : ["$uri", "$uri/", "/admin/index.html"]
+    Rewrites []RewriteDirective
+    AddHeaders    []ResponseHeader
+    RemoveHeaders []string
+    Cors          *CorsConfig
+    VerifyClient  bool // ssl_verify_client on dans la location
+}
+
+type CorsConfig struct {
+    AllowOrigins     []string      // Exactes, jokers (https://*.exemple.com), regex (~^https://...$) ou *
+    AllowMethods     []string
+    AllowHeaders     []string
+    ExposeHeaders    []string
+    AllowCredentials bool
+    MaxAge           time.Duration
+}
+
+type ResponseHeader struct {
+    Name   string
+    Value  string // Peut contenir des variables, vide = suppression
+    Always bool   // Aussi sur les réponses d'erreur
+}
+
+// RewriteDirective est un rewrite (Pattern renseigné) ou un return (Code).
+type RewriteDirective struct {
+    Pattern     string // Regex sur l'URI
+    Replacement string // Nouvelle URI, URL de redirection ou texte du return
+    Flag        string // last, break, redirect, permanent
+    Code        int    // Code HTTP du return
 }
 
 type VuejsRewrite struct {
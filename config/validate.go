@@ -16,5 +16,21 @@ func ValidateConfigs(sites []SiteConfig) error {
         }
         seen[key] = true
     }
+
+    // Une zone de cache partagée n'a qu'un dossier et une taille.
+    zones := make(map[string]SiteConfig)
+    for _, site := range sites {
+        if site.ProxyCache == "" {
+            continue
+        }
+        first, ok := zones[site.ProxyCache]
+        if !ok {
+            zones[site.ProxyCache] = site
+            continue
+        }
+        if first.ProxyCachePath != site.ProxyCachePath || first.ProxyCacheMaxSize != site.ProxyCacheMaxSize {
+            return fmt.Errorf("conflit détecté : zone de cache %s définie différemment par %s et %s (proxy_cache_path, proxy_cache_max_size)", site.ProxyCache, first.ServerName, site.ServerName)
+        }
+    }
     return nil
 }
\ No newline at end of file
@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestValidateCacheZones(t *testing.T) {
+	site := func(name, zone, path string, size int64) SiteConfig {
+		return SiteConfig{ServerName: name, Listen: "80", ProxyCache: zone, ProxyCachePath: path, ProxyCacheMaxSize: size}
+	}
+	tests := []struct {
+		name  string
+		sites []SiteConfig
+		ok    bool
+	}{
+		{"zones distinctes", []SiteConfig{site("a.com", "a", "/tmp/a", 1), site("b.com", "b", "/tmp/b", 2)}, true},
+		{"zone partagée identique", []SiteConfig{site("a.com", "api", "/tmp/api", 1), site("b.com", "api", "/tmp/api", 1)}, true},
+		{"dossier différent", []SiteConfig{site("a.com", "api", "/tmp/a", 1), site("b.com", "api", "/tmp/b", 1)}, false},
+		{"taille différente", []SiteConfig{site("a.com", "api", "", 1), site("b.com", "api", "", 2)}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateConfigs(tt.sites); (err == nil) != tt.ok {
+			t.Errorf("%s : erreur %v", tt.name, err)
+		}
+	}
+}
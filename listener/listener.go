@@ -0,0 +1,200 @@
+// Package listener adapte les connexions acceptées par Goinx : décodage du
+// PROXY protocol (v1 et v2) envoyé par un load balancer de confiance, et
+// refus de HTTP/2 en clair (h2c) quand aucun site ne l'accepte.
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const headerTimeout = 5 * time.Second
+
+var (
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	h2Preface        = []byte("PRI ")
+
+	errH2CRefused = errors.New("HTTP/2 en clair (h2c) non activé")
+)
+
+// Options est lue à chaque connexion : un reload s'applique sans rouvrir le
+// port.
+type Options struct {
+	ProxyFrom []*net.IPNet // Sources qui doivent envoyer l'en-tête PROXY
+	RejectH2C bool         // Fermer les connexions ouvertes par la préface HTTP/2
+}
+
+type Listener struct {
+	net.Listener
+	options func() Options
+}
+
+// Wrap applique à ln les options renvoyées par options.
+func Wrap(ln net.Listener, options func() Options) *Listener {
+	return &Listener{Listener: ln, options: options}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	opts := l.options()
+	if len(opts.ProxyFrom) == 0 && !opts.RejectH2C {
+		return c, nil
+	}
+	return &Conn{Conn: c, opts: opts, remote: c.RemoteAddr()}, nil
+}
+
+// Conn lit l'en-tête PROXY au premier appel de Read ou RemoteAddr, dans la
+// goroutine de la connexion : Accept ne bloque jamais.
+type Conn struct {
+	net.Conn
+	opts   Options
+	once   sync.Once
+	r      *bufio.Reader
+	remote net.Addr
+	err    error
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		c.r = bufio.NewReader(c.Conn)
+		c.Conn.SetReadDeadline(time.Now().Add(headerTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		if trusted(c.opts.ProxyFrom, c.remote) {
+			addr, err := readHeader(c.r)
+			if err != nil {
+				c.err = fmt.Errorf("en-tête PROXY invalide depuis %s : %v", c.remote, err)
+				log.Print(c.err)
+				return
+			}
+			if addr != nil {
+				c.remote = addr
+			}
+		}
+		if c.opts.RejectH2C {
+			if start, err := c.r.Peek(len(h2Preface)); err == nil && bytes.Equal(start, h2Preface) {
+				c.err = errH2CRefused
+			}
+		}
+	})
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr renvoie l'adresse du client annoncée par le load balancer.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remote
+}
+
+func trusted(nets []*net.IPNet, addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// readHeader lit un en-tête PROXY v1 ou v2 ; nil pour UNKNOWN ou LOCAL
+// (contrôle de santé du load balancer), l'adresse réelle est alors gardée.
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	start, err := r.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(start, proxyV2Signature) {
+		return readV2(r)
+	}
+	if start, err := r.Peek(6); err != nil || string(start) != "PROXY " {
+		return nil, fmt.Errorf("en-tête absent")
+	}
+	return readV1(r)
+}
+
+// readV1 lit "PROXY TCP4 <src> <dst> <port src> <port dst>\r\n".
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 { // Longueur maximale de la spécification
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	text, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, fmt.Errorf("ligne v1 non terminée")
+	}
+	fields := strings.Fields(text)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("ligne v1 invalide : %q", text)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("adresse v1 invalide : %q", text)
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	version, command := header[12]>>4, header[12]&0x0f
+	if version != 2 {
+		return nil, fmt.Errorf("version %d non supportée", version)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if command == 0 { // LOCAL
+		return nil, nil
+	}
+	if command != 1 {
+		return nil, fmt.Errorf("commande v2 inconnue : %d", command)
+	}
+
+	switch header[13] {
+	case 0x11: // TCP sur IPv4
+		if len(body) < 12 {
+			return nil, fmt.Errorf("adresses v2 tronquées")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x21: // TCP sur IPv6
+		if len(body) < 36 {
+			return nil, fmt.Errorf("adresses v2 tronquées")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil // UDP, socket Unix ou famille inconnue : adresse réelle gardée
+}
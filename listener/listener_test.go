@@ -0,0 +1,160 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// proxyV2 construit un en-tête PROXY v2 ; command 0 = LOCAL, 1 = PROXY.
+func proxyV2(command, family byte, addrs []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addrs)))
+	return append(header, addrs...)
+}
+
+func TestReadHeader(t *testing.T) {
+	v4 := []byte{203, 0, 113, 9, 10, 0, 0, 1, 0xc7, 0x38, 0x01, 0xbb} // 51000 -> 443
+	v6 := make([]byte, 36)
+	copy(v6, net.ParseIP("2001:db8::9"))
+	binary.BigEndian.PutUint16(v6[32:], 51000)
+
+	tests := []struct {
+		name   string
+		header []byte
+		want   string // Adresse annoncée, "" = adresse réelle gardée
+		ok     bool
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 203.0.113.9 10.0.0.1 51000 443\r\n"), "203.0.113.9:51000", true},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::9 2001:db8::1 51000 443\r\n"), "[2001:db8::9]:51000", true},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), "", true},
+		{"v1 sans CRLF", []byte("PROXY TCP4 203.0.113.9 10.0.0.1 51000 443\n"), "", false},
+		{"v1 adresse invalide", []byte("PROXY TCP4 exemple.com 10.0.0.1 51000 443\r\n"), "", false},
+		{"v1 port invalide", []byte("PROXY TCP4 203.0.113.9 10.0.0.1 70000 443\r\n"), "", false},
+		{"v1 trop long", []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), "", false},
+		{"v2 IPv4", proxyV2(1, 0x11, v4), "203.0.113.9:51000", true},
+		{"v2 IPv6", proxyV2(1, 0x21, v6), "[2001:db8::9]:51000", true},
+		{"v2 LOCAL", proxyV2(0, 0x11, v4), "", true},
+		{"v2 UDP", proxyV2(1, 0x12, v4), "", true},
+		{"v2 tronqué", proxyV2(1, 0x11, v4[:8]), "", false},
+		{"v2 commande inconnue", proxyV2(2, 0x11, v4), "", false},
+		{"en-tête absent", []byte("GET / HTTP/1.1\r\n"), "", false},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReader(io.MultiReader(bytes.NewReader(tt.header), strings.NewReader("GET /")))
+		addr, err := readHeader(r)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s : erreur %v", tt.name, err)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		got := ""
+		if addr != nil {
+			got = addr.String()
+		}
+		if got != tt.want {
+			t.Errorf("%s : adresse %q, attendu %q", tt.name, got, tt.want)
+		}
+		// La requête qui suit l'en-tête reste intacte.
+		if rest, _ := io.ReadAll(r); string(rest) != "GET /" {
+			t.Errorf("%s : suite %q", tt.name, rest)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, other, _ := net.ParseCIDR("10.0.0.0/8")
+
+	tests := []struct {
+		name   string
+		opts   Options
+		send   string
+		remote string // Préfixe attendu de RemoteAddr
+		read   string // Début des données lues, "" = lecture refusée
+	}{
+		{"source de confiance", Options{ProxyFrom: []*net.IPNet{loopback}},
+			"PROXY TCP4 203.0.113.9 10.0.0.1 51000 443\r\nGET / HTTP/1.1\r\n", "203.0.113.9:51000", "GET /"},
+		{"source non déclarée : en-tête non lu", Options{ProxyFrom: []*net.IPNet{other}},
+			"PROXY TCP4 203.0.113.9 10.0.0.1 51000 443\r\n", "127.0.0.1:", "PROXY"},
+		{"en-tête manquant", Options{ProxyFrom: []*net.IPNet{loopback}},
+			"GET / HTTP/1.1\r\n", "127.0.0.1:", ""},
+		{"h2c refusé", Options{RejectH2C: true},
+			"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", "127.0.0.1:", ""},
+		{"h2c refusé derrière PROXY", Options{ProxyFrom: []*net.IPNet{loopback}, RejectH2C: true},
+			"PROXY TCP4 203.0.113.9 10.0.0.1 51000 443\r\nPRI * HTTP/2.0\r\n\r\n", "203.0.113.9:51000", ""},
+		{"HTTP/1.1 accepté", Options{RejectH2C: true},
+			"GET / HTTP/1.1\r\n", "127.0.0.1:", "GET /"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			wrapped := Wrap(ln, func() Options { return tt.opts })
+
+			client, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			client.Write([]byte(tt.send))
+
+			conn, err := wrapped.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if got := conn.RemoteAddr().String(); !strings.HasPrefix(got, tt.remote) {
+				t.Errorf("RemoteAddr %s, attendu %s", got, tt.remote)
+			}
+			if tt.read == "" {
+				_, err := conn.Read(make([]byte, 16))
+				if err == nil {
+					t.Error("lecture acceptée")
+				}
+				if tt.opts.RejectH2C && !errors.Is(err, errH2CRefused) {
+					t.Errorf("erreur %v, attendu %v", err, errH2CRefused)
+				}
+				return
+			}
+			buf := make([]byte, len(tt.read))
+			if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != tt.read {
+				t.Errorf("lu %q (erreur %v), attendu %q", buf, err, tt.read)
+			}
+		})
+	}
+}
+
+func TestListenerPassthrough(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := Wrap(ln, func() Options { return Options{} }).Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, wrapped := conn.(*Conn); wrapped {
+		t.Error("connexion enveloppée sans PROXY protocol ni refus h2c")
+	}
+}
@@ -0,0 +1,194 @@
+// Package localca est une autorité de certification locale pour le HTTPS de
+// développement : la CA racine est créée une fois sur disque, les
+// certificats des sites sont émis à la demande et gardés en mémoire.
+package localca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CertName = "rootCA.pem"
+	KeyName  = "rootCA-key.pem"
+
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 397 * 24 * time.Hour // Limite acceptée par les navigateurs
+	leafRenew    = 30 * 24 * time.Hour
+)
+
+type Authority struct {
+	dir     string
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+
+	mu     sync.Mutex
+	leaves map[string]*tls.Certificate
+}
+
+// Load lit la CA de dir, ou la crée au premier appel.
+func Load(dir string) (*Authority, error) {
+	certPath, keyPath := filepath.Join(dir, CertName), filepath.Join(dir, KeyName)
+	if _, err := os.Stat(certPath); errors.Is(err, os.ErrNotExist) {
+		if err := create(dir); err != nil {
+			return nil, fmt.Errorf("création de la CA locale : %v", err)
+		}
+	}
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("lecture de la CA locale : %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("lecture de la CA locale : %v", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok || !cert.IsCA {
+		return nil, fmt.Errorf("%s n'est pas une CA utilisable", certPath)
+	}
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{dir: dir, cert: cert, certPEM: certPEM, key: key, leaves: make(map[string]*tls.Certificate)}, nil
+}
+
+func create(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	owner := "goinx"
+	if u, err := user.Current(); err == nil {
+		owner = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		owner += "@" + host
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization:       []string{"Goinx local CA"},
+			OrganizationalUnit: []string{owner},
+			CommonName:         "Goinx local CA " + owner,
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	// La clé d'abord : une CA sans clé ne serait pas recréée.
+	if err := os.WriteFile(filepath.Join(dir, KeyName), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, CertName), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// CertPEM renvoie le certificat racine à faire approuver par les postes de
+// développement.
+func (a *Authority) CertPEM() []byte {
+	return a.certPEM
+}
+
+// Certificate émet (ou ressort de la mémoire) le certificat de name, nom DNS
+// ou adresse IP.
+func (a *Authority) Certificate(name string) (*tls.Certificate, error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cert, ok := a.leaves[name]; ok && time.Until(cert.Leaf.NotAfter) > leafRenew {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"Goinx local"}, CommonName: name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if tpl.NotAfter.After(a.cert.NotAfter) {
+		tpl.NotAfter = a.cert.NotAfter
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		tpl.IPAddresses = []net.IP{ip}
+	} else {
+		tpl.DNSNames = []string{name}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		return nil, fmt.Errorf("émission du certificat local %s : %v", name, err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, a.cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+	a.leaves[name] = cert
+	return cert, nil
+}
+
+// GetCertificate s'utilise comme tls.Config.GetCertificate.
+func (a *Authority) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName == "" {
+		return nil, fmt.Errorf("nom absent du ClientHello")
+	}
+	return a.Certificate(hello.ServerName)
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Instrument compte requêtes, durées et octets échangés par le site.
+func Instrument(site string, next http.Handler) http.Handler {
+	m := siteFor(site)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+			r.Body = &countingBody{ReadCloser: r.Body, count: &m.bytesIn}
+		}
+		mw := &metricsWriter{ResponseWriter: w, site: m}
+		next.ServeHTTP(mw, r)
+
+		status := mw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.observe(status, time.Since(start))
+		if status >= 500 {
+			recordError(ErrorEntry{Time: start, Site: site, Method: r.Method, Path: r.URL.Path, Status: status})
+		}
+	})
+}
+
+// ConnState suit les connexions d'un listener ; à placer dans
+// http.Server.ConnState.
+func ConnState(listener string) func(net.Conn, http.ConnState) {
+	m := listenerFor(listener)
+	return func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			m.accepted.Add(1)
+			m.active.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			m.active.Add(-1)
+		}
+	}
+}
+
+type countingBody struct {
+	io.ReadCloser
+	count *atomic.Uint64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.count.Add(uint64(n))
+	return n, err
+}
+
+type metricsWriter struct {
+	http.ResponseWriter
+	site   *siteMetrics
+	status int
+}
+
+func (w *metricsWriter) WriteHeader(code int) {
+	if w.status == 0 || w.status < 200 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *metricsWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.site.bytesOut.Add(uint64(n))
+	return n, err
+}
+
+func (w *metricsWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *metricsWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *metricsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
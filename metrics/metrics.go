@@ -0,0 +1,248 @@
+// Package metrics expose les compteurs de Goinx au format texte de
+// Prometheus, sans dépendance externe.
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bornes de l'histogramme des durées de requête, en secondes.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// statusClasses indexe les compteurs de requêtes par classe de statut.
+var statusClasses = [...]string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+type siteMetrics struct {
+	requests  [len(statusClasses)]atomic.Uint64
+	inFlight  atomic.Int64
+	bytesIn   atomic.Uint64
+	bytesOut  atomic.Uint64
+	buckets   []atomic.Uint64 // Cumul par borne, +Inf = count
+	count     atomic.Uint64
+	sumMicros atomic.Uint64
+}
+
+type listenerMetrics struct {
+	active   atomic.Int64
+	accepted atomic.Uint64
+}
+
+var (
+	sitesMu sync.Mutex
+	sites   = make(map[string]*siteMetrics)
+
+	listenersMu sync.Mutex
+	listeners   = make(map[string]*listenerMetrics)
+
+	reloadsOK     atomic.Uint64
+	reloadsFailed atomic.Uint64
+	lastReloadOK  atomic.Int64 // Horodatage Unix du dernier reload réussi
+	lastReloadErr atomic.Int64
+
+	collectorsMu sync.Mutex
+	collectors   []func(w *Writer)
+
+	errorsMu     sync.Mutex
+	recentErrors []ErrorEntry // Anneau des dernières réponses 5xx
+	nextError    int
+)
+
+const maxRecentErrors = 50
+
+// Les compteurs sont conservés par nom de site pour survivre aux reloads.
+func siteFor(site string) *siteMetrics {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	m, ok := sites[site]
+	if !ok {
+		m = &siteMetrics{buckets: make([]atomic.Uint64, len(durationBuckets))}
+		sites[site] = m
+	}
+	return m
+}
+
+func listenerFor(name string) *listenerMetrics {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	m, ok := listeners[name]
+	if !ok {
+		m = &listenerMetrics{}
+		listeners[name] = m
+	}
+	return m
+}
+
+func (m *siteMetrics) observe(status int, d time.Duration) {
+	if class := status/100 - 1; class >= 0 && class < len(statusClasses) {
+		m.requests[class].Add(1)
+	}
+	seconds := d.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			m.buckets[i].Add(1)
+		}
+	}
+	m.count.Add(1)
+	m.sumMicros.Add(uint64(d.Microseconds()))
+}
+
+// SiteSnapshot résume l'activité d'un site pour le tableau de bord.
+type SiteSnapshot struct {
+	Requests uint64 `json:"requests"`
+	Errors   uint64 `json:"errors"` // Réponses 5xx
+	InFlight int64  `json:"in_flight"`
+}
+
+func Snapshot() map[string]SiteSnapshot {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	out := make(map[string]SiteSnapshot, len(sites))
+	for name, m := range sites {
+		snap := SiteSnapshot{Errors: m.requests[4].Load(), InFlight: m.inFlight.Load()}
+		for i := range m.requests {
+			snap.Requests += m.requests[i].Load()
+		}
+		out[name] = snap
+	}
+	return out
+}
+
+type ErrorEntry struct {
+	Time   time.Time `json:"time"`
+	Site   string    `json:"site"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"` // Sans la query string
+	Status int       `json:"status"`
+}
+
+func recordError(e ErrorEntry) {
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	if len(recentErrors) < maxRecentErrors {
+		recentErrors = append(recentErrors, e)
+		return
+	}
+	recentErrors[nextError] = e
+	nextError = (nextError + 1) % maxRecentErrors
+}
+
+// RecentErrors renvoie les dernières réponses 5xx, de la plus récente à la
+// plus ancienne.
+func RecentErrors() []ErrorEntry {
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	out := make([]ErrorEntry, 0, len(recentErrors))
+	for i := len(recentErrors) - 1; i >= 0; i-- {
+		out = append(out, recentErrors[(nextError+i)%len(recentErrors)])
+	}
+	return out
+}
+
+// RecordReload compte un reload de la configuration.
+func RecordReload(err error) {
+	if err != nil {
+		reloadsFailed.Add(1)
+		lastReloadErr.Store(time.Now().Unix())
+		return
+	}
+	reloadsOK.Add(1)
+	lastReloadOK.Store(time.Now().Unix())
+}
+
+// RegisterCollector ajoute une fonction appelée à chaque scrape, pour les
+// valeurs lues à la demande (backends, certificats, cache...).
+func RegisterCollector(fn func(w *Writer)) {
+	collectorsMu.Lock()
+	collectors = append(collectors, fn)
+	collectorsMu.Unlock()
+}
+
+func collect(w *Writer) {
+	sitesMu.Lock()
+	names := make([]string, 0, len(sites))
+	for name := range sites {
+		names = append(names, name)
+	}
+	sitesMu.Unlock()
+	sort.Strings(names)
+
+	w.Family("goinx_http_requests_total", "counter", "Requêtes servies par site et classe de statut.")
+	for _, name := range names {
+		m := siteFor(name)
+		for i, class := range statusClasses {
+			w.Sample("goinx_http_requests_total", float64(m.requests[i].Load()), "site", name, "code", class)
+		}
+	}
+	w.Family("goinx_http_requests_in_flight", "gauge", "Requêtes en cours par site.")
+	for _, name := range names {
+		w.Sample("goinx_http_requests_in_flight", float64(siteFor(name).inFlight.Load()), "site", name)
+	}
+	w.Family("goinx_http_request_duration_seconds", "histogram", "Durée des requêtes par site.")
+	for _, name := range names {
+		m := siteFor(name)
+		for i, bound := range durationBuckets {
+			w.Sample("goinx_http_request_duration_seconds_bucket", float64(m.buckets[i].Load()), "site", name, "le", formatFloat(bound))
+		}
+		count := float64(m.count.Load())
+		w.Sample("goinx_http_request_duration_seconds_bucket", count, "site", name, "le", "+Inf")
+		w.Sample("goinx_http_request_duration_seconds_sum", float64(m.sumMicros.Load())/1e6, "site", name)
+		w.Sample("goinx_http_request_duration_seconds_count", count, "site", name)
+	}
+	w.Family("goinx_http_request_bytes_total", "counter", "Octets reçus dans les corps de requête par site.")
+	for _, name := range names {
+		w.Sample("goinx_http_request_bytes_total", float64(siteFor(name).bytesIn.Load()), "site", name)
+	}
+	w.Family("goinx_http_response_bytes_total", "counter", "Octets envoyés dans les corps de réponse par site.")
+	for _, name := range names {
+		w.Sample("goinx_http_response_bytes_total", float64(siteFor(name).bytesOut.Load()), "site", name)
+	}
+
+	listenersMu.Lock()
+	lnames := make([]string, 0, len(listeners))
+	for name := range listeners {
+		lnames = append(lnames, name)
+	}
+	listenersMu.Unlock()
+	sort.Strings(lnames)
+
+	w.Family("goinx_connections_active", "gauge", "Connexions clientes ouvertes par listener.")
+	for _, name := range lnames {
+		w.Sample("goinx_connections_active", float64(listenerFor(name).active.Load()), "listener", name)
+	}
+	w.Family("goinx_connections_accepted_total", "counter", "Connexions clientes acceptées par listener.")
+	for _, name := range lnames {
+		w.Sample("goinx_connections_accepted_total", float64(listenerFor(name).accepted.Load()), "listener", name)
+	}
+
+	w.Family("goinx_config_reloads_total", "counter", "Reloads de la configuration par résultat.")
+	w.Sample("goinx_config_reloads_total", float64(reloadsOK.Load()), "result", "success")
+	w.Sample("goinx_config_reloads_total", float64(reloadsFailed.Load()), "result", "failure")
+	w.Family("goinx_config_last_reload_timestamp_seconds", "gauge", "Horodatage du dernier reload par résultat.")
+	w.Sample("goinx_config_last_reload_timestamp_seconds", float64(lastReloadOK.Load()), "result", "success")
+	w.Sample("goinx_config_last_reload_timestamp_seconds", float64(lastReloadErr.Load()), "result", "failure")
+
+	collectorsMu.Lock()
+	fns := make([]func(*Writer), len(collectors))
+	copy(fns, collectors)
+	collectorsMu.Unlock()
+	for _, fn := range fns {
+		fn(w)
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEndpoint(t *testing.T) {
+	handler := Instrument("exemple.com", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/panne":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			buf := make([]byte, 16)
+			n, _ := r.Body.Read(buf)
+			w.WriteHeader(http.StatusCreated)
+			w.Write(buf[:n])
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("bonjour")))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panne?token=secret", nil))
+
+	conn := ConnState("http :8080")
+	conn(nil, http.StateNew)
+	conn(nil, http.StateNew)
+	conn(nil, http.StateClosed)
+
+	RecordReload(nil)
+	RecordReload(errors.New("échec"))
+	RegisterCollector(func(w *Writer) {
+		w.Family("goinx_test_info", "gauge", "Ligne 1\nligne 2.")
+		w.Sample("goinx_test_info", 1, "value", `a"b\c`)
+	})
+
+	w := httptest.NewRecorder()
+	Endpoint().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE goinx_http_requests_total counter",
+		`goinx_http_requests_total{site="exemple.com",code="2xx"} 1`,
+		`goinx_http_requests_total{site="exemple.com",code="5xx"} 1`,
+		`goinx_http_requests_total{site="exemple.com",code="4xx"} 0`,
+		`goinx_http_requests_in_flight{site="exemple.com"} 0`,
+		`goinx_http_request_duration_seconds_bucket{site="exemple.com",le="+Inf"} 2`,
+		`goinx_http_request_duration_seconds_count{site="exemple.com"} 2`,
+		`goinx_http_request_bytes_total{site="exemple.com"} 7`,
+		`goinx_http_response_bytes_total{site="exemple.com"} 7`,
+		`goinx_connections_active{listener="http :8080"} 1`,
+		`goinx_connections_accepted_total{listener="http :8080"} 2`,
+		`goinx_config_reloads_total{result="success"} 1`,
+		`goinx_config_reloads_total{result="failure"} 1`,
+		`# HELP goinx_test_info Ligne 1\nligne 2.`,
+		`goinx_test_info{value="a\"b\\c"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("ligne absente : %s", line)
+		}
+	}
+
+	snap := Snapshot()["exemple.com"]
+	if snap.Requests != 2 || snap.Errors != 1 {
+		t.Errorf("snapshot %+v", snap)
+	}
+	recent := RecentErrors()
+	if len(recent) != 1 || recent[0].Path != "/panne" || recent[0].Status != http.StatusBadGateway {
+		t.Errorf("erreurs récentes %+v", recent)
+	}
+}
+
+func TestRecentErrorsRing(t *testing.T) {
+	errorsMu.Lock()
+	saved, savedNext := recentErrors, nextError
+	recentErrors, nextError = nil, 0
+	errorsMu.Unlock()
+	defer func() {
+		errorsMu.Lock()
+		recentErrors, nextError = saved, savedNext
+		errorsMu.Unlock()
+	}()
+
+	for i := range maxRecentErrors + 5 {
+		recordError(ErrorEntry{Status: 500 + i})
+	}
+	recent := RecentErrors()
+	if len(recent) != maxRecentErrors {
+		t.Fatalf("%d erreurs conservées, attendu %d", len(recent), maxRecentErrors)
+	}
+	if first, last := recent[0].Status, recent[len(recent)-1].Status; first != 500+maxRecentErrors+4 || last != 505 {
+		t.Errorf("ordre %d..%d, attendu %d..505", first, last, 500+maxRecentErrors+4)
+	}
+}
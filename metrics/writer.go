@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// Writer produit le format texte de Prometheus (version 0.0.4).
+type Writer struct {
+	buf bytes.Buffer
+}
+
+// Family écrit l'en-tête HELP/TYPE d'une métrique, avant ses échantillons.
+func (w *Writer) Family(name, kind, help string) {
+	w.buf.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.buf.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// Sample écrit un échantillon ; labels alterne noms et valeurs.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) >= 2 {
+		w.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+// Endpoint sert toutes les métriques, quelle que soit l'URL demandée.
+func Endpoint() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var w Writer
+		collect(&w)
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		rw.Write(w.buf.Bytes())
+	})
+}
@@ -0,0 +1,773 @@
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCacheDir       = "/var/cache/goinx"
+	defaultCacheKey       = "$scheme$host$request_uri"
+	defaultCacheMemory    = 64 << 20
+	defaultCacheMaxObject = 10 << 20
+	defaultCacheStale     = time.Minute
+	cacheJanitorInterval  = 10 * time.Minute
+)
+
+type CacheOptions struct {
+	Zone      string        // Nom de la zone, partageable entre sites
+	Dir       string        // Dossier disque (défaut /var/cache/goinx/<zone>)
+	MaxMemory int64         // Taille max de la zone en mémoire
+	MaxObject int64         // Taille max d'une réponse mise en cache
+	Key       string        // Modèle de clef (défaut $scheme$host$request_uri)
+	Valid     time.Duration // Fraîcheur par défaut si le backend n'en indique pas (0 = ne pas cacher)
+	Stale     time.Duration // Durée max de service d'une copie périmée (erreur ou revalidation)
+}
+
+type cacheEntry struct {
+	Key                  string
+	Site                 string
+	Path                 string
+	Status               int
+	Header               http.Header
+	Body                 []byte
+	Stored               time.Time
+	Expires              time.Time
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	Vary                 []string // Non vide : entrée d'index listant les en-têtes Vary
+}
+
+func (e *cacheEntry) size() int64 {
+	return int64(len(e.Body) + len(e.Key) + 512)
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+func (e *cacheEntry) retainUntil() time.Time {
+	stale := e.StaleWhileRevalidate
+	if e.StaleIfError > stale {
+		stale = e.StaleIfError
+	}
+	return e.Expires.Add(stale)
+}
+
+// cacheZone stocke les réponses en mémoire (LRU borné) et sur disque. Les
+// requêtes concurrentes sur une même clef absente sont regroupées.
+type cacheZone struct {
+	name      string
+	dir       string
+	maxMemory int64
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	memory   int64
+	inflight map[string]chan struct{}
+	stop     chan struct{} // Fermé quand la zone n'est plus utilisée
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	stale  atomic.Uint64
+}
+
+var (
+	zonesMu sync.Mutex
+	zones   = make(map[string]*cacheZone)
+)
+
+// zoneFor renvoie la zone partagée de ce nom. Elle est conservée d'un reload
+// à l'autre avec son contenu, seuls ses réglages sont mis à jour.
+func zoneFor(opts *CacheOptions) *cacheZone {
+	zonesMu.Lock()
+	defer zonesMu.Unlock()
+	dir := opts.Dir
+	if dir == "" {
+		dir = filepath.Join(defaultCacheDir, opts.Zone)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		log.Printf("Cache %s : dossier %s inutilisable, cache mémoire seul : %v", opts.Zone, dir, err)
+		dir = ""
+	}
+	z, ok := zones[opts.Zone]
+	if !ok {
+		z = &cacheZone{
+			name:     opts.Zone,
+			entries:  make(map[string]*list.Element),
+			lru:      list.New(),
+			inflight: make(map[string]chan struct{}),
+			stop:     make(chan struct{}),
+		}
+		zones[opts.Zone] = z
+		go z.janitor()
+	}
+	z.mu.Lock()
+	z.dir = dir
+	z.maxMemory = opts.MaxMemory
+	z.evict()
+	z.mu.Unlock()
+	return z
+}
+
+// RetainCacheZones arrête les zones absentes de names, après un reload : leur
+// mémoire est libérée, le disque est gardé pour une réactivation.
+func RetainCacheZones(names []string) {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+	zonesMu.Lock()
+	defer zonesMu.Unlock()
+	for name, z := range zones {
+		if !keep[name] {
+			close(z.stop)
+			delete(zones, name)
+		}
+	}
+}
+
+func (z *cacheZone) get(key string) *cacheEntry {
+	z.mu.Lock()
+	if el, ok := z.entries[key]; ok {
+		z.lru.MoveToFront(el)
+		e := el.Value.(*cacheEntry)
+		z.mu.Unlock()
+		return e
+	}
+	z.mu.Unlock()
+
+	e := z.readDisk(key)
+	if e == nil {
+		return nil
+	}
+	if time.Now().After(e.retainUntil()) {
+		z.remove(key)
+		return nil
+	}
+	z.remember(e)
+	return e
+}
+
+func (z *cacheZone) put(e *cacheEntry) {
+	z.remember(e)
+	z.writeDisk(e)
+}
+
+func (z *cacheZone) remember(e *cacheEntry) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if el, ok := z.entries[e.Key]; ok {
+		z.memory -= el.Value.(*cacheEntry).size()
+		z.lru.Remove(el)
+	}
+	z.entries[e.Key] = z.lru.PushFront(e)
+	z.memory += e.size()
+	z.evict()
+}
+
+// evict retire les entrées les moins récentes au-delà de maxMemory ; appelée
+// sous z.mu.
+func (z *cacheZone) evict() {
+	for z.memory > z.maxMemory && z.lru.Len() > 1 {
+		oldest := z.lru.Back()
+		old := oldest.Value.(*cacheEntry)
+		z.lru.Remove(oldest)
+		delete(z.entries, old.Key)
+		z.memory -= old.size()
+	}
+}
+
+func (z *cacheZone) remove(key string) {
+	z.mu.Lock()
+	if el, ok := z.entries[key]; ok {
+		z.memory -= el.Value.(*cacheEntry).size()
+		z.lru.Remove(el)
+		delete(z.entries, key)
+	}
+	z.mu.Unlock()
+	if file := z.filePath(key); file != "" {
+		os.Remove(file)
+	}
+}
+
+// directory renvoie le dossier disque, vide pour une zone mémoire seule.
+func (z *cacheZone) directory() string {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.dir
+}
+
+func (z *cacheZone) filePath(key string) string {
+	dir := z.directory()
+	if dir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(dir, name[:2], name)
+}
+
+func (z *cacheZone) readDisk(key string) *cacheEntry {
+	file := z.filePath(key)
+	if file == "" {
+		return nil
+	}
+	e := readEntryFile(file)
+	if e == nil || e.Key != key {
+		return nil
+	}
+	return e
+}
+
+func readEntryFile(file string) *cacheEntry {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var e cacheEntry
+	if err := gob.NewDecoder(f).Decode(&e); err != nil {
+		return nil
+	}
+	return &e
+}
+
+func (z *cacheZone) writeDisk(e *cacheEntry) {
+	file := z.filePath(e.Key)
+	if file == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0750); err != nil {
+		log.Printf("Cache %s : écriture impossible : %v", z.name, err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		log.Printf("Cache %s : écriture impossible : %v", z.name, err)
+		return
+	}
+	if err := gob.NewEncoder(tmp).Encode(e); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		log.Printf("Cache %s : encodage impossible : %v", z.name, err)
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// begin renvoie true si l'appelant doit interroger le backend ; sinon il
+// reçoit le canal fermé à la fin de la requête déjà en cours.
+func (z *cacheZone) begin(key string) (chan struct{}, bool) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if ch, ok := z.inflight[key]; ok {
+		return ch, false
+	}
+	ch := make(chan struct{})
+	z.inflight[key] = ch
+	return ch, true
+}
+
+func (z *cacheZone) end(key string, ch chan struct{}) {
+	z.mu.Lock()
+	delete(z.inflight, key)
+	z.mu.Unlock()
+	close(ch)
+}
+
+// janitor supprime périodiquement du disque les entrées qui ne peuvent plus
+// être servies, même périmées.
+func (z *cacheZone) janitor() {
+	ticker := time.NewTicker(cacheJanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-z.stop:
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		z.walkDisk(func(file string, e *cacheEntry) {
+			if now.After(e.retainUntil()) {
+				os.Remove(file)
+			}
+		})
+		z.mu.Lock()
+		for key, el := range z.entries {
+			if e := el.Value.(*cacheEntry); now.After(e.retainUntil()) {
+				z.memory -= e.size()
+				z.lru.Remove(el)
+				delete(z.entries, key)
+			}
+		}
+		z.mu.Unlock()
+	}
+}
+
+func (z *cacheZone) walkDisk(fn func(file string, e *cacheEntry)) {
+	dir := z.directory()
+	if dir == "" {
+		return
+	}
+	filepath.WalkDir(dir, func(file string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		if e := readEntryFile(file); e != nil {
+			fn(file, e)
+		}
+		return nil
+	})
+}
+
+// purge supprime les entrées d'un site dont le chemin correspond au motif
+// (glob, ou préfixe si le motif se termine par *).
+func (z *cacheZone) purge(site, pattern string) int {
+	match := func(e *cacheEntry) bool {
+		if e.Site != site {
+			return false
+		}
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(e.Path, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+		ok, _ := path.Match(pattern, e.Path)
+		return ok
+	}
+
+	purged := make(map[string]bool)
+	z.mu.Lock()
+	for key, el := range z.entries {
+		if e := el.Value.(*cacheEntry); match(e) {
+			z.memory -= e.size()
+			z.lru.Remove(el)
+			delete(z.entries, key)
+			purged[key] = true
+		}
+	}
+	z.mu.Unlock()
+
+	z.walkDisk(func(file string, e *cacheEntry) {
+		if match(e) {
+			os.Remove(file)
+			purged[e.Key] = true
+		}
+	})
+	return len(purged)
+}
+
+type CacheStats struct {
+	Zone   string
+	Hits   uint64
+	Misses uint64
+	Stale  uint64
+	Memory int64 // Octets occupés en mémoire
+}
+
+func CacheZones() []CacheStats {
+	zonesMu.Lock()
+	defer zonesMu.Unlock()
+	out := make([]CacheStats, 0, len(zones))
+	for _, z := range zones {
+		z.mu.Lock()
+		mem := z.memory
+		z.mu.Unlock()
+		out = append(out, CacheStats{
+			Zone:   z.name,
+			Hits:   z.hits.Load(),
+			Misses: z.misses.Load(),
+			Stale:  z.stale.Load(),
+			Memory: mem,
+		})
+	}
+	return out
+}
+
+// cacheControl découpe un en-tête Cache-Control en directives.
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(part, "=")
+			directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return directives
+}
+
+func ccSeconds(cc map[string]string, name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// freshness calcule la durée de vie d'une réponse ; 0 signifie qu'elle ne
+// doit pas être mise en cache.
+func (p *Proxy) freshness(r *http.Request, status int, h http.Header) time.Duration {
+	if !cacheableStatus[status] || h.Get("Set-Cookie") != "" || isEventStream(h.Get("Content-Type")) {
+		return 0
+	}
+	for _, v := range h.Values("Vary") {
+		if strings.Contains(v, "*") {
+			return 0
+		}
+	}
+	cc := cacheControl(h)
+	if _, ok := cc["no-store"]; ok {
+		return 0
+	}
+	if _, ok := cc["private"]; ok {
+		return 0
+	}
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	_, public := cc["public"]
+	sMaxAge, hasSMaxAge := ccSeconds(cc, "s-maxage")
+	if r.Header.Get("Authorization") != "" && !public && !hasSMaxAge {
+		return 0
+	}
+	if hasSMaxAge {
+		return sMaxAge
+	}
+	if maxAge, ok := ccSeconds(cc, "max-age"); ok {
+		return maxAge
+	}
+	if exp := h.Get("Expires"); exp != "" {
+		expires, err := http.ParseTime(exp)
+		if err != nil {
+			return 0
+		}
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		return expires.Sub(date)
+	}
+	return p.opts.Cache.Valid
+}
+
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+func variantKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(":")
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+func (p *Proxy) cacheable(r *http.Request) bool {
+	if p.zone == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) || isUpgrade(r) {
+		return false
+	}
+	_, noStore := cacheControl(r.Header)["no-store"]
+	return !noStore
+}
+
+// lookup résout l'index Vary éventuel et renvoie la clef de la variante
+// correspondant à la requête, avec l'entrée si elle existe.
+func (p *Proxy) lookup(key string, r *http.Request) (string, *cacheEntry) {
+	e := p.zone.get(key)
+	if e == nil || len(e.Vary) == 0 {
+		return key, e
+	}
+	vkey := variantKey(key, e.Vary, r)
+	return vkey, p.zone.get(vkey)
+}
+
+// serveCached sert la requête depuis le cache si possible, sinon la transmet
+// au backend en stockant la réponse. Une copie périmée est servie pendant la
+// revalidation et à la place d'une erreur du backend.
+func (p *Proxy) serveCached(w http.ResponseWriter, r *http.Request) {
+	key := p.expand(p.opts.Cache.Key, r, nil)
+	_, refresh := cacheControl(r.Header)["no-cache"]
+
+	vkey, entry := p.lookup(key, r)
+	now := time.Now()
+	if entry != nil && !refresh {
+		if entry.fresh(now) {
+			p.zone.hits.Add(1)
+			serveEntry(w, r, entry, "HIT")
+			return
+		}
+		if now.Before(entry.Expires.Add(entry.StaleWhileRevalidate)) {
+			p.zone.stale.Add(1)
+			serveEntry(w, r, entry, "UPDATING")
+			// La requête appartient au serveur une fois le handler terminé.
+			out := r.Clone(context.WithoutCancel(r.Context()))
+			out.Body = http.NoBody
+			go p.revalidate(key, vkey, out)
+			return
+		}
+	}
+
+	done, leader := p.zone.begin(vkey)
+	if !leader {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+			return
+		}
+		if _, e := p.lookup(key, r); e != nil && e.fresh(time.Now()) {
+			p.zone.hits.Add(1)
+			serveEntry(w, r, e, "HIT")
+			return
+		}
+		w.Header().Set("X-Cache", "MISS")
+		p.zone.misses.Add(1)
+		p.forward(w, r)
+		return
+	}
+	defer p.zone.end(vkey, done)
+
+	p.zone.misses.Add(1)
+	p.fetchAndStore(w, r, key, entry)
+}
+
+func (p *Proxy) fetchAndStore(w http.ResponseWriter, r *http.Request, key string, stale *cacheEntry) {
+	out := r.Clone(r.Context())
+	out.Header.Del("If-None-Match")
+	out.Header.Del("If-Modified-Since")
+
+	if stale != nil && time.Now().After(stale.Expires.Add(stale.StaleIfError)) {
+		stale = nil
+	}
+	cw := &cacheWriter{ResponseWriter: w, proxy: p, req: out, stale: stale}
+	p.forward(cw, out)
+
+	if cw.entry == nil || cw.overflow || cw.served {
+		return
+	}
+	cw.entry.Body = cw.body
+	p.store(key, r, cw.entry)
+}
+
+func (p *Proxy) store(key string, r *http.Request, e *cacheEntry) {
+	e.Key = key
+	if len(e.Vary) > 0 {
+		index := &cacheEntry{
+			Key:     key,
+			Site:    p.opts.Site,
+			Path:    e.Path,
+			Vary:    e.Vary,
+			Expires: e.Expires,
+
+			StaleWhileRevalidate: e.StaleWhileRevalidate,
+			StaleIfError:         e.StaleIfError,
+		}
+		p.zone.put(index)
+		e.Key = variantKey(key, e.Vary, r)
+		e.Vary = nil
+	}
+	p.zone.put(e)
+}
+
+// revalidate rafraîchit en tâche de fond une entrée servie périmée ; r est
+// une copie détachée de la requête du client.
+func (p *Proxy) revalidate(key, vkey string, r *http.Request) {
+	done, leader := p.zone.begin(vkey)
+	if !leader {
+		return
+	}
+	defer p.zone.end(vkey, done)
+
+	r.Header.Del("If-None-Match")
+	r.Header.Del("If-Modified-Since")
+	bw := &bufferWriter{header: make(http.Header)}
+	cw := &cacheWriter{ResponseWriter: bw, proxy: p, req: r}
+	p.forward(cw, r)
+	if cw.entry == nil || cw.overflow {
+		return
+	}
+	cw.entry.Body = cw.body
+	p.store(key, r, cw.entry)
+}
+
+func serveEntry(w http.ResponseWriter, r *http.Request, e *cacheEntry, status string) {
+	h := w.Header()
+	for name, values := range e.Header {
+		h[name] = append([]string(nil), values...)
+	}
+	h.Set("Age", strconv.Itoa(int(time.Since(e.Stored).Seconds())))
+	h.Set("X-Cache", status)
+
+	if etag := e.Header.Get("ETag"); etag != "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(e.Status)
+	if r.Method != http.MethodHead {
+		w.Write(e.Body)
+	}
+}
+
+// cacheWriter transmet la réponse au client tout en la copiant pour le
+// cache. Si le backend échoue et qu'une copie périmée est disponible, elle
+// est servie à la place de l'erreur.
+type cacheWriter struct {
+	http.ResponseWriter
+	proxy *Proxy
+	req   *http.Request
+	stale *cacheEntry
+
+	entry    *cacheEntry
+	body     []byte
+	overflow bool
+	served   bool
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if code >= 500 && w.stale != nil {
+		w.served = true
+		w.proxy.zone.stale.Add(1)
+		// Rien de la réponse en échec (Set-Cookie, Content-Length, Retry-After...).
+		clear(w.Header())
+		serveEntry(w.ResponseWriter, w.req, w.stale, "STALE")
+		return
+	}
+
+	h := w.Header()
+	ttl := time.Duration(0)
+	if w.req.Method == http.MethodGet {
+		ttl = w.proxy.freshness(w.req, code, h)
+	}
+	if ttl > 0 {
+		if cl, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && cl > w.proxy.opts.Cache.MaxObject {
+			ttl = 0
+		}
+	}
+	if ttl > 0 {
+		now := time.Now()
+		cc := cacheControl(h)
+		swr, sie := w.proxy.opts.Cache.Stale, w.proxy.opts.Cache.Stale
+		if d, ok := ccSeconds(cc, "stale-while-revalidate"); ok && d > swr {
+			swr = d
+		}
+		if d, ok := ccSeconds(cc, "stale-if-error"); ok && d > sie {
+			sie = d
+		}
+		_, mustRevalidate := cc["must-revalidate"]
+		_, proxyRevalidate := cc["proxy-revalidate"]
+		if mustRevalidate || proxyRevalidate {
+			swr, sie = 0, 0
+		}
+		header := h.Clone()
+		header.Del("X-Cache")
+		w.entry = &cacheEntry{
+			Site:                 w.proxy.opts.Site,
+			Path:                 w.req.URL.Path,
+			Status:               code,
+			Header:               header,
+			Stored:               now,
+			Expires:              now.Add(ttl),
+			StaleWhileRevalidate: swr,
+			StaleIfError:         sie,
+			Vary:                 varyHeaders(h),
+		}
+		h.Set("X-Cache", "MISS")
+	} else {
+		h.Set("X-Cache", "BYPASS")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if w.served {
+		return len(b), nil
+	}
+	if w.entry != nil && !w.overflow {
+		if int64(len(w.body)+len(b)) > w.proxy.opts.Cache.MaxObject {
+			w.overflow = true
+			w.body = nil
+		} else {
+			w.body = append(w.body, b...)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *cacheWriter) Flush() {
+	if w.served {
+		return
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// bufferWriter absorbe la réponse d'une revalidation en tâche de fond.
+type bufferWriter struct {
+	header http.Header
+}
+
+func (w *bufferWriter) Header() http.Header         { return w.header }
+func (w *bufferWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *bufferWriter) WriteHeader(int)             {}
+
+// Purge supprime du cache les réponses de ce site dont le chemin correspond
+// au motif, et renvoie le nombre d'entrées supprimées.
+func (p *Proxy) Purge(pattern string) int {
+	if p.zone == nil {
+		return 0
+	}
+	return p.zone.purge(p.opts.Site, pattern)
+}
+
+func (p *Proxy) CacheEnabled() bool {
+	return p.zone != nil
+}
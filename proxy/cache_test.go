@@ -0,0 +1,328 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cacheBackend est un backend dont la réponse est choisie par le test.
+type cacheBackend struct {
+	srv     *httptest.Server
+	calls   atomic.Int32
+	handler atomic.Value // http.HandlerFunc
+}
+
+func newCacheBackend(t *testing.T, h http.HandlerFunc) *cacheBackend {
+	b := &cacheBackend{}
+	b.handler.Store(h)
+	b.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.calls.Add(1)
+		b.handler.Load().(http.HandlerFunc)(w, r)
+	}))
+	t.Cleanup(b.srv.Close)
+	return b
+}
+
+func (b *cacheBackend) set(h http.HandlerFunc) { b.handler.Store(h) }
+
+func newCacheProxy(t *testing.T, backend *cacheBackend) *Proxy {
+	target, _ := url.Parse(backend.srv.URL)
+	p := New(Options{
+		Site:    "exemple.com",
+		Target:  target,
+		Retries: -1,
+		Cache:   &CacheOptions{Zone: t.Name(), Dir: t.TempDir()},
+	})
+	t.Cleanup(func() { RetainCacheZones(nil) })
+	return p
+}
+
+func reply(body string, headers ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.Write([]byte(body))
+	}
+}
+
+func fetch(p *Proxy, target string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	return rec
+}
+
+// expire rend périmée l'entrée de target sans attendre.
+func expire(t *testing.T, p *Proxy, target string) *cacheEntry {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	_, e := p.lookup(p.expand(p.opts.Cache.Key, req, nil), req)
+	if e == nil {
+		t.Fatalf("%s absent du cache", target)
+	}
+	e.Expires = time.Now().Add(-time.Second)
+	return e
+}
+
+func TestCacheKey(t *testing.T) {
+	p := &Proxy{opts: Options{Target: &url.URL{Host: "backend:3000"}}}
+	req := httptest.NewRequest(http.MethodGet, "http://exemple.com/api/users?page=2", nil)
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{defaultCacheKey, "httpexemple.com/api/users?page=2"},
+		{"$host$uri", "exemple.com/api/users"},
+		{"$proxy_host$request_uri", "backend:3000/api/users?page=2"},
+	}
+	for _, tt := range tests {
+		if got := p.expand(tt.key, req, nil); got != tt.want {
+			t.Errorf("%s : %q, attendu %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestCacheFreshness(t *testing.T) {
+	p := &Proxy{opts: Options{Cache: &CacheOptions{Valid: time.Minute}}}
+	now := time.Now()
+	tests := []struct {
+		name    string
+		status  int
+		headers []string
+		auth    bool
+		want    time.Duration
+	}{
+		{"max-age", 200, []string{"Cache-Control", "max-age=30"}, false, 30 * time.Second},
+		{"s-maxage prioritaire", 200, []string{"Cache-Control", "max-age=30, s-maxage=90"}, false, 90 * time.Second},
+		{"Expires", 200, []string{"Date", now.UTC().Format(http.TimeFormat), "Expires", now.Add(2 * time.Minute).UTC().Format(http.TimeFormat)}, false, 2 * time.Minute},
+		{"proxy_cache_valid par défaut", 200, nil, false, time.Minute},
+		{"404 cachée", 404, nil, false, time.Minute},
+		{"500 jamais cachée", 500, []string{"Cache-Control", "max-age=30"}, false, 0},
+		{"no-store", 200, []string{"Cache-Control", "no-store"}, false, 0},
+		{"private", 200, []string{"Cache-Control", "private, max-age=30"}, false, 0},
+		{"no-cache", 200, []string{"Cache-Control", "no-cache"}, false, 0},
+		{"Set-Cookie", 200, []string{"Cache-Control", "max-age=30", "Set-Cookie", "id=1"}, false, 0},
+		{"Vary *", 200, []string{"Cache-Control", "max-age=30", "Vary", "*"}, false, 0},
+		{"SSE", 200, []string{"Cache-Control", "max-age=30", "Content-Type", "text/event-stream"}, false, 0},
+		{"Authorization", 200, []string{"Cache-Control", "max-age=30"}, true, 0},
+		{"Authorization et public", 200, []string{"Cache-Control", "public, max-age=30"}, true, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.auth {
+				req.Header.Set("Authorization", "Bearer x")
+			}
+			h := make(http.Header)
+			for i := 0; i+1 < len(tt.headers); i += 2 {
+				h.Set(tt.headers[i], tt.headers[i+1])
+			}
+			got := p.freshness(req, tt.status, h)
+			if got < tt.want-time.Second || got > tt.want {
+				t.Errorf("fraîcheur %s, attendu %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheHitAndVary(t *testing.T) {
+	backend := newCacheBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte("bonjour " + r.Header.Get("Accept-Language")))
+	})
+	p := newCacheProxy(t, backend)
+
+	steps := []struct {
+		lang   string
+		xcache string
+		body   string
+		calls  int32
+	}{
+		{"fr", "MISS", "bonjour fr", 1},
+		{"fr", "HIT", "bonjour fr", 1},
+		{"en", "MISS", "bonjour en", 2},
+		{"en", "HIT", "bonjour en", 2},
+		{"fr", "HIT", "bonjour fr", 2},
+	}
+	for i, step := range steps {
+		rec := fetch(p, "/page", "Accept-Language", step.lang)
+		if got := rec.Header().Get("X-Cache"); got != step.xcache {
+			t.Errorf("étape %d : X-Cache %s, attendu %s", i, got, step.xcache)
+		}
+		if rec.Body.String() != step.body {
+			t.Errorf("étape %d : corps %q, attendu %q", i, rec.Body.String(), step.body)
+		}
+		if n := backend.calls.Load(); n != step.calls {
+			t.Errorf("étape %d : %d appels au backend, attendu %d", i, n, step.calls)
+		}
+	}
+	if rec := fetch(p, "/page", "Accept-Language", "fr", "Cache-Control", "no-cache"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("no-cache du client : X-Cache %s, attendu MISS", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	backend := newCacheBackend(t, reply("v1", "Cache-Control", "max-age=60, stale-while-revalidate=60"))
+	p := newCacheProxy(t, backend)
+	fetch(p, "/page")
+	expire(t, p, "/page")
+	backend.set(reply("v2", "Cache-Control", "max-age=60"))
+
+	// Contexte annulé dès la réponse : la revalidation doit s'en détacher.
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/page", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	cancel()
+	if rec.Header().Get("X-Cache") != "UPDATING" || rec.Body.String() != "v1" {
+		t.Fatalf("copie périmée : %s %q, attendu UPDATING v1", rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec := fetch(p, "/page")
+		if rec.Header().Get("X-Cache") == "HIT" && rec.Body.String() == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("revalidation non stockée : %s %q", rec.Header().Get("X-Cache"), rec.Body.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	backend := newCacheBackend(t, reply("v1", "Cache-Control", "max-age=60", "Content-Type", "text/plain"))
+	p := newCacheProxy(t, backend)
+	fetch(p, "/page")
+	expire(t, p, "/page").StaleWhileRevalidate = 0
+	backend.set(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=panne")
+		w.Header().Set("Retry-After", "120")
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("page de panne, bien plus longue que v1"))
+	})
+
+	rec := fetch(p, "/page")
+	if rec.Code != http.StatusOK || rec.Body.String() != "v1" || rec.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("stale-if-error : %d %s %q, attendu 200 STALE v1", rec.Code, rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	for _, name := range []string{"Set-Cookie", "Retry-After"} {
+		if v := rec.Header().Get(name); v != "" {
+			t.Errorf("en-tête %s de la réponse en échec transmis : %q", name, v)
+		}
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "" && cl != "2" {
+		t.Errorf("Content-Length %s, attendu celui de la copie", cl)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("Content-Type %q, attendu celui de la copie", ct)
+	}
+
+	// Au-delà de stale-if-error, l'erreur passe.
+	e := expire(t, p, "/page")
+	e.Expires = time.Now().Add(-time.Hour)
+	if rec := fetch(p, "/page"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("copie trop ancienne : statut %d, attendu 503", rec.Code)
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	backend := newCacheBackend(t, reply("ok", "Cache-Control", "max-age=60"))
+	p := newCacheProxy(t, backend)
+	for _, target := range []string{"/api/a", "/api/b", "/assets/app.js", "/index.html"} {
+		fetch(p, target)
+	}
+
+	tests := []struct {
+		pattern string
+		want    int
+	}{
+		{"/api/*", 2},
+		{"/api/*", 0},
+		{"/assets/*.js", 1},
+		{"*", 1},
+	}
+	for _, tt := range tests {
+		if got := p.Purge(tt.pattern); got != tt.want {
+			t.Errorf("purge %s : %d entrées, attendu %d", tt.pattern, got, tt.want)
+		}
+	}
+	if rec := fetch(p, "/index.html"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("après purge : X-Cache %s, attendu MISS", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestCacheDiskRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	opts := &CacheOptions{Zone: t.Name(), Dir: dir, MaxMemory: defaultCacheMemory}
+	z := zoneFor(opts)
+	t.Cleanup(func() { RetainCacheZones(nil) })
+
+	stored := time.Now().Truncate(time.Second)
+	e := &cacheEntry{
+		Key:     "httpexemple.com/page",
+		Site:    "exemple.com",
+		Path:    "/page",
+		Status:  http.StatusOK,
+		Header:  http.Header{"Content-Type": {"text/plain"}},
+		Body:    []byte("contenu"),
+		Stored:  stored,
+		Expires: stored.Add(time.Minute),
+	}
+	z.put(e)
+
+	// Zone rouverte après un redémarrage : mémoire vide, disque conservé.
+	RetainCacheZones(nil)
+	z = zoneFor(opts)
+	got := z.get(e.Key)
+	if got == nil {
+		t.Fatal("entrée absente après relecture du disque")
+	}
+	if got.Status != e.Status || string(got.Body) != "contenu" || got.Header.Get("Content-Type") != "text/plain" ||
+		!got.Expires.Equal(e.Expires) || got.Path != "/page" || got.Site != "exemple.com" {
+		t.Errorf("entrée relue : %+v", got)
+	}
+	if z.get("httpexemple.com/autre") != nil {
+		t.Error("clef inconnue trouvée sur le disque")
+	}
+}
+
+func TestCacheZoneSettingsUpdated(t *testing.T) {
+	opts := &CacheOptions{Zone: t.Name(), Dir: t.TempDir(), MaxMemory: 10 << 20}
+	z := zoneFor(opts)
+	t.Cleanup(func() { RetainCacheZones(nil) })
+	for i := range 4 {
+		z.remember(&cacheEntry{Key: string(rune('a' + i)), Body: make([]byte, 1024)})
+	}
+
+	// Reload avec une zone plus petite et un autre dossier.
+	dir := t.TempDir()
+	if again := zoneFor(&CacheOptions{Zone: t.Name(), Dir: dir, MaxMemory: 3000}); again != z {
+		t.Fatal("zone recréée au lieu d'être mise à jour")
+	}
+	if z.directory() != dir || z.maxMemory != 3000 {
+		t.Errorf("réglages : %s %d, attendu %s 3000", z.directory(), z.maxMemory, dir)
+	}
+	if z.memory > 3000 || z.lru.Len() != 1 {
+		t.Errorf("mémoire %d pour %d entrées après réduction", z.memory, z.lru.Len())
+	}
+
+	RetainCacheZones(nil)
+	select {
+	case <-z.stop:
+	default:
+		t.Error("zone retirée sans arrêt du janitor")
+	}
+}
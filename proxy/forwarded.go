@@ -0,0 +1,269 @@
+package proxy
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+
+	"github.com/OxiWanV2/Goinx/server"
+)
+
+type HeaderRule struct {
+	Name  string // Nom de l'en-tête
+	Value string // Valeur, peut contenir des variables ($remote_addr, $scheme...)
+}
+
+type PathRule struct {
+	From string // Préfixe à remplacer
+	To   string // Remplacement
+}
+
+// ParseNetworks convertit une liste d'IP ou de CIDR ("10.0.0.0/8",
+// "192.168.1.10") en réseaux. Les entrées invalides sont ignorées et loggées.
+func ParseNetworks(values []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				log.Printf("Adresse de proxy de confiance invalide : %s", v)
+				continue
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			log.Printf("Réseau de proxy de confiance invalide : %s", v)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIP renvoie l'adresse du client. Les en-têtes X-Forwarded-For ne sont
+// pris en compte que si la connexion vient d'un proxy de confiance ; la
+// chaîne est alors remontée de droite à gauche jusqu'à la première adresse
+// qui n'en est pas un.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	remote := remoteIP(r)
+	ip := net.ParseIP(remote)
+	if ip == nil || !containsIP(trusted, ip) {
+		return remote
+	}
+
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(hops[i])
+		if hop == nil {
+			break
+		}
+		remote = hops[i]
+		if !containsIP(trusted, hop) {
+			break
+		}
+	}
+	return remote
+}
+
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+func (p *Proxy) isTrusted(r *http.Request) bool {
+	ip := net.ParseIP(remoteIP(r))
+	return ip != nil && containsIP(p.trusted, ip)
+}
+
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// setForwarded positionne X-Forwarded-*, X-Real-IP et Forwarded sur la
+// requête sortante. Les valeurs entrantes ne sont conservées que si le pair
+// direct est un proxy de confiance ; sinon elles sont remplacées.
+func (p *Proxy) setForwarded(pr *httputil.ProxyRequest) {
+	in, out := pr.In, pr.Out
+	remote := remoteIP(in)
+	trusted := p.isTrusted(in)
+
+	proto := scheme(in)
+	host := in.Host
+	xff := remote
+	forwarded := ""
+
+	if trusted {
+		if v := in.Header.Get("X-Forwarded-Proto"); v != "" {
+			proto = v
+		}
+		if v := in.Header.Get("X-Forwarded-Host"); v != "" {
+			host = v
+		}
+		if prior := forwardedFor(in.Header); len(prior) > 0 {
+			xff = strings.Join(prior, ", ") + ", " + remote
+		}
+		if v := strings.Join(in.Header.Values("Forwarded"), ", "); v != "" {
+			forwarded = v + ", "
+		}
+	}
+
+	out.Header.Set("X-Forwarded-For", xff)
+	out.Header.Set("X-Forwarded-Proto", proto)
+	out.Header.Set("X-Forwarded-Host", host)
+	out.Header.Set("X-Real-IP", ClientIP(in, p.trusted))
+	out.Header.Set("Forwarded", forwarded+forwardedElement(remote, host, proto))
+}
+
+func forwardedElement(remote, host, proto string) string {
+	node := remote
+	if strings.Contains(node, ":") {
+		node = `"[` + node + `]"`
+	}
+	return "for=" + node + ";host=" + quoteForwarded(host) + ";proto=" + proto
+}
+
+func quoteForwarded(v string) string {
+	if strings.ContainsAny(v, ":[]\" ;,") {
+		return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+	}
+	return v
+}
+
+// expand remplace les variables de proxy_set_header et proxy_cache_key dans
+// value. out porte les en-têtes déjà calculés pour la requête sortante, s'il
+// y en a une. $remote_addr tient compte des proxys de confiance.
+func (p *Proxy) expand(value string, in *http.Request, out http.Header) string {
+	return server.Vars{
+		Request: in,
+		Lookup: func(name string) (string, bool) {
+			switch name {
+			case "remote_addr":
+				return ClientIP(in, p.trusted), true
+			case "proxy_host":
+				return p.opts.Target.Host, true
+			case "proxy_add_x_forwarded_for":
+				if out != nil {
+					return out.Get("X-Forwarded-For"), true
+				}
+				return remoteIP(in), true
+			}
+			return "", false
+		},
+	}.Expand(value)
+}
+
+// applySetHeaders applique proxy_set_header ; une valeur vide supprime
+// l'en-tête, comme nginx.
+func (p *Proxy) applySetHeaders(pr *httputil.ProxyRequest) {
+	for _, h := range p.opts.SetHeaders {
+		value := p.expand(h.Value, pr.In, pr.Out.Header)
+		if strings.EqualFold(h.Name, "Host") {
+			pr.Out.Host = value
+			continue
+		}
+		if value == "" {
+			pr.Out.Header.Del(h.Name)
+			continue
+		}
+		pr.Out.Header.Set(h.Name, value)
+	}
+}
+
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	for _, name := range p.opts.HideHeaders {
+		resp.Header.Del(name)
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		resp.Header.Set("Location", p.rewriteLocation(loc))
+	}
+	if refresh := resp.Header.Get("Refresh"); refresh != "" {
+		if i := strings.Index(strings.ToLower(refresh), "url="); i >= 0 {
+			resp.Header.Set("Refresh", refresh[:i+4]+p.rewriteLocation(refresh[i+4:]))
+		}
+	}
+	if len(p.opts.CookiePaths) > 0 {
+		cookies := resp.Header.Values("Set-Cookie")
+		resp.Header.Del("Set-Cookie")
+		for _, c := range cookies {
+			resp.Header.Add("Set-Cookie", p.rewriteCookiePath(c))
+		}
+	}
+	return nil
+}
+
+// rewriteLocation ramène les redirections du backend sous le préfixe public
+// (proxy_redirect). En mode "default", seule l'URL interne du backend est
+// réécrite, comme nginx : un chemin absolu peut viser une autre location.
+func (p *Proxy) rewriteLocation(loc string) string {
+	if p.opts.Redirect == "off" {
+		return loc
+	}
+	for _, rule := range p.opts.Redirects {
+		if strings.HasPrefix(loc, rule.From) {
+			return rule.To + loc[len(rule.From):]
+		}
+	}
+	if p.opts.Redirect != "" && p.opts.Redirect != "default" {
+		return loc
+	}
+
+	prefix := strings.TrimSuffix(p.opts.StripPrefix, "/")
+	backend := strings.TrimSuffix(p.opts.Target.String(), "/")
+	if strings.HasPrefix(loc, backend+"/") || loc == backend {
+		return prefix + "/" + strings.TrimPrefix(loc[len(backend):], "/")
+	}
+	return loc
+}
+
+func (p *Proxy) rewriteCookiePath(cookie string) string {
+	attrs := strings.Split(cookie, ";")
+	for i, attr := range attrs {
+		trimmed := strings.TrimSpace(attr)
+		if len(trimmed) < 5 || !strings.EqualFold(trimmed[:5], "path=") {
+			continue
+		}
+		path := trimmed[5:]
+		for _, rule := range p.opts.CookiePaths {
+			if strings.HasPrefix(path, rule.From) {
+				attrs[i] = " Path=" + rule.To + path[len(rule.From):]
+				break
+			}
+		}
+	}
+	return strings.Join(attrs, ";")
+}
@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := ParseNetworks([]string{"10.0.0.0/8", "192.168.1.10"})
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"sans proxy", "203.0.113.5:4000", "", "203.0.113.5"},
+		{"XFF ignoré hors confiance", "203.0.113.5:4000", "1.2.3.4", "203.0.113.5"},
+		{"proxy de confiance", "10.0.0.2:4000", "198.51.100.7", "198.51.100.7"},
+		{"chaîne de proxys", "10.0.0.2:4000", "198.51.100.7, 192.168.1.10, 10.1.1.1", "198.51.100.7"},
+		{"usurpation à gauche", "10.0.0.2:4000", "6.6.6.6, 198.51.100.7", "198.51.100.7"},
+		{"hop invalide", "10.0.0.2:4000", "198.51.100.7, inconnu", "10.0.0.2"},
+		{"XFF absent", "10.0.0.2:4000", "", "10.0.0.2"},
+		{"IPv6", "[2001:db8::1]:4000", "", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if got := ClientIP(req, trusted); got != tt.want {
+			t.Errorf("%s : %s, attendu %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetForwarded(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host", "X-Real-IP", "Forwarded", "X-Custom"} {
+			w.Header().Set("Echo-"+name, r.Header.Get(name))
+		}
+		w.Header().Set("Echo-Host", r.Host)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+	p := New(Options{
+		Site:           "exemple.com",
+		Target:         target,
+		TrustedProxies: []string{"10.0.0.0/8"},
+		SetHeaders:     []HeaderRule{{Name: "X-Custom", Value: "$remote_addr via $proxy_host"}},
+	})
+
+	tests := []struct {
+		name   string
+		remote string
+		in     map[string]string
+		want   map[string]string
+	}{
+		{
+			"client direct, en-têtes usurpés ignorés",
+			"203.0.113.5:4000",
+			map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "pirate.com", "Forwarded": "for=1.2.3.4"},
+			map[string]string{
+				"X-Forwarded-For":   "203.0.113.5",
+				"X-Forwarded-Proto": "http",
+				"X-Forwarded-Host":  "exemple.com",
+				"X-Real-IP":         "203.0.113.5",
+				"Forwarded":         "for=203.0.113.5;host=exemple.com;proto=http",
+				"X-Custom":          "203.0.113.5 via " + target.Host,
+				"Host":              "exemple.com",
+			},
+		},
+		{
+			"derrière un proxy de confiance",
+			"10.0.0.2:4000",
+			map[string]string{"X-Forwarded-For": "198.51.100.7", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "www.exemple.com", "Forwarded": "for=198.51.100.7"},
+			map[string]string{
+				"X-Forwarded-For":   "198.51.100.7, 10.0.0.2",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "www.exemple.com",
+				"X-Real-IP":         "198.51.100.7",
+				"Forwarded":         "for=198.51.100.7, for=10.0.0.2;host=www.exemple.com;proto=https",
+				"X-Custom":          "198.51.100.7 via " + target.Host,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://exemple.com/", nil)
+			req.RemoteAddr = tt.remote
+			for name, value := range tt.in {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+			for name, want := range tt.want {
+				if got := rec.Header().Get("Echo-" + name); got != want {
+					t.Errorf("%s : %q, attendu %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteLocation(t *testing.T) {
+	target, _ := url.Parse("http://localhost:3001")
+	tests := []struct {
+		name     string
+		redirect string
+		rules    []PathRule
+		loc      string
+		want     string
+	}{
+		{"URL du backend", "", nil, "http://localhost:3001/login", "/api/login"},
+		{"racine du backend", "default", nil, "http://localhost:3001", "/api/"},
+		{"chemin absolu laissé aux autres locations", "", nil, "/login", "/login"},
+		{"chemin déjà préfixé", "", nil, "/api/login", "/api/login"},
+		{"URL externe", "", nil, "https://sso.exemple.com/auth", "https://sso.exemple.com/auth"},
+		{"backend voisin", "", nil, "http://localhost:30011/x", "http://localhost:30011/x"},
+		{"règle explicite", "", []PathRule{{From: "/", To: "/api/"}}, "/login", "/api/login"},
+		{"off", "off", []PathRule{{From: "/", To: "/api/"}}, "http://localhost:3001/login", "http://localhost:3001/login"},
+	}
+	for _, tt := range tests {
+		p := &Proxy{opts: Options{Target: target, StripPrefix: "/api", Redirect: tt.redirect, Redirects: tt.rules}}
+		if got := p.rewriteLocation(tt.loc); got != tt.want {
+			t.Errorf("%s : %q, attendu %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestModifyResponseHeaders(t *testing.T) {
+	target, _ := url.Parse("http://localhost:3001")
+	p := &Proxy{opts: Options{
+		Target:      target,
+		StripPrefix: "/api",
+		HideHeaders: []string{"X-Powered-By"},
+		CookiePaths: []PathRule{{From: "/", To: "/api/"}},
+	}}
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Location", "http://localhost:3001/login")
+	resp.Header.Set("Refresh", "5; url=http://localhost:3001/home")
+	resp.Header.Set("X-Powered-By", "Express")
+	resp.Header.Add("Set-Cookie", "session=abc; Path=/; HttpOnly")
+	resp.Header.Add("Set-Cookie", "pref=1; path=/settings")
+	resp.Header.Add("Set-Cookie", "sans=chemin; Secure")
+	if err := p.modifyResponse(resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := resp.Header.Get("Location"); got != "/api/login" {
+		t.Errorf("Location %q", got)
+	}
+	if got := resp.Header.Get("Refresh"); got != "5; url=/api/home" {
+		t.Errorf("Refresh %q", got)
+	}
+	if got := resp.Header.Get("X-Powered-By"); got != "" {
+		t.Errorf("proxy_hide_header : X-Powered-By %q transmis", got)
+	}
+	want := []string{"session=abc; Path=/api/; HttpOnly", "pref=1; Path=/api/settings", "sans=chemin; Secure"}
+	got := resp.Header.Values("Set-Cookie")
+	if len(got) != len(want) {
+		t.Fatalf("Set-Cookie %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Set-Cookie %q, attendu %q", got[i], want[i])
+		}
+	}
+}
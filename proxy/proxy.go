@@ -0,0 +1,317 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStreamReadTimeout = 60 * time.Second
+	defaultStreamIdleTimeout = 10 * time.Minute
+	defaultKeepAliveInterval = 30 * time.Second
+	defaultDrainTimeout      = 30 * time.Second
+)
+
+type Options struct {
+	Site              string        // Nom du site, sert de clef pour les statistiques
+	Target            *url.URL      // Backend cible (ex: http://localhost:3001)
+	StripPrefix       string        // Préfixe public retiré avant transmission (ex: /api)
+	StreamReadTimeout time.Duration // Attente max de la réponse du backend à un upgrade
+	StreamIdleTimeout time.Duration // Inactivité max d'un flux long (WebSocket/SSE)
+	FlushInterval     time.Duration // Intervalle de flush des réponses (-1 = immédiat)
+	KeepAliveInterval time.Duration // Intervalle des keepalive TCP et des pings SSE
+	DrainTimeout      time.Duration // Délai laissé aux flux ouverts lors d'un reload
+	TrustedProxies    []string      // IP/CIDR dont les en-têtes X-Forwarded-* sont acceptés
+	SetHeaders        []HeaderRule  // proxy_set_header
+	HideHeaders       []string      // proxy_hide_header
+	Redirect          string        // proxy_redirect : "default" (défaut) ou "off"
+	Redirects         []PathRule    // proxy_redirect <from> <to>
+	CookiePaths       []PathRule    // proxy_cookie_path <from> <to>
+	ConnectTimeout    time.Duration // Délai max de connexion au backend
+	ReadTimeout       time.Duration // Attente max des en-têtes puis entre deux lectures du corps
+	Retries           int           // Retries sur erreur de connexion (méthodes idempotentes), -1 = aucun
+	RetryBudget       int           // Pourcentage max de retries par rapport aux requêtes
+	BreakerThreshold  int           // Échecs consécutifs avant ouverture du circuit
+	BreakerCooldown   time.Duration // Durée d'ouverture du circuit avant requête de test
+	ErrorHandler      func(w http.ResponseWriter, r *http.Request, status int)
+	Cache             *CacheOptions // proxy_cache, nil = pas de cache
+}
+
+type Proxy struct {
+	opts     Options
+	rp       *httputil.ReverseProxy
+	trusted  []*net.IPNet
+	counters *siteCounters
+	breaker  *breaker
+	budget   *retryBudget
+	zone     *cacheZone
+
+	mu       sync.Mutex
+	streams  map[*stream]struct{}
+	draining bool
+}
+
+func New(opts Options) *Proxy {
+	if opts.StreamReadTimeout <= 0 {
+		opts.StreamReadTimeout = defaultStreamReadTimeout
+	}
+	if opts.StreamIdleTimeout <= 0 {
+		opts.StreamIdleTimeout = defaultStreamIdleTimeout
+	}
+	if opts.KeepAliveInterval <= 0 {
+		opts.KeepAliveInterval = defaultKeepAliveInterval
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = defaultDrainTimeout
+	}
+	if opts.ConnectTimeout <= 0 {
+		opts.ConnectTimeout = defaultConnectTimeout
+	}
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = defaultReadTimeout
+	}
+	if opts.Retries == 0 {
+		opts.Retries = defaultRetries
+	} else if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.RetryBudget <= 0 {
+		opts.RetryBudget = defaultRetryBudget
+	}
+	if opts.BreakerThreshold <= 0 {
+		opts.BreakerThreshold = defaultBreakerThreshold
+	}
+	if opts.BreakerCooldown <= 0 {
+		opts.BreakerCooldown = defaultBreakerCooldown
+	}
+
+	p := &Proxy{
+		opts:     opts,
+		trusted:  ParseNetworks(opts.TrustedProxies),
+		counters: countersFor(opts.Site),
+		breaker:  breakerFor(opts.Site, opts.Target.Host, opts.BreakerThreshold, opts.BreakerCooldown),
+		budget:   newRetryBudget(opts.RetryBudget),
+		streams:  make(map[*stream]struct{}),
+	}
+
+	if c := opts.Cache; c != nil && c.Zone != "" {
+		if c.MaxMemory <= 0 {
+			c.MaxMemory = defaultCacheMemory
+		}
+		if c.MaxObject <= 0 {
+			c.MaxObject = defaultCacheMaxObject
+		}
+		if c.Key == "" {
+			c.Key = defaultCacheKey
+		}
+		if c.Stale == 0 {
+			c.Stale = defaultCacheStale
+		} else if c.Stale < 0 {
+			c.Stale = 0
+		}
+		p.zone = zoneFor(c)
+	}
+
+	p.rp = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.handleError,
+		FlushInterval:  opts.FlushInterval,
+		Transport:      p.newTransport(),
+	}
+	return p
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+	if r.Context().Err() == context.Canceled {
+		// Client parti : rien à lui répondre.
+		return
+	}
+	log.Printf("Erreur proxy site %s vers %s : %v", p.opts.Site, p.opts.Target.Host, err)
+	p.counters.upstreamError(status)
+
+	if wait := p.breaker.retryAfter(); status == http.StatusServiceUnavailable && wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	}
+	if p.opts.ErrorHandler != nil {
+		p.opts.ErrorHandler(w, r, status)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+func (p *Proxy) rewrite(pr *httputil.ProxyRequest) {
+	pr.SetURL(p.opts.Target)
+	// Le backend reçoit le Host public, comme avant l'introduction de Rewrite.
+	pr.Out.Host = pr.In.Host
+	p.setForwarded(pr)
+	p.applySetHeaders(pr)
+}
+
+func (p *Proxy) newTransport() http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   p.opts.ConnectTimeout,
+		KeepAlive: p.opts.KeepAliveInterval,
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.DialContext = dialer.DialContext
+	base.ResponseHeaderTimeout = p.opts.ReadTimeout
+
+	// Les connexions upgradées ne retournent jamais dans le pool : on les
+	// ouvre toujours à neuf pour pouvoir les rattacher au flux en cours.
+	upgrade := http.DefaultTransport.(*http.Transport).Clone()
+	upgrade.DisableKeepAlives = true
+	upgrade.ResponseHeaderTimeout = p.opts.StreamReadTimeout
+	upgrade.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := ctx.Value(streamKey{}).(*stream); ok {
+			return s.wrap(conn), nil
+		}
+		return conn, nil
+	}
+
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if isUpgrade(req) {
+			start := time.Now()
+			resp, err := upgrade.RoundTrip(req)
+			p.recordUpstream(req, resp, start)
+			return resp, err
+		}
+		return p.roundTrip(base, req)
+	})
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.cacheable(r) {
+		p.serveCached(w, r)
+		return
+	}
+	p.forward(w, r)
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	draining := p.draining
+	p.mu.Unlock()
+
+	upgrade := isUpgrade(r)
+	if draining && upgrade {
+		http.Error(w, "Service en cours de rechargement", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	s := p.newStream(cancel)
+	defer p.closeStream(s)
+
+	if upgrade {
+		ctx = context.WithValue(ctx, streamKey{}, s)
+	}
+
+	sw := &streamWriter{ResponseWriter: w, proxy: p, stream: s}
+	defer sw.stop()
+
+	p.rp.ServeHTTP(sw, p.stripPrefix(r.WithContext(ctx)))
+}
+
+func (p *Proxy) stripPrefix(r *http.Request) *http.Request {
+	prefix := strings.TrimSuffix(p.opts.StripPrefix, "/")
+	if prefix == "" || !strings.HasPrefix(r.URL.Path, prefix) {
+		return r
+	}
+	u := *r.URL
+	u.Path = strings.TrimPrefix(u.Path, prefix)
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimPrefix(u.RawPath, prefix)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	r.URL = &u
+	return r
+}
+
+// Drain laisse aux WebSocket et flux SSE encore ouverts le temps de se
+// terminer d'eux-mêmes, puis ferme ceux qui restent.
+func (p *Proxy) Drain() {
+	p.mu.Lock()
+	p.draining = true
+	n := p.activeStreams()
+	p.mu.Unlock()
+
+	if n == 0 {
+		return
+	}
+	log.Printf("Drain de %d flux ouverts pour site %s (max %s)", n, p.opts.Site, p.opts.DrainTimeout)
+
+	deadline := time.Now().Add(p.opts.DrainTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+		p.mu.Lock()
+		n = p.activeStreams()
+		p.mu.Unlock()
+		if n == 0 {
+			log.Printf("Flux du site %s drainés", p.opts.Site)
+			return
+		}
+	}
+
+	p.mu.Lock()
+	remaining := make([]*stream, 0, len(p.streams))
+	for s := range p.streams {
+		if s.active() {
+			remaining = append(remaining, s)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, s := range remaining {
+		s.close()
+	}
+	log.Printf("%d flux du site %s fermés après délai de drain", len(remaining), p.opts.Site)
+}
+
+func (p *Proxy) activeStreams() int {
+	n := 0
+	for s := range p.streams {
+		if s.active() {
+			n++
+		}
+	}
+	return n
+}
+
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,355 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OxiWanV2/Goinx/server"
+)
+
+const (
+	defaultConnectTimeout   = 10 * time.Second
+	defaultReadTimeout      = 60 * time.Second
+	defaultRetries          = 2
+	defaultRetryBudget      = 20
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+
+	// Réserve de retries disponible au démarrage et après une période calme,
+	// pour absorber un redémarrage du backend même sans trafic préalable.
+	retryBudgetReserve = 10
+)
+
+var errBreakerOpen = errors.New("circuit ouvert pour cet upstream")
+
+// BreakerState est l'état d'un disjoncteur ; String donne son libellé.
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "ouvert"
+	case BreakerHalfOpen:
+		return "semi-ouvert"
+	}
+	return "fermé"
+}
+
+// breaker est un disjoncteur par site et upstream : il s'ouvre après threshold
+// échecs consécutifs, puis laisse passer une seule requête de test une fois
+// le cooldown écoulé.
+type breaker struct {
+	site     string
+	upstream string
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	threshold int
+	cooldown  time.Duration
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[breakerKey]*breaker)
+)
+
+type breakerKey struct{ site, upstream string }
+
+// breakerFor renvoie le disjoncteur d'un upstream pour un site : deux sites
+// vers le même backend gardent chacun leurs réglages. Il est conservé d'un
+// reload à l'autre, seuls ses réglages sont mis à jour.
+func breakerFor(site, upstream string, threshold int, cooldown time.Duration) *breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	key := breakerKey{site, upstream}
+	b, ok := breakers[key]
+	if !ok {
+		b = &breaker{site: site, upstream: upstream}
+		breakers[key] = b
+	}
+	b.mu.Lock()
+	b.threshold = threshold
+	b.cooldown = cooldown
+	b.mu.Unlock()
+	return b
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *breaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerOpen {
+		return 0
+	}
+	return b.cooldown - time.Since(b.openedAt)
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// release libère la requête de test sans conclure, quand le client est
+// parti avant la réponse du backend.
+func (b *breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		return
+	}
+	b.failures++
+	if b.state == BreakerClosed && b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+type BreakerStatus struct {
+	Site     string       // Site propriétaire du disjoncteur
+	Upstream string       // Adresse du backend (host:port)
+	State    BreakerState // BreakerClosed, BreakerOpen ou BreakerHalfOpen
+	Failures int          // Échecs consécutifs
+	OpenedAt time.Time    // Dernière ouverture du circuit
+}
+
+func Breakers() []BreakerStatus {
+	breakersMu.Lock()
+	list := make([]*breaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	breakersMu.Unlock()
+
+	out := make([]BreakerStatus, 0, len(list))
+	for _, b := range list {
+		b.mu.Lock()
+		out = append(out, BreakerStatus{
+			Site:     b.site,
+			Upstream: b.upstream,
+			State:    b.state,
+			Failures: b.failures,
+			OpenedAt: b.openedAt,
+		})
+		b.mu.Unlock()
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Site != out[j].Site {
+			return out[i].Site < out[j].Site
+		}
+		return out[i].Upstream < out[j].Upstream
+	})
+	return out
+}
+
+// retryBudget limite les retries à un pourcentage des requêtes : chaque
+// requête crédite ratio jeton, chaque retry en consomme un.
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+func newRetryBudget(percent int) *retryBudget {
+	return &retryBudget{ratio: float64(percent) / 100, tokens: retryBudgetReserve}
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	b.tokens += b.ratio
+	if b.tokens > retryBudgetReserve {
+		b.tokens = retryBudgetReserve
+	}
+	b.mu.Unlock()
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// roundTrip applique disjoncteur et retries aux requêtes non upgradées. Seules
+// les erreurs de connexion sont rejouées, et uniquement pour les méthodes
+// idempotentes sans corps : le backend n'a alors rien reçu.
+func (p *Proxy) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if !p.breaker.allow() {
+		return nil, errBreakerOpen
+	}
+	p.budget.deposit()
+
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		resp, err := base.RoundTrip(req)
+		p.recordUpstream(req, resp, start)
+		if err == nil {
+			if isUpstreamFailure(resp.StatusCode) {
+				p.breaker.failure()
+			} else {
+				p.breaker.success()
+			}
+			if !isEventStream(resp.Header.Get("Content-Type")) {
+				resp.Body = newTimeoutBody(resp.Body, p.opts.ReadTimeout)
+			}
+			return resp, nil
+		}
+
+		if req.Context().Err() == context.Canceled {
+			p.breaker.release()
+			return nil, err
+		}
+		if attempt >= p.opts.Retries || !isConnectError(err) || !isRetryable(req) || !p.budget.withdraw() {
+			p.breaker.failure()
+			return nil, err
+		}
+
+		backoff := time.Duration(50<<attempt) * time.Millisecond
+		select {
+		case <-req.Context().Done():
+			p.breaker.release()
+			return nil, err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// recordUpstream note adresse, statut et délais du backend pour le log
+// d'accès ; le délai total est fixé à la fermeture du corps.
+func (p *Proxy) recordUpstream(req *http.Request, resp *http.Response, start time.Time) {
+	info := server.RequestInfoFrom(req.Context())
+	if info == nil {
+		return
+	}
+	if resp == nil {
+		info.SetUpstream(p.opts.Target.Host, 0, time.Since(start))
+		return
+	}
+	info.SetUpstream(p.opts.Target.Host, resp.StatusCode, time.Since(start))
+	// Le corps d'un 101 est la connexion elle-même : ReverseProxy exige
+	// qu'il reste un io.ReadWriteCloser.
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = &upstreamBody{ReadCloser: resp.Body, info: info, start: start}
+	}
+}
+
+type upstreamBody struct {
+	io.ReadCloser
+	info  *server.RequestInfo
+	start time.Time
+	once  sync.Once
+}
+
+func (b *upstreamBody) Close() error {
+	b.once.Do(func() { b.info.SetUpstreamTime(time.Since(b.start)) })
+	return b.ReadCloser.Close()
+}
+
+func isUpstreamFailure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isRetryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0
+}
+
+// timeoutBody coupe la lecture du corps de réponse si le backend reste muet
+// plus de timeout entre deux lectures (proxy_read_timeout).
+type timeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newTimeoutBody(body io.ReadCloser, timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 || body == nil || body == http.NoBody {
+		return body
+	}
+	return &timeoutBody{
+		ReadCloser: body,
+		timeout:    timeout,
+		timer:      time.AfterFunc(timeout, func() { body.Close() }),
+	}
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Reset(b.timeout)
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
+
+// errorStatus traduit une erreur de transport en code HTTP.
+func errorStatus(err error) int {
+	if errors.Is(err, errBreakerOpen) {
+		return http.StatusServiceUnavailable
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransitions(t *testing.T) {
+	b := &breaker{threshold: 2, cooldown: time.Minute}
+	expired := func() { b.openedAt = time.Now().Add(-2 * time.Minute) }
+
+	steps := []struct {
+		name  string
+		do    func() bool // Renvoie allow() après l'étape
+		state BreakerState
+		allow bool
+	}{
+		{"fermé au départ", b.allow, BreakerClosed, true},
+		{"premier échec", func() bool { b.failure(); return b.allow() }, BreakerClosed, true},
+		{"seuil atteint", func() bool { b.failure(); return b.allow() }, BreakerOpen, false},
+		{"cooldown écoulé : requête de test", func() bool { expired(); return b.allow() }, BreakerHalfOpen, true},
+		{"une seule requête de test", b.allow, BreakerHalfOpen, false},
+		{"test abandonné par le client", func() bool { b.release(); return b.allow() }, BreakerHalfOpen, true},
+		{"test en échec : réouverture", func() bool { b.failure(); return b.allow() }, BreakerOpen, false},
+		{"nouveau test", func() bool { expired(); return b.allow() }, BreakerHalfOpen, true},
+		{"test réussi : fermeture", func() bool { b.success(); return b.allow() }, BreakerClosed, true},
+	}
+	for _, step := range steps {
+		if allow := step.do(); allow != step.allow {
+			t.Errorf("%s : allow %v, attendu %v", step.name, allow, step.allow)
+		}
+		if b.state != step.state {
+			t.Errorf("%s : état %s, attendu %s", step.name, b.state, step.state)
+		}
+	}
+	if b.failures != 0 {
+		t.Errorf("%d échecs comptés après fermeture", b.failures)
+	}
+}
+
+func TestBreakerRetryAfter(t *testing.T) {
+	b := &breaker{threshold: 1, cooldown: 30 * time.Second}
+	if b.retryAfter() != 0 {
+		t.Error("retryAfter sur un circuit fermé")
+	}
+	b.failure()
+	if wait := b.retryAfter(); wait <= 29*time.Second || wait > 30*time.Second {
+		t.Errorf("retryAfter %s, attendu ~30s", wait)
+	}
+	if errorStatus(errBreakerOpen) != http.StatusServiceUnavailable {
+		t.Error("circuit ouvert : statut autre que 503")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := newRetryBudget(50)
+	for i := range retryBudgetReserve {
+		if !b.withdraw() {
+			t.Fatalf("réserve épuisée après %d retries, attendu %d", i, retryBudgetReserve)
+		}
+	}
+	if b.withdraw() {
+		t.Fatal("retry accordé au-delà de la réserve")
+	}
+	b.deposit() // 0,5 jeton
+	if b.withdraw() {
+		t.Fatal("retry accordé avec un demi-jeton")
+	}
+	b.deposit()
+	if !b.withdraw() {
+		t.Fatal("retry refusé après deux requêtes à 50 %")
+	}
+	for range 100 {
+		b.deposit()
+	}
+	if b.tokens > retryBudgetReserve {
+		t.Errorf("%v jetons, plafond %d", b.tokens, retryBudgetReserve)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		method string
+		body   string
+		want   bool
+	}{
+		{http.MethodGet, "", true},
+		{http.MethodHead, "", true},
+		{http.MethodPut, "", true},
+		{http.MethodDelete, "", true},
+		{http.MethodPost, "", false},
+		{http.MethodPatch, "", false},
+		{http.MethodPut, "données", false},
+	}
+	for _, tt := range tests {
+		var body io.Reader
+		if tt.body != "" {
+			body = strings.NewReader(tt.body)
+		}
+		req := httptest.NewRequest(tt.method, "/", body)
+		if got := isRetryable(req); got != tt.want {
+			t.Errorf("%s avec corps %q : %v, attendu %v", tt.method, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTripRetries(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		errs    []error // Erreurs successives du backend, puis 200
+		retries int
+		budget  float64
+		calls   int
+		ok      bool
+	}{
+		{"connexion refusée puis rétablie", http.MethodGet, "", []error{dialErr, dialErr}, 2, retryBudgetReserve, 3, true},
+		{"retries épuisés", http.MethodGet, "", []error{dialErr, dialErr, dialErr}, 2, retryBudgetReserve, 3, false},
+		{"erreur après connexion : pas de retry", http.MethodGet, "", []error{readErr}, 2, retryBudgetReserve, 1, false},
+		{"POST jamais rejoué", http.MethodPost, "", []error{dialErr}, 2, retryBudgetReserve, 1, false},
+		{"corps jamais rejoué", http.MethodPut, "x", []error{dialErr}, 2, retryBudgetReserve, 1, false},
+		{"budget épuisé", http.MethodGet, "", []error{dialErr, dialErr}, 2, 0, 1, false},
+		{"retries désactivés", http.MethodGet, "", []error{dialErr}, 0, retryBudgetReserve, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				calls++
+				if calls <= len(tt.errs) {
+					return nil, tt.errs[calls-1]
+				}
+				return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody}, nil
+			})
+			p := &Proxy{
+				opts:    Options{Retries: tt.retries, Target: &url.URL{Host: "backend:3000"}},
+				breaker: &breaker{threshold: 100, cooldown: time.Minute},
+				budget:  &retryBudget{ratio: 0, tokens: tt.budget},
+			}
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			_, err := p.roundTrip(base, httptest.NewRequest(tt.method, "/", body))
+			if calls != tt.calls || (err == nil) != tt.ok {
+				t.Errorf("%d appels, erreur %v ; attendu %d appels, succès %v", calls, err, tt.calls, tt.ok)
+			}
+			if !tt.ok && p.breaker.failures != 1 {
+				t.Errorf("%d échecs comptés par le disjoncteur, attendu 1 par requête", p.breaker.failures)
+			}
+		})
+	}
+}
+
+func TestRoundTripBreakerOpen(t *testing.T) {
+	calls := 0
+	base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}, Body: http.NoBody}, nil
+	})
+	p := &Proxy{
+		opts:    Options{Target: &url.URL{Host: "backend:3000"}},
+		breaker: &breaker{threshold: 2, cooldown: time.Minute},
+		budget:  newRetryBudget(20),
+	}
+	for range 2 {
+		p.roundTrip(base, httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if _, err := p.roundTrip(base, httptest.NewRequest(http.MethodGet, "/", nil)); !errors.Is(err, errBreakerOpen) {
+		t.Errorf("circuit ouvert : erreur %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("%d appels au backend, attendu 2 avant ouverture", calls)
+	}
+}
+
+func TestTimeoutBody(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	body := newTimeoutBody(pr, 50*time.Millisecond)
+
+	// Données régulières : pas de coupure.
+	go func() {
+		for range 3 {
+			time.Sleep(20 * time.Millisecond)
+			pw.Write([]byte("x"))
+		}
+	}()
+	buf := make([]byte, 1)
+	for i := range 3 {
+		if _, err := body.Read(buf); err != nil {
+			t.Fatalf("lecture %d coupée : %v", i, err)
+		}
+	}
+	// Backend muet : la lecture suivante échoue après le délai.
+	start := time.Now()
+	if _, err := body.Read(buf); err == nil {
+		t.Fatal("lecture non coupée")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("coupure après %s", elapsed)
+	}
+	if newTimeoutBody(http.NoBody, time.Second) != http.NoBody {
+		t.Error("corps vide enveloppé")
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errBreakerOpen, http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		if got := errorStatus(tt.err); got != tt.want {
+			t.Errorf("%v : %d, attendu %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type streamKey struct{}
+
+type streamKind int
+
+const (
+	streamNone streamKind = iota
+	streamWebSocket
+	streamSSE
+)
+
+// Un stream suit une requête proxifiée qui devient une connexion longue :
+// WebSocket (ou tout autre upgrade) ou flux Server-Sent Events.
+type stream struct {
+	proxy        *Proxy
+	cancel       context.CancelFunc
+	lastActivity atomic.Int64
+
+	mu    sync.Mutex
+	kind  streamKind
+	conns []net.Conn
+	done  chan struct{}
+}
+
+func (p *Proxy) newStream(cancel context.CancelFunc) *stream {
+	s := &stream{
+		proxy:  p,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.touch()
+	return s
+}
+
+func (p *Proxy) closeStream(s *stream) {
+	s.mu.Lock()
+	kind := s.kind
+	s.kind = streamNone
+	s.mu.Unlock()
+
+	if kind == streamNone {
+		return
+	}
+	close(s.done)
+
+	p.mu.Lock()
+	delete(p.streams, s)
+	p.mu.Unlock()
+
+	switch kind {
+	case streamWebSocket:
+		p.counters.webSockets.Add(-1)
+	case streamSSE:
+		p.counters.sse.Add(-1)
+	}
+}
+
+// start enregistre le flux et lance sa surveillance d'inactivité. ping, si
+// non nil, est appelé à chaque intervalle de keepalive.
+func (s *stream) start(kind streamKind, ping func()) {
+	s.mu.Lock()
+	if s.kind != streamNone {
+		s.mu.Unlock()
+		return
+	}
+	s.kind = kind
+	s.mu.Unlock()
+
+	p := s.proxy
+	p.mu.Lock()
+	p.streams[s] = struct{}{}
+	p.mu.Unlock()
+
+	switch kind {
+	case streamWebSocket:
+		p.counters.webSockets.Add(1)
+		p.counters.upgrades.Add(1)
+	case streamSSE:
+		p.counters.sse.Add(1)
+	}
+
+	go s.watch(ping)
+}
+
+func (s *stream) watch(ping func()) {
+	idle := s.proxy.opts.StreamIdleTimeout
+	interval := s.proxy.opts.KeepAliveInterval
+	if idle/4 < interval {
+		interval = idle / 4
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, s.lastActivity.Load())) > idle {
+				s.close()
+				return
+			}
+			if ping != nil {
+				ping()
+			}
+		}
+	}
+}
+
+func (s *stream) active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.kind != streamNone
+}
+
+func (s *stream) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (s *stream) close() {
+	s.cancel()
+	s.mu.Lock()
+	conns := s.conns
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+func (s *stream) wrap(conn net.Conn) net.Conn {
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+	return &streamConn{Conn: conn, stream: s}
+}
+
+type streamConn struct {
+	net.Conn
+	stream *stream
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.stream.touch()
+	}
+	return n, err
+}
+
+func (c *streamConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.stream.touch()
+	}
+	return n, err
+}
+
+// streamWriter intercepte la réponse pour détecter les flux SSE et les
+// upgrades, et injecter des commentaires keepalive pendant les silences du
+// backend.
+type streamWriter struct {
+	http.ResponseWriter
+	proxy  *Proxy
+	stream *stream
+
+	mu        sync.Mutex
+	sse       bool
+	boundary  bool
+	lastWrite time.Time
+	finished  bool
+}
+
+var keepAliveComment = []byte(": keepalive\n\n")
+
+func (w *streamWriter) WriteHeader(code int) {
+	if code == http.StatusOK && isEventStream(w.Header().Get("Content-Type")) {
+		w.mu.Lock()
+		w.sse = true
+		w.boundary = true
+		w.lastWrite = time.Now()
+		w.mu.Unlock()
+		w.stream.start(streamSSE, w.ping)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *streamWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.ResponseWriter.Write(b)
+	if w.sse && n > 0 {
+		w.stream.touch()
+		w.lastWrite = time.Now()
+		w.boundary = bytes.HasSuffix(b[:n], []byte("\n\n")) || bytes.HasSuffix(b[:n], []byte("\r\n\r\n"))
+	}
+	return n, err
+}
+
+func (w *streamWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *streamWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	setKeepAlive(conn, w.proxy.opts.KeepAliveInterval)
+	w.stream.start(streamWebSocket, nil)
+	return w.stream.wrap(conn), brw, nil
+}
+
+func (w *streamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ping n'écrit un commentaire qu'entre deux événements complets, pour ne
+// jamais couper un événement que le backend est en train d'envoyer.
+func (w *streamWriter) ping() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.finished || !w.boundary || time.Since(w.lastWrite) < w.proxy.opts.KeepAliveInterval {
+		return
+	}
+	if _, err := w.ResponseWriter.Write(keepAliveComment); err != nil {
+		return
+	}
+	w.lastWrite = time.Now()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *streamWriter) stop() {
+	w.mu.Lock()
+	w.finished = true
+	w.mu.Unlock()
+}
+
+func isEventStream(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/event-stream"
+}
+
+func setKeepAlive(conn net.Conn, period time.Duration) {
+	if nc, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = nc.NetConn()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetKeepAlive(true)
+		tcp.SetKeepAlivePeriod(period)
+	}
+}
+
+type SiteStats struct {
+	WebSockets int64  // WebSocket ouvertes
+	SSE        int64  // Flux SSE ouverts
+	Upgrades   uint64 // Connexions upgradées depuis le démarrage
+
+	UpstreamErrors map[int]uint64 // Échecs vers le backend par code renvoyé (502, 503, 504)
+}
+
+type siteCounters struct {
+	webSockets atomic.Int64
+	sse        atomic.Int64
+	upgrades   atomic.Uint64
+
+	badGateway  atomic.Uint64
+	unavailable atomic.Uint64
+	timeouts    atomic.Uint64
+}
+
+func (c *siteCounters) upstreamError(status int) {
+	switch status {
+	case http.StatusServiceUnavailable:
+		c.unavailable.Add(1)
+	case http.StatusGatewayTimeout:
+		c.timeouts.Add(1)
+	default:
+		c.badGateway.Add(1)
+	}
+}
+
+var (
+	countersMu sync.Mutex
+	counters   = make(map[string]*siteCounters)
+)
+
+// Les compteurs sont partagés par nom de site pour survivre aux reloads,
+// pendant lesquels l'ancien et le nouveau proxy coexistent.
+func countersFor(site string) *siteCounters {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+	c, ok := counters[site]
+	if !ok {
+		c = &siteCounters{}
+		counters[site] = c
+	}
+	return c
+}
+
+func Stats() map[string]SiteStats {
+	countersMu.Lock()
+	defer countersMu.Unlock()
+	out := make(map[string]SiteStats, len(counters))
+	for site, c := range counters {
+		out[site] = SiteStats{
+			WebSockets: c.webSockets.Load(),
+			SSE:        c.sse.Load(),
+			Upgrades:   c.upgrades.Load(),
+			UpstreamErrors: map[int]uint64{
+				http.StatusBadGateway:         c.badGateway.Load(),
+				http.StatusServiceUnavailable: c.unavailable.Load(),
+				http.StatusGatewayTimeout:     c.timeouts.Load(),
+			},
+		}
+	}
+	return out
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	StatusCertError = 495 // Certificat client invalide, révoqué ou expiré
+	StatusNoCert    = 496 // Certificat client exigé mais absent
+
+	crlCheckInterval = 30 * time.Second
+)
+
+// En-têtes transmis au backend ; ceux envoyés par le client sont retirés.
+var clientCertHeaders = []string{
+	"X-SSL-Client-Verify",
+	"X-SSL-Client-S-DN",
+	"X-SSL-Client-I-DN",
+	"X-SSL-Client-Serial",
+	"X-SSL-Client-Fingerprint",
+}
+
+type ClientAuthOptions struct {
+	Mode      string              // "on" ou "optional", vide = désactivée
+	CAs       []*x509.Certificate // CA acceptées (ssl_client_certificate)
+	CRLFile   string              // Liste de révocation PEM ou DER, relue quand elle change
+	Locations []Location          // Locations qui exigent un certificat (VerifyClient)
+
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, status int)
+}
+
+// ClientAuth vérifie le certificat client demandé pendant la poignée de
+// main TLS : absent alors qu'exigé (site "on" ou location), la réponse est
+// 496 ; invalide ou révoqué, 495. Le certificat vérifié est décrit au
+// backend par les en-têtes X-SSL-Client-*. Les locations sont revérifiées
+// après rewrite par RequireClientCert.
+func ClientAuth(opts ClientAuthOptions, next http.Handler) http.Handler {
+	if opts.Mode == "" {
+		return next
+	}
+	roots := x509.NewCertPool()
+	for _, ca := range opts.CAs {
+		roots.AddCert(ca)
+	}
+	var crl *revocationList
+	if opts.CRLFile != "" {
+		crl = &revocationList{path: opts.CRLFile, cas: opts.CAs}
+	}
+	fail := opts.failure()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range clientCertHeaders {
+			r.Header.Del(name)
+		}
+
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			if opts.Mode == "on" || opts.locationRequires(r) {
+				fail(w, r, StatusNoCert)
+				return
+			}
+			r.Header.Set("X-SSL-Client-Verify", "NONE")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.PeerCertificates[0]
+		intermediates := x509.NewCertPool()
+		for _, c := range r.TLS.PeerCertificates[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err == nil && crl != nil && crl.revoked(cert) {
+			err = fmt.Errorf("certificat révoqué (%s)", opts.CRLFile)
+		}
+		if err != nil {
+			log.Printf("Certificat client refusé pour %s (%s) : %v", r.Host, cert.Subject, err)
+			fail(w, r, StatusCertError)
+			return
+		}
+
+		fingerprint := sha256.Sum256(cert.Raw)
+		r.Header.Set("X-SSL-Client-Verify", "SUCCESS")
+		r.Header.Set("X-SSL-Client-S-DN", cert.Subject.String())
+		r.Header.Set("X-SSL-Client-I-DN", cert.Issuer.String())
+		r.Header.Set("X-SSL-Client-Serial", fmt.Sprintf("%X", cert.SerialNumber))
+		r.Header.Set("X-SSL-Client-Fingerprint", hex.EncodeToString(fingerprint[:]))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientCertKey{}, true)))
+	})
+}
+
+// RequireClientCert refait le contrôle des locations ssl_verify_client on
+// sur l'URI finale, après rewrite : ClientAuth ne voit que l'URI reçue.
+func RequireClientCert(opts ClientAuthOptions, next http.Handler) http.Handler {
+	if opts.Mode != "optional" {
+		return next // "on" : certificat déjà exigé partout
+	}
+	fail := opts.failure()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if verified, _ := r.Context().Value(clientCertKey{}).(bool); !verified && opts.locationRequires(r) {
+			fail(w, r, StatusNoCert)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientCertKey marque dans le contexte une requête au certificat vérifié.
+type clientCertKey struct{}
+
+// locationRequires cherche la location sur le chemin nettoyé, comme le
+// verront les fichiers statiques et le backend (//admin, /./admin).
+func (o ClientAuthOptions) locationRequires(r *http.Request) bool {
+	loc := matchLocation(o.Locations, path.Clean("/"+r.URL.Path))
+	return loc != nil && loc.VerifyClient
+}
+
+func (o ClientAuthOptions) failure() func(w http.ResponseWriter, r *http.Request, status int) {
+	if o.ErrorHandler != nil {
+		return o.ErrorHandler
+	}
+	return func(w http.ResponseWriter, r *http.Request, status int) {
+		http.Error(w, "Certificat client refusé", status)
+	}
+}
+
+// LoadCRL lit une liste de révocation PEM ou DER et vérifie qu'elle est
+// signée par l'une des CA.
+func LoadCRL(path string, cas []*x509.Certificate) (*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("lecture %s : %v", path, err)
+	}
+	for _, ca := range cas {
+		if list.CheckSignatureFrom(ca) == nil {
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("%s n'est signée par aucune des CA clientes", path)
+}
+
+// revocationList garde la CRL en mémoire et la relit quand le fichier
+// change ; une nouvelle version illisible laisse l'ancienne en place.
+type revocationList struct {
+	path string
+	cas  []*x509.Certificate
+
+	mu      sync.Mutex
+	checked time.Time
+	modTime time.Time
+	issuer  []byte
+	serials map[string]bool
+}
+
+func (l *revocationList) revoked(cert *x509.Certificate) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.checked) > crlCheckInterval {
+		l.checked = time.Now()
+		l.reload()
+	}
+	if l.serials == nil {
+		return true // Aucune CRL lisible : refus par prudence
+	}
+	return string(cert.RawIssuer) == string(l.issuer) && l.serials[cert.SerialNumber.String()]
+}
+
+func (l *revocationList) reload() {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		log.Printf("CRL %s : %v", l.path, err)
+		return
+	}
+	if info.ModTime().Equal(l.modTime) {
+		return
+	}
+	list, err := LoadCRL(l.path, l.cas)
+	if err != nil {
+		log.Printf("CRL %s ignorée : %v", l.path, err)
+		return
+	}
+	l.modTime = info.ModTime()
+	l.issuer = list.RawIssuer
+	l.serials = make(map[string]bool, len(list.RevokedCertificateEntries))
+	for _, entry := range list.RevokedCertificateEntries {
+		l.serials[entry.SerialNumber.String()] = true
+	}
+}
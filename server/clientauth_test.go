@@ -0,0 +1,124 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// testClientCert crée une CA et un certificat client signé par elle.
+func testClientCert(t *testing.T) (*x509.Certificate, *x509.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CA de test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTpl, caTpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return ca, cert
+}
+
+func TestClientAuthLocations(t *testing.T) {
+	ca, cert := testClientCert(t)
+	locations := []Location{
+		{Prefix: "/admin", VerifyClient: true},
+		{Prefix: "/public"},
+	}
+	opts := ClientAuthOptions{Mode: "optional", CAs: []*x509.Certificate{ca}, Locations: locations}
+	rewrite := RewriteOptions{
+		Rules: []RewriteRule{
+			{Pattern: regexp.MustCompile(`^/x/(.*)$`), Replacement: "/admin/$1"},
+		},
+		Locations: locations,
+	}
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-SSL-Client-Verify")))
+	})
+	handler := ClientAuth(opts, Rewrite(rewrite, RequireClientCert(opts, backend)))
+
+	tests := []struct {
+		name   string
+		target string
+		cert   bool
+		status int
+	}{
+		{"location protégée", "/admin/page", false, StatusNoCert},
+		{"préfixe exact", "/admin", false, StatusNoCert},
+		{"point", "/./admin/page", false, StatusNoCert},
+		{"double barre", "//admin/page", false, StatusNoCert},
+		{"remontée", "/public/../admin/page", false, StatusNoCert},
+		{"rewrite vers la location", "/x/page", false, StatusNoCert},
+		{"location libre", "/public/page", false, http.StatusOK},
+		{"préfixe voisin", "/administration", false, http.StatusOK},
+		{"certificat valide", "/admin/page", true, http.StatusOK},
+		{"certificat valide après rewrite", "/x/page", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://exemple.com/", nil)
+			req.URL.Path = tt.target
+			req.TLS = &tls.ConnectionState{}
+			if tt.cert {
+				req.TLS.PeerCertificates = []*x509.Certificate{cert}
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("%s : statut %d, attendu %d", tt.target, rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestClientAuthStripsClientHeaders(t *testing.T) {
+	ca, _ := testClientCert(t)
+	opts := ClientAuthOptions{Mode: "optional", CAs: []*x509.Certificate{ca}}
+	handler := ClientAuth(opts, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-SSL-Client-Verify") + "|" + r.Header.Get("X-SSL-Client-S-DN")))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "https://exemple.com/", nil)
+	req.TLS = &tls.ConnectionState{}
+	req.Header.Set("X-SSL-Client-Verify", "SUCCESS")
+	req.Header.Set("X-SSL-Client-S-DN", "CN=admin")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Body.String(); got != "NONE|" {
+		t.Errorf("en-têtes transmis : %q, attendu %q", got, "NONE|")
+	}
+}
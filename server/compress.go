@@ -0,0 +1,358 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultCompressionLevel     = 5
+	defaultCompressionMinLength = 256
+)
+
+// Types compressés quand compression_types n'est pas précisé.
+var defaultCompressionTypes = []string{
+	"text/html", "text/css", "text/plain", "text/xml", "text/javascript",
+	"application/javascript", "application/json", "application/xml",
+	"application/manifest+json", "application/rss+xml", "application/atom+xml",
+	"application/wasm", "image/svg+xml",
+}
+
+// Ordre de préférence à qualité égale dans Accept-Encoding.
+var compressionEncodings = []string{"br", "zstd", "gzip"}
+
+type CompressOptions struct {
+	Types     []string // Types MIME compressés, "text/*" accepté (défaut : texte, JSON, JS, SVG...)
+	MinLength int      // Taille minimale en octets d'une réponse compressée
+	Level     int      // Niveau de compression 1-9 (brotli jusqu'à 11)
+}
+
+// Compress compresse à la volée les réponses des types configurés en gzip,
+// br ou zstd selon Accept-Encoding. Les réponses déjà encodées, partielles ou
+// trop courtes passent telles quelles ; les corps streamés par le proxy sont
+// compressés au fil de l'eau et vidés à chaque Flush.
+func Compress(opts CompressOptions) gin.HandlerFunc {
+	if len(opts.Types) == 0 {
+		opts.Types = defaultCompressionTypes
+	}
+	if opts.MinLength <= 0 {
+		opts.MinLength = defaultCompressionMinLength
+	}
+	if opts.Level <= 0 {
+		opts.Level = defaultCompressionLevel
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead || c.Request.Header.Get("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{
+			ResponseWriter: c.Writer,
+			opts:           &opts,
+			encoding:       negotiateEncoding(c.Request),
+		}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// compressWriter retient l'en-tête et les premiers octets de la réponse
+// jusqu'à pouvoir décider de la compresser : Content-Length connu, MinLength
+// octets reçus, premier Flush ou fin du handler.
+type compressWriter struct {
+	gin.ResponseWriter
+	opts     *CompressOptions
+	encoding string // Encodage négocié, "" si le client n'en accepte aucun
+
+	status      int
+	wroteHeader bool // WriteHeaderNow appelé par gin avant tout octet
+	decided     bool
+	buf         []byte
+	enc         encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	w.wroteHeader = true
+}
+
+func (w *compressWriter) Status() int {
+	if !w.decided && w.status != 0 {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *compressWriter) Written() bool {
+	return w.decided || w.wroteHeader || len(w.buf) > 0
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.opts.MinLength && w.Header().Get("Content-Length") == "" {
+			return len(p), nil
+		}
+		if err := w.decide(false); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush marque une réponse streamée : elle est compressée même si les
+// premiers octets sont sous MinLength, puisque la suite arrive.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide fixe les en-têtes, envoie le statut puis le début du corps retenu.
+// final indique que le handler a terminé : le corps retenu est complet.
+func (w *compressWriter) decide(final bool) error {
+	w.decided = true
+	if w.status == 0 {
+		// Statut préréglé par gin (404 des routes inconnues) ou 200.
+		w.status = w.ResponseWriter.Status()
+	}
+
+	h := w.Header()
+	if w.compressible(final) {
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", w.encoding)
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.enc = getEncoder(w.encoding, w.opts.Level, w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// compressible ajoute Vary: Accept-Encoding dès que la réponse pourrait être
+// compressée, même si ce client-ci ne l'accepte pas, pour ne pas empoisonner
+// les caches intermédiaires.
+func (w *compressWriter) compressible(final bool) bool {
+	if w.status < 200 || w.status >= 300 || w.status == http.StatusNoContent || w.status == http.StatusPartialContent {
+		return false
+	}
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(h.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+
+	ctype := h.Get("Content-Type")
+	if ctype == "" && len(w.buf) > 0 {
+		// Même détection que net/http, faite ici pour décider sur le bon type.
+		ctype = http.DetectContentType(w.buf)
+		h.Set("Content-Type", ctype)
+	}
+	if !matchMediaType(w.opts.Types, ctype) {
+		return false
+	}
+
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil && n < int64(w.opts.MinLength) {
+			return false
+		}
+	} else if final && len(w.buf) < w.opts.MinLength {
+		return false
+	}
+
+	addVary(h, "Accept-Encoding")
+	return w.encoding != ""
+}
+
+func (w *compressWriter) finish() {
+	if !w.decided && !w.Written() && w.status == 0 {
+		// Rien d'écrit : gin termine la réponse lui-même.
+		return
+	}
+	if !w.decided {
+		w.decide(true)
+	}
+	if w.enc != nil {
+		w.enc.Close()
+		putEncoder(w.encoding, w.opts.Level, w.enc)
+		w.enc = nil
+	}
+}
+
+func matchMediaType(types []string, ctype string) bool {
+	media, _, _ := strings.Cut(ctype, ";")
+	media = strings.ToLower(strings.TrimSpace(media))
+	if media == "" {
+		return false
+	}
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == "*" || t == media {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(media, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, token := range strings.Split(v, ",") {
+			token = strings.TrimSpace(token)
+			if token == "*" || strings.EqualFold(token, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// negotiateEncoding choisit l'encodage de plus haute qualité accepté par le
+// client, br puis zstd puis gzip à qualité égale.
+func negotiateEncoding(r *http.Request) string {
+	q := make(map[string]float64)
+	wildcard := -1.0
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			weight := 1.0
+			if s, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				f, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					continue
+				}
+				weight = f
+			}
+			if name == "*" {
+				wildcard = weight
+			} else if name != "" {
+				q[name] = weight
+			}
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range compressionEncodings {
+		weight, ok := q[enc]
+		if !ok {
+			weight = wildcard
+		}
+		if weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var (
+	encodersMu sync.Mutex
+	encoders   = make(map[string]*sync.Pool)
+)
+
+func encoderPool(encoding string, level int) *sync.Pool {
+	key := encoding + "/" + strconv.Itoa(level)
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	pool, ok := encoders[key]
+	if !ok {
+		pool = &sync.Pool{New: func() any { return newEncoder(encoding, level) }}
+		encoders[key] = pool
+	}
+	return pool
+}
+
+func getEncoder(encoding string, level int, w io.Writer) encoder {
+	enc := encoderPool(encoding, level).Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+func putEncoder(encoding string, level int, enc encoder) {
+	enc.Reset(io.Discard)
+	encoderPool(encoding, level).Put(enc)
+}
+
+func newEncoder(encoding string, level int) encoder {
+	switch encoding {
+	case "br":
+		return brotli.NewWriterLevel(io.Discard, min(level, brotli.BestCompression))
+	case "zstd":
+		// Fenêtre limitée à 8 Mo, le maximum garanti par les navigateurs.
+		enc, _ := zstd.NewWriter(io.Discard,
+			zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(8<<20),
+			zstd.WithLowerEncoderMem(true))
+		return enc
+	}
+	enc, _ := gzip.NewWriterLevel(io.Discard, min(level, gzip.BestCompression))
+	return enc
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultCorsMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+type CorsPolicy struct {
+	Origins     []string      // Origines exactes, jokers (https://*.exemple.com), regex (~^https://...$) ou *
+	Methods     []string      // Méthodes autorisées (défaut : GET, HEAD, POST, PUT, PATCH, DELETE)
+	Headers     []string      // En-têtes autorisés, vide = ceux demandés par le navigateur
+	Expose      []string      // En-têtes lisibles par le JavaScript
+	Credentials bool          // Cookies et Authorization autorisés
+	MaxAge      time.Duration // Durée de cache du preflight
+
+	patterns []*regexp.Regexp
+}
+
+type CorsOptions struct {
+	Policy    *CorsPolicy // cors du site, nil = aucun
+	Locations []Location  // cors des locations, prioritaires sur celui du site
+}
+
+// Cors répond aux preflight OPTIONS sans solliciter le backend et ajoute les
+// en-têtes Access-Control-* aux réponses des origines autorisées, en
+// remplaçant ceux que le backend aurait déjà posés.
+func Cors(opts CorsOptions, next http.Handler) http.Handler {
+	enabled := opts.Policy != nil
+	opts.Policy.compile()
+	for _, loc := range opts.Locations {
+		if loc.Cors != nil {
+			enabled = true
+			loc.Cors.compile()
+		}
+	}
+	if !enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := opts.Policy
+		if loc := matchLocation(opts.Locations, r.URL.Path); loc != nil && loc.Cors != nil {
+			policy = loc.Cors
+		}
+		if policy == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		if r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+			policy.preflight(w, r, origin)
+			return
+		}
+
+		next.ServeHTTP(&hookWriter{ResponseWriter: w, before: func(int) {
+			policy.apply(w.Header(), origin)
+		}}, r)
+	})
+}
+
+func (p *CorsPolicy) compile() {
+	if p == nil || p.patterns != nil {
+		return
+	}
+	p.patterns = []*regexp.Regexp{}
+	for _, origin := range p.Origins {
+		if expr, ok := strings.CutPrefix(origin, "~"); ok {
+			if re, err := regexp.Compile(expr); err == nil {
+				p.patterns = append(p.patterns, re)
+			}
+		}
+	}
+}
+
+func (p *CorsPolicy) allows(origin string) bool {
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	for _, allowed := range p.Origins {
+		// Avec credentials, "*" n'autorise aucune origine : elle serait renvoyée telle quelle.
+		if (allowed == "*" && !p.Credentials) || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// https://*.exemple.com : au moins un sous-domaine, sans changer de schéma.
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok && !strings.HasPrefix(allowed, "~") {
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+				!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *CorsPolicy) wildcard() bool {
+	if p.Credentials {
+		return false
+	}
+	for _, allowed := range p.Origins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// apply remplace les en-têtes CORS de la réponse. Avec credentials, seule
+// une origine explicitement autorisée est renvoyée, jamais "*".
+func (p *CorsPolicy) apply(h http.Header, origin string) {
+	for name := range h {
+		if strings.HasPrefix(name, "Access-Control-") {
+			h.Del(name)
+		}
+	}
+	if p.wildcard() {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		addVary(h, "Origin")
+		if origin == "" || !p.allows(origin) {
+			return
+		}
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(p.Expose) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(p.Expose, ", "))
+	}
+}
+
+func (p *CorsPolicy) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	addVary(h, "Origin")
+	addVary(h, "Access-Control-Request-Method")
+	addVary(h, "Access-Control-Request-Headers")
+
+	// Refus : 204 sans en-têtes CORS, le navigateur bloque la requête.
+	if !p.allows(origin) || !p.allowsMethod(r.Header.Get("Access-Control-Request-Method")) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	requested := r.Header.Get("Access-Control-Request-Headers")
+	if len(p.Headers) > 0 && !p.allowsHeaders(requested) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if p.wildcard() {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = defaultCorsMethods
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(p.Headers) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(p.Headers, ", "))
+	} else if requested != "" {
+		h.Set("Access-Control-Allow-Headers", requested)
+	}
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *CorsPolicy) allowsMethod(method string) bool {
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = defaultCorsMethods
+	}
+	for _, m := range methods {
+		if m == "*" || strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CorsPolicy) allowsHeaders(requested string) bool {
+	for _, name := range strings.Split(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		ok := false
+		for _, allowed := range p.Headers {
+			if allowed == "*" || strings.EqualFold(allowed, name) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCorsWildcardWithCredentials(t *testing.T) {
+	policy := &CorsPolicy{Origins: []string{"*", "https://app.exemple.com"}, Credentials: true}
+	handler := Cors(CorsOptions{Policy: policy}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	tests := []struct {
+		origin string
+		want   string
+	}{
+		{"https://app.exemple.com", "https://app.exemple.com"},
+		{"https://pirate.exemple", ""},
+	}
+	for _, tt := range tests {
+		for _, method := range []string{http.MethodGet, http.MethodOptions} {
+			req := httptest.NewRequest(method, "/", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Errorf("%s %s : Access-Control-Allow-Origin %q, attendu %q", method, tt.origin, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	fileCacheMaxEntries = 10000
+	// Durée de validité d'une entrée : courte sans fsnotify, plus longue
+	// sinon, comme filet de sécurité si un événement est manqué.
+	fileCacheTTL        = 5 * time.Second
+	fileCacheWatchedTTL = time.Minute
+	etagHashMaxFileSize = 64 << 20
+)
+
+type cachedFile struct {
+	info    os.FileInfo // nil si le fichier n'existe pas
+	etag    string
+	checked time.Time
+}
+
+// fileCache garde en mémoire le résultat des stat et l'ETag des fichiers
+// servis. Les dossiers concernés sont surveillés par fsnotify, qui invalide
+// les entrées à chaque modification.
+type fileCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedFile
+	watcher *fsnotify.Watcher
+	watched map[string]bool
+}
+
+var (
+	filesOnce sync.Once
+	files     *fileCache
+)
+
+func sharedFileCache() *fileCache {
+	filesOnce.Do(func() {
+		files = &fileCache{
+			entries: make(map[string]*cachedFile),
+			watched: make(map[string]bool),
+		}
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Printf("fsnotify indisponible, cache des fichiers statiques limité à %s : %v", fileCacheTTL, err)
+			return
+		}
+		files.watcher = w
+		go files.watch()
+	})
+	return files
+}
+
+func (fc *fileCache) watch() {
+	for {
+		select {
+		case ev, ok := <-fc.watcher.Events:
+			if !ok {
+				return
+			}
+			fc.invalidate(ev.Name)
+		case err, ok := <-fc.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Erreur fsnotify cache fichiers statiques : %v", err)
+			fc.mu.Lock()
+			fc.entries = make(map[string]*cachedFile)
+			fc.mu.Unlock()
+		}
+	}
+}
+
+func (fc *fileCache) invalidate(name string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	prefix := name + string(filepath.Separator)
+	for key := range fc.entries {
+		if key == name || strings.HasPrefix(key, prefix) {
+			delete(fc.entries, key)
+		}
+	}
+	if fc.watched[name] {
+		if _, err := os.Stat(name); err != nil {
+			delete(fc.watched, name)
+		}
+	}
+}
+
+// forget oublie les entrées et surveillances de dir, dont la cible a changé
+// (lien symbolique basculé, dossier remplacé) : fsnotify suit l'ancien dossier.
+func (fc *fileCache) forget(dir string) {
+	fc.invalidate(dir)
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	prefix := dir + string(filepath.Separator)
+	for name := range fc.watched {
+		if name == dir || strings.HasPrefix(name, prefix) {
+			fc.watcher.Remove(name)
+			delete(fc.watched, name)
+		}
+	}
+}
+
+// stat renvoie les informations d'un fichier (info nil s'il n'existe pas ou
+// sort de root). file est le chemin absolu servant de clef et surveillé par
+// fsnotify, rel le même chemin relatif à root.
+func (fc *fileCache) stat(root *os.Root, file, rel string) *cachedFile {
+	fc.mu.Lock()
+	// TTL long seulement si fsnotify surveille vraiment le dossier (absent ou
+	// non surveillable : un fichier créé doit apparaître vite).
+	ttl := fileCacheTTL
+	if fc.watched[filepath.Dir(file)] {
+		ttl = fileCacheWatchedTTL
+	}
+	if e, ok := fc.entries[file]; ok && time.Since(e.checked) < ttl {
+		fc.mu.Unlock()
+		return e
+	}
+	fc.mu.Unlock()
+
+	e := &cachedFile{checked: time.Now()}
+	if info, err := root.Stat(rel); err == nil {
+		e.info = info
+		if !info.IsDir() {
+			e.etag = computeETag(root, rel, info)
+		}
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.entries) >= fileCacheMaxEntries {
+		fc.entries = make(map[string]*cachedFile)
+	}
+	fc.entries[file] = e
+	fc.watchDir(filepath.Dir(file))
+	return e
+}
+
+func (fc *fileCache) watchDir(dir string) {
+	if fc.watcher == nil || fc.watched[dir] {
+		return
+	}
+	if err := fc.watcher.Add(dir); err != nil {
+		return
+	}
+	fc.watched[dir] = true
+}
+
+// computeETag produit un ETag fort à partir du contenu. Au-delà de
+// etagHashMaxFileSize, taille et date de modification suffisent.
+func computeETag(root *os.Root, rel string, info os.FileInfo) string {
+	if info.Size() > etagHashMaxFileSize {
+		return `"` + strconv.FormatInt(info.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(info.Size(), 36) + `"`
+	}
+	f, err := root.Open(rel)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil))[:20] + `"`
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCacheTTLUnwatchedDir(t *testing.T) {
+	base := t.TempDir()
+	root, err := os.OpenRoot(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	fc := sharedFileCache()
+	if fc.watcher == nil {
+		t.Skip("fsnotify indisponible")
+	}
+	file := filepath.Join(base, "absent", "page.html")
+
+	// Dossier absent : fsnotify ne peut pas le surveiller.
+	if e := fc.stat(root, file, "absent/page.html"); e.info != nil {
+		t.Fatal("fichier trouvé avant création")
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("page"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fc.mu.Lock()
+	fc.entries[file].checked = time.Now().Add(-fileCacheTTL - time.Second)
+	fc.mu.Unlock()
+	if e := fc.stat(root, file, "absent/page.html"); e.info == nil {
+		t.Errorf("fichier créé dans un dossier non surveillé encore absent après %s", fileCacheTTL)
+	}
+
+	// Dossier surveillé : l'entrée reste valable au-delà de fileCacheTTL.
+	fc.mu.Lock()
+	watched := fc.watched[filepath.Dir(file)]
+	fc.entries[file].checked = time.Now().Add(-fileCacheTTL - time.Second)
+	cached := fc.entries[file]
+	fc.mu.Unlock()
+	if !watched {
+		t.Fatal("dossier créé non surveillé")
+	}
+	if e := fc.stat(root, file, "absent/page.html"); e != cached {
+		t.Error("entrée d'un dossier surveillé relue avant fileCacheWatchedTTL")
+	}
+}
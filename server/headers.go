@@ -0,0 +1,168 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+const SecurityStrict = "strict"
+
+// Préréglage security_headers strict. Les en-têtes déjà fournis par le
+// backend sont conservés ; add_header et remove_header priment.
+var strictSecurityHeaders = []HeaderRule{
+	{Name: "Strict-Transport-Security", Value: "max-age=63072000; includeSubDomains"},
+	{Name: "Content-Security-Policy", Value: "default-src 'self'; img-src 'self' data:; style-src 'self' 'unsafe-inline'; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"},
+	{Name: "X-Content-Type-Options", Value: "nosniff"},
+	{Name: "Referrer-Policy", Value: "strict-origin-when-cross-origin"},
+	{Name: "Permissions-Policy", Value: "camera=(), microphone=(), geolocation=(), payment=(), usb=()"},
+	{Name: "X-Frame-Options", Value: "DENY"},
+}
+
+type HeaderRule struct {
+	Name   string // Nom de l'en-tête
+	Value  string // Valeur, peut contenir des variables ; vide = suppression
+	Always bool   // Aussi sur les réponses d'erreur (4xx, 5xx)
+}
+
+type HeaderOptions struct {
+	Add       []HeaderRule // add_header, remplace la valeur existante
+	Remove    []string     // remove_header
+	Security  string       // security_headers : SecurityStrict ou "" (aucun)
+	Locations []Location   // add_header/remove_header des locations, appliqués après ceux du site
+}
+
+func (o HeaderOptions) empty() bool {
+	if len(o.Add) > 0 || len(o.Remove) > 0 || o.Security != "" {
+		return false
+	}
+	for _, loc := range o.Locations {
+		if len(loc.AddHeaders) > 0 || len(loc.RemoveHeaders) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Headers applique add_header, remove_header et security_headers à toutes
+// les réponses du site, juste avant l'envoi du statut.
+func Headers(opts HeaderOptions, next http.Handler) http.Handler {
+	if opts.empty() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loc := matchLocation(opts.Locations, r.URL.Path)
+		next.ServeHTTP(&hookWriter{ResponseWriter: w, before: func(status int) {
+			applyHeaders(w.Header(), r, &opts, loc, status)
+		}}, r)
+	})
+}
+
+// hookWriter appelle before juste avant l'envoi d'un statut final, quand
+// les en-têtes de la réponse sont encore modifiables.
+type hookWriter struct {
+	http.ResponseWriter
+	before      func(status int)
+	wroteHeader bool
+}
+
+func (w *hookWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= 200 {
+		w.wroteHeader = true
+		w.before(code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *hookWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *hookWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *hookWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *hookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func applyHeaders(h http.Header, r *http.Request, opts *HeaderOptions, loc *Location, status int) {
+	removed := make(map[string]bool)
+	remove := func(names []string) {
+		for _, name := range names {
+			h.Del(name)
+			removed[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	remove(opts.Remove)
+	if loc != nil {
+		remove(loc.RemoveHeaders)
+	}
+
+	vars := Vars{Request: r}
+	rules := opts.Add
+	if loc != nil {
+		rules = append(rules[:len(rules):len(rules)], loc.AddHeaders...)
+	}
+
+	// Un add_header sur un en-tête du préréglage le remplace, y compris sur
+	// les réponses d'erreur.
+	overridden := make(map[string]bool)
+	if opts.Security == SecurityStrict {
+		preset := make(map[string]bool, len(strictSecurityHeaders))
+		for _, rule := range strictSecurityHeaders {
+			preset[rule.Name] = true
+		}
+		for _, rule := range rules {
+			if name := http.CanonicalHeaderKey(rule.Name); preset[name] {
+				overridden[name] = true
+			}
+		}
+		for _, rule := range strictSecurityHeaders {
+			if removed[rule.Name] || overridden[rule.Name] || h.Get(rule.Name) != "" {
+				continue
+			}
+			if rule.Name == "Strict-Transport-Security" && r.TLS == nil {
+				// HSTS n'a de sens qu'en HTTPS, les navigateurs l'ignorent sinon.
+				continue
+			}
+			h.Set(rule.Name, rule.Value)
+		}
+	}
+
+	for _, rule := range rules {
+		if !rule.Always && !overridden[http.CanonicalHeaderKey(rule.Name)] && !headerStatus(status) {
+			continue
+		}
+		value := vars.Expand(rule.Value)
+		if value == "" {
+			h.Del(rule.Name)
+			continue
+		}
+		h.Set(rule.Name, value)
+	}
+}
+
+// headerStatus reprend la liste de nginx : sans always, add_header ne vaut
+// que pour ces codes.
+func headerStatus(status int) bool {
+	switch status {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent, http.StatusPartialContent,
+		http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusNotModified,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
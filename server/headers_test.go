@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	opts := HeaderOptions{
+		Add: []HeaderRule{
+			{Name: "X-Served-By", Value: "$host", Always: true},
+			{Name: "X-Frame-Options", Value: "SAMEORIGIN"},
+			{Name: "X-Build", Value: "42"},
+			{Name: "X-Debug", Value: ""},
+		},
+		Remove:   []string{"X-Powered-By"},
+		Security: SecurityStrict,
+		Locations: []Location{
+			{Prefix: "/embed", RemoveHeaders: []string{"Content-Security-Policy"}, AddHeaders: []HeaderRule{{Name: "X-Build", Value: "embed"}}},
+		},
+	}
+	// Le backend pose déjà certains en-têtes.
+	backend := func(status int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Powered-By", "Express")
+			w.Header().Set("X-Debug", "1")
+			w.Header().Set("Referrer-Policy", "no-referrer")
+			w.WriteHeader(status)
+		})
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		https  bool
+		want   map[string]string // "" = absent
+	}{
+		{"réponse 200", "/", http.StatusOK, false, map[string]string{
+			"X-Served-By":               "exemple.com",
+			"X-Frame-Options":           "SAMEORIGIN", // add_header remplace le préréglage
+			"X-Build":                   "42",
+			"X-Debug":                   "",
+			"X-Powered-By":              "",
+			"Referrer-Policy":           "no-referrer", // Valeur du backend conservée
+			"X-Content-Type-Options":    "nosniff",
+			"Strict-Transport-Security": "", // Seulement en HTTPS
+		}},
+		{"HTTPS", "/", http.StatusOK, true, map[string]string{
+			"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+		}},
+		{"erreur sans always", "/", http.StatusInternalServerError, false, map[string]string{
+			"X-Served-By":            "exemple.com",
+			"X-Build":                "",
+			"X-Frame-Options":        "SAMEORIGIN", // Remplacement du préréglage, même en erreur
+			"X-Content-Type-Options": "nosniff",
+		}},
+		{"location", "/embed/widget", http.StatusOK, false, map[string]string{
+			"Content-Security-Policy": "",
+			"X-Build":                 "embed",
+			"X-Served-By":             "exemple.com",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://exemple.com"+tt.target, nil)
+			if tt.https {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+			Headers(opts, backend(tt.status)).ServeHTTP(rec, req)
+			for name, want := range tt.want {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s : %q, attendu %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHeadersDisabled(t *testing.T) {
+	next := http.NotFoundHandler()
+	if h := Headers(HeaderOptions{}, next); h == nil {
+		t.Fatal("handler nil")
+	}
+	rec := httptest.NewRecorder()
+	Headers(HeaderOptions{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Powered-By", "Express")
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("X-Powered-By") != "Express" || rec.Header().Get("X-Content-Type-Options") != "" {
+		t.Errorf("en-têtes modifiés sans directive : %v", rec.Header())
+	}
+}
@@ -0,0 +1,10 @@
+package server
+
+import "github.com/gin-gonic/gin"
+
+func PoweredBy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Set("X-Powered-By", "Goinx")
+		c.Next()
+	}
+}
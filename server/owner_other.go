@@ -0,0 +1,10 @@
+//go:build !unix
+
+package server
+
+import "io/fs"
+
+// Sans notion de propriétaire, if_not_owner refuse tous les liens.
+func fileOwner(info fs.FileInfo) (uint32, bool) {
+	return 0, false
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadRedirects lit un fichier redirects_file : une redirection par ligne,
+// "<chemin> <destination> [code]", code 301 par défaut. Les lignes vides et
+// commençant par # sont ignorées ; un ";" final est toléré (format map nginx).
+func LoadRedirects(path string) (map[string]Redirect, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	redirects := make(map[string]Redirect)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Fields(strings.TrimSuffix(line, ";"))
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("%s ligne %d : attendu \"<chemin> <destination> [code]\"", path, n)
+		}
+		redirect := Redirect{To: parts[1], Code: http.StatusMovedPermanently}
+		if len(parts) == 3 {
+			code, err := strconv.Atoi(parts[2])
+			if err != nil || code < 300 || code > 399 {
+				return nil, fmt.Errorf("%s ligne %d : code de redirection invalide %s", path, n, parts[2])
+			}
+			redirect.Code = code
+		}
+		redirects[parts[0]] = redirect
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return redirects, nil
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type requestInfoKey struct{}
+
+// RequestInfo accompagne une requête dans son contexte : le proxy y note ce
+// qu'il sait de l'upstream, le log d'accès le relit à la fin de la requête.
+type RequestInfo struct {
+	ID    string    // Identifiant de requête (X-Request-ID)
+	Start time.Time // Réception de la requête
+
+	mu                 sync.Mutex
+	upstreamAddr       string
+	upstreamStatus     int
+	upstreamHeaderTime time.Duration
+	upstreamTime       time.Duration
+}
+
+type UpstreamInfo struct {
+	Addr       string        // host:port du backend
+	Status     int           // Code renvoyé par le backend, 0 si pas de réponse
+	HeaderTime time.Duration // Délai jusqu'aux en-têtes du backend
+	Time       time.Duration // Délai jusqu'à la fin du corps
+}
+
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom renvoie les informations de la requête, nil hors d'un log
+// d'accès.
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+func (i *RequestInfo) SetUpstream(addr string, status int, headerTime time.Duration) {
+	i.mu.Lock()
+	i.upstreamAddr = addr
+	i.upstreamStatus = status
+	i.upstreamHeaderTime = headerTime
+	i.upstreamTime = headerTime
+	i.mu.Unlock()
+}
+
+func (i *RequestInfo) SetUpstreamTime(d time.Duration) {
+	i.mu.Lock()
+	i.upstreamTime = d
+	i.mu.Unlock()
+}
+
+func (i *RequestInfo) Upstream() UpstreamInfo {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return UpstreamInfo{
+		Addr:       i.upstreamAddr,
+		Status:     i.upstreamStatus,
+		HeaderTime: i.upstreamHeaderTime,
+		Time:       i.upstreamTime,
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	RewriteLast      = "last"      // Relance la recherche de location avec la nouvelle URI
+	RewriteBreak     = "break"     // Arrête toute réécriture
+	RewriteRedirect  = "redirect"  // Redirection 302
+	RewritePermanent = "permanent" // Redirection 301
+
+	// Nombre max de relances "last", comme nginx, contre les boucles.
+	maxRewriteCycles = 10
+
+	// return 444 : fermeture de la connexion sans réponse.
+	statusCloseConnection = 444
+)
+
+// RewriteRule est une directive rewrite (Pattern non nil) ou return.
+type RewriteRule struct {
+	Pattern     *regexp.Regexp // rewrite : regex sur l'URI
+	Replacement string         // rewrite : nouvelle URI ; return : URL ou texte
+	Flag        string         // rewrite : last, break, redirect, permanent ou "" (règle suivante)
+	Code        int            // return : code HTTP
+}
+
+type Redirect struct {
+	To   string // Destination, peut contenir des variables
+	Code int    // 301 par défaut
+}
+
+type RewriteOptions struct {
+	Rules        []RewriteRule       // rewrite/return au niveau du site, évalués une fois
+	Locations    []Location          // rewrite/return des locations
+	Redirects    map[string]Redirect // redirects_file : chemin exact -> destination
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, status int)
+}
+
+func (o RewriteOptions) empty() bool {
+	if len(o.Rules) > 0 || len(o.Redirects) > 0 {
+		return false
+	}
+	for _, loc := range o.Locations {
+		if len(loc.Rewrites) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Rewrite applique redirects_file puis les rewrite/return du site et des
+// locations avant le routage : next reçoit la requête avec l'URI réécrite.
+func Rewrite(opts RewriteOptions, next http.Handler) http.Handler {
+	if opts.empty() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if redirect, ok := opts.lookupRedirect(r.URL.Path); ok {
+			target := Vars{Request: r}.Expand(redirect.To)
+			http.Redirect(w, r, target, redirect.Code)
+			return
+		}
+
+		rw := &rewriter{opts: opts, w: w, r: r}
+		if rw.apply(opts.Rules) && !rw.done {
+			rw.restart = false
+			for cycle := 0; ; cycle++ {
+				if cycle == maxRewriteCycles {
+					log.Printf("Boucle de réécriture pour %s%s", r.Host, r.URL.Path)
+					rw.error(http.StatusInternalServerError)
+					return
+				}
+				loc := matchLocation(opts.Locations, rw.r.URL.Path)
+				if loc == nil || len(loc.Rewrites) == 0 {
+					break
+				}
+				path := rw.r.URL.Path
+				if !rw.apply(loc.Rewrites) || rw.done || !rw.restart || rw.r.URL.Path == path {
+					break
+				}
+				rw.restart = false
+			}
+		}
+		if rw.done {
+			return
+		}
+		next.ServeHTTP(w, rw.r)
+	})
+}
+
+func (o RewriteOptions) lookupRedirect(path string) (Redirect, bool) {
+	if len(o.Redirects) == 0 {
+		return Redirect{}, false
+	}
+	if redirect, ok := o.Redirects[path]; ok {
+		return redirect, true
+	}
+	if trimmed := strings.TrimSuffix(path, "/"); trimmed != path && trimmed != "" {
+		redirect, ok := o.Redirects[trimmed]
+		return redirect, ok
+	}
+	return Redirect{}, false
+}
+
+type rewriter struct {
+	opts    RewriteOptions
+	w       http.ResponseWriter
+	r       *http.Request
+	done    bool // Réponse envoyée (return, redirection)
+	restart bool // Flag last rencontré
+}
+
+// apply évalue une liste de règles. Le retour est faux quand la réécriture
+// doit s'arrêter là (break, redirection, return).
+func (rw *rewriter) apply(rules []RewriteRule) bool {
+	for _, rule := range rules {
+		if rule.Pattern == nil {
+			rw.respond(rule)
+			return false
+		}
+
+		m := rule.Pattern.FindStringSubmatch(rw.r.URL.Path)
+		if m == nil {
+			continue
+		}
+		target := Vars{Request: rw.r, Captures: m}.Expand(rule.Replacement)
+
+		external := strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+		switch {
+		case rule.Flag == RewritePermanent:
+			rw.redirect(target, http.StatusMovedPermanently)
+			return false
+		case rule.Flag == RewriteRedirect || external:
+			rw.redirect(target, http.StatusFound)
+			return false
+		}
+
+		rw.setURI(target)
+		switch rule.Flag {
+		case RewriteBreak:
+			return false
+		case RewriteLast:
+			rw.restart = true
+			return true
+		}
+	}
+	return true
+}
+
+// setURI remplace chemin et arguments. Des arguments dans la cible passent
+// devant ceux d'origine, sauf si la cible se termine par "?".
+func (rw *rewriter) setURI(target string) {
+	path, query, hasQuery := strings.Cut(target, "?")
+	u := *rw.r.URL
+	u.Path = path
+	u.RawPath = ""
+	switch {
+	case !hasQuery:
+	case query == "":
+		u.RawQuery = ""
+	case u.RawQuery != "":
+		u.RawQuery = query + "&" + u.RawQuery
+	default:
+		u.RawQuery = query
+	}
+	r := rw.r.Clone(rw.r.Context())
+	r.URL = &u
+	rw.r = r
+}
+
+func (rw *rewriter) redirect(target string, code int) {
+	if !strings.Contains(target, "?") && rw.r.URL.RawQuery != "" && !strings.HasSuffix(target, "?") {
+		target += "?" + rw.r.URL.RawQuery
+	}
+	http.Redirect(rw.w, rw.r, strings.TrimSuffix(target, "?"), code)
+	rw.done = true
+}
+
+func (rw *rewriter) respond(rule RewriteRule) {
+	rw.done = true
+	value := Vars{Request: rw.r}.Expand(rule.Replacement)
+
+	switch rule.Code {
+	case statusCloseConnection:
+		if hj, ok := rw.w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		rw.error(http.StatusForbidden)
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		if _, err := url.Parse(value); err != nil || value == "" {
+			rw.error(http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(rw.w, rw.r, value, rule.Code)
+	default:
+		if value == "" {
+			rw.error(rule.Code)
+			return
+		}
+		rw.w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.w.WriteHeader(rule.Code)
+		rw.w.Write([]byte(value))
+	}
+}
+
+func (rw *rewriter) error(status int) {
+	rw.done = true
+	if rw.opts.ErrorHandler != nil {
+		rw.opts.ErrorHandler(rw.w, rw.r, status)
+		return
+	}
+	rw.w.WriteHeader(status)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestVarsExpand(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/blog/2024/post?id=7&lang=fr", nil)
+	r.Host = "exemple.com:8443"
+	r.RemoteAddr = "203.0.113.9:51000"
+	r.Header.Set("User-Agent", "curl/8")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	vars := Vars{Request: r, Captures: []string{"/blog/2024/post", "2024", "post"}}
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"sans variable", "sans variable"},
+		{"$scheme://$host$request_uri", "http://exemple.com/blog/2024/post?id=7&lang=fr"},
+		{"$http_host", "exemple.com:8443"},
+		{"$uri$is_args$args", "/blog/2024/post?id=7&lang=fr"},
+		{"/articles/$1/$2", "/articles/2024/post"},
+		{"${1}x", "2024x"},
+		{"$9", ""},
+		{"$arg_lang", "fr"},
+		{"$cookie_session", "abc"},
+		{"$http_user_agent", "curl/8"},
+		{"$remote_addr $request_method", "203.0.113.9 GET"},
+		{"$inconnue", ""},
+	}
+	for _, tt := range tests {
+		if got := vars.Expand(tt.value); got != tt.want {
+			t.Errorf("%q : %q, attendu %q", tt.value, got, tt.want)
+		}
+	}
+
+	r.TLS = &tls.ConnectionState{}
+	lookup := Vars{Request: r, Lookup: func(name string) (string, bool) {
+		return "local", name == "host"
+	}}
+	if got := lookup.Expand("$scheme://$host"); got != "https://local" {
+		t.Errorf("Lookup prioritaire : %q", got)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	opts := RewriteOptions{
+		Rules: []RewriteRule{
+			{Pattern: regexp.MustCompile(`^/old/(.*)$`), Replacement: "/new/$1", Flag: RewritePermanent},
+			{Pattern: regexp.MustCompile(`^/ext$`), Replacement: "https://ailleurs.example$request_uri"},
+			{Pattern: regexp.MustCompile(`^/p/(\d+)$`), Replacement: "/post?id=$1", Flag: RewriteLast},
+			{Pattern: regexp.MustCompile(`^/clean$`), Replacement: "/propre?", Flag: RewriteBreak},
+		},
+		Locations: []Location{
+			{Prefix: "/post", Rewrites: []RewriteRule{
+				{Pattern: regexp.MustCompile(`^/post$`), Replacement: "/index.php", Flag: RewriteLast},
+			}},
+			{Prefix: "/gone", Rewrites: []RewriteRule{{Code: http.StatusGone, Replacement: "Supprimé de $host"}}},
+			{Prefix: "/moved", Rewrites: []RewriteRule{{Code: http.StatusFound, Replacement: "https://$host/ici"}}},
+			{Prefix: "/loop", Rewrites: []RewriteRule{
+				{Pattern: regexp.MustCompile(`^/loop/a$`), Replacement: "/loop/b", Flag: RewriteLast},
+				{Pattern: regexp.MustCompile(`^/loop/b$`), Replacement: "/loop/a", Flag: RewriteLast},
+			}},
+		},
+		Redirects: map[string]Redirect{
+			"/promo": {To: "/offres?src=$arg_src", Code: http.StatusTemporaryRedirect},
+		},
+	}
+	var seen string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.RequestURI()
+	})
+	handler := Rewrite(opts, next)
+
+	tests := []struct {
+		name     string
+		target   string
+		status   int
+		location string
+		body     string
+		seen     string // URI reçue par next, "" si la requête s'arrête avant
+	}{
+		{"sans règle applicable", "/autre?a=1", http.StatusOK, "", "", "/autre?a=1"},
+		{"permanent garde les arguments", "/old/page?a=1", http.StatusMovedPermanently, "/new/page?a=1", "", ""},
+		{"URL externe : 302", "/ext?q=go", http.StatusFound, "https://ailleurs.example/ext?q=go", "", ""},
+		{"last relance les locations", "/p/42?ref=x", http.StatusOK, "", "", "/index.php?id=42&ref=x"},
+		{"? final supprime les arguments", "/clean?a=1", http.StatusOK, "", "", "/propre"},
+		{"return texte", "/gone", http.StatusGone, "", "Supprimé de exemple.com", ""},
+		{"return redirection", "/moved", http.StatusFound, "https://exemple.com/ici", "", ""},
+		{"boucle interrompue", "/loop/a", http.StatusInternalServerError, "", "", ""},
+		{"redirects_file", "/promo/?src=mail", http.StatusTemporaryRedirect, "/offres?src=mail", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = ""
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Host = "exemple.com"
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("statut %d, attendu %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location %q, attendu %q", got, tt.location)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("corps %q, attendu %q", w.Body.String(), tt.body)
+			}
+			if seen != tt.seen {
+				t.Errorf("URI transmise %q, attendu %q", seen, tt.seen)
+			}
+		})
+	}
+}
+
+func TestLoadRedirects(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "redirects")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	redirects, err := LoadRedirects(write("# anciens liens\n/a /b\n\n/c https://exemple.com/d 302;\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(redirects) != 2 || redirects["/a"] != (Redirect{To: "/b", Code: 301}) ||
+		redirects["/c"] != (Redirect{To: "https://exemple.com/d", Code: 302}) {
+		t.Errorf("redirections %v", redirects)
+	}
+	for _, content := range []string{"/a\n", "/a /b 200\n", "/a /b 301 x\n"} {
+		if _, err := LoadRedirects(write(content)); err == nil {
+			t.Errorf("%q accepté", content)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	SymlinksAllow      = "off"          // disable_symlinks off : liens suivis tant qu'ils restent dans root
+	SymlinksDeny       = "on"           // disable_symlinks on : aucun lien symbolique
+	SymlinksIfNotOwner = "if_not_owner" // liens refusés si leur cible n'a pas le même propriétaire
+)
+
+var (
+	errHidden  = errors.New("fichier caché")
+	errSymlink = errors.New("lien symbolique refusé")
+)
+
+var (
+	rootsMu sync.Mutex
+	roots   = make(map[string]*openRoot)
+)
+
+type openRoot struct {
+	root *os.Root
+	info fs.FileInfo // Dossier effectivement ouvert, cible du lien comprise
+}
+
+// rootFor renvoie le os.Root partagé d'un dossier. Il est rouvert quand le
+// chemin désigne un autre dossier (lien symbolique basculé, dossier remplacé
+// par mv) ; l'ancien est fermé par le ramasse-miettes une fois les requêtes
+// en cours terminées. Un dossier absent est retenté à la requête suivante.
+func rootFor(dir string) (*os.Root, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	rootsMu.Lock()
+	defer rootsMu.Unlock()
+	cached, ok := roots[dir]
+	if ok && os.SameFile(cached.info, info) {
+		return cached.root, nil
+	}
+	if ok {
+		sharedFileCache().forget(filepath.Clean(dir))
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err = root.Stat("."); err != nil {
+		root.Close()
+		return nil, err
+	}
+	roots[dir] = &openRoot{root: root, info: info}
+	return root, nil
+}
+
+// resolve traduit un chemin public nettoyé ("/assets/app.js") en chemin
+// relatif à root, après les contrôles fichiers cachés et liens symboliques.
+// Les sorties de root (.., liens vers l'extérieur) sont refusées par os.Root.
+func resolve(root *os.Root, name string, opts StaticOptions) (string, error) {
+	rel := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if rel == "" {
+		return ".", nil
+	}
+	if !opts.AllowHidden && isHidden(rel) {
+		return "", errHidden
+	}
+	if opts.DisableSymlinks == SymlinksDeny || opts.DisableSymlinks == SymlinksIfNotOwner {
+		if err := checkSymlinks(root, rel, opts.DisableSymlinks); err != nil {
+			return "", err
+		}
+	}
+	return rel, nil
+}
+
+// isHidden repère un segment commençant par un point (.env, .git/config).
+// /.well-known reste public pour ACME et security.txt.
+func isHidden(rel string) bool {
+	for i, segment := range strings.Split(rel, "/") {
+		if i == 0 && segment == ".well-known" {
+			continue
+		}
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSymlinks parcourt chaque composant du chemin. Un composant absent
+// n'est pas une erreur ici : le stat qui suit renverra 404.
+func checkSymlinks(root *os.Root, rel, mode string) error {
+	segments := strings.Split(rel, "/")
+	for i := range segments {
+		prefix := strings.Join(segments[:i+1], "/")
+		link, err := root.Lstat(prefix)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if link.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if mode == SymlinksDeny {
+			return errSymlink
+		}
+		target, err := root.Stat(prefix)
+		if err != nil {
+			return err
+		}
+		linkOwner, ok1 := fileOwner(link)
+		targetOwner, ok2 := fileOwner(target)
+		if !ok1 || !ok2 || linkOwner != targetOwner {
+			return errSymlink
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticEngine sert opts avec un 404 pour les requêtes laissées à la suite.
+func staticEngine(opts StaticOptions) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Static(opts))
+	return r
+}
+
+func get(h http.Handler, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestRootFollowsSymlinkSwitch(t *testing.T) {
+	base := t.TempDir()
+	for _, release := range []string{"v1", "v2"} {
+		if err := os.MkdirAll(filepath.Join(base, release), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(base, release, "index.html"), []byte(release), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	current := filepath.Join(base, "current")
+	if err := os.Symlink("v1", current); err != nil {
+		t.Fatal(err)
+	}
+	r := staticEngine(StaticOptions{Root: current})
+
+	if body := get(r, "/index.html").Body.String(); body != "v1" {
+		t.Fatalf("avant bascule : %q, attendu v1", body)
+	}
+	// Bascule atomique comme un déploiement : nouveau lien renommé par-dessus.
+	if err := os.Symlink("v2", current+".tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(current+".tmp", current); err != nil {
+		t.Fatal(err)
+	}
+	if body := get(r, "/index.html").Body.String(); body != "v2" {
+		t.Errorf("après bascule : %q, attendu v2", body)
+	}
+
+	// Dossier remplacé par mv.
+	if err := os.Remove(current); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(base, "v1"), current); err != nil {
+		t.Fatal(err)
+	}
+	if body := get(r, "/index.html").Body.String(); body != "v1" {
+		t.Errorf("après mv : %q, attendu v1", body)
+	}
+}
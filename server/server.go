@@ -0,0 +1,3 @@
+// Package server regroupe les middlewares HTTP communs aux routers des sites
+// Goinx : fichiers statiques et en-têtes de réponse.
+package server
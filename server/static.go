@@ -0,0 +1,214 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+type CacheRule struct {
+	Pattern      string        // Glob sur le nom de fichier (*.js) ou le chemin (/assets/*)
+	CacheControl string        // Valeur explicite de Cache-Control (cache_control)
+	Expires      time.Duration // Durée pour expires ; < 0 = epoch (no-cache)
+	Off          bool          // expires off : aucun en-tête
+}
+
+type StaticOptions struct {
+	Root            string      // Dossier des fichiers statiques
+	SkipPrefixes    []string    // Préfixes laissés aux routes suivantes (route backend)
+	CacheRules      []CacheRule // Règles expires/cache_control, la première qui correspond gagne
+	ImmutableAssets bool        // Cache immuable pour les assets hashés (Vite, Vue CLI)
+	Precompressed   bool        // Sert les variantes .br/.gz existantes
+	AllowHidden     bool        // Sert les fichiers et dossiers commençant par "." (.env, .git...)
+	DisableSymlinks string      // SymlinksAllow (défaut), SymlinksDeny ou SymlinksIfNotOwner
+	Locations       []Location  // Blocs location (root, try_files), le plus long préfixe gagne
+	ErrorHandler    func(w http.ResponseWriter, r *http.Request, status int)
+}
+
+// Fichiers générés par Vite (index-BkP3xK9a.js) ou Vue CLI (app.3f4a2b1c.js).
+var hashedAsset = regexp.MustCompile(`[.-]([A-Za-z0-9_]{8,})\.(js|mjs|css|woff2?|ttf|otf|eot|svg|png|jpe?g|gif|webp|avif|ico|wasm|map)$`)
+
+// Static sert les fichiers de Root avec ETag fort, Last-Modified, requêtes
+// conditionnelles et Range, et choisit une variante précompressée quand le
+// client l'accepte. Un dossier sert son index.html. Les requêtes sans fichier
+// correspondant passent à la suite de la chaîne, sauf dans une location avec
+// try_files qui décide seule de la réponse.
+func Static(opts StaticOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, prefix := range opts.SkipPrefixes {
+			if prefix != "" && strings.HasPrefix(c.Request.URL.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		uri := c.Request.URL.Path
+		o := opts
+		loc := matchLocation(opts.Locations, uri)
+		if loc != nil && loc.Root != "" {
+			o.Root = loc.Root
+		}
+		if loc != nil && len(loc.TryFiles) > 0 {
+			tryFiles(c, loc, o)
+			c.Abort()
+			return
+		}
+		if ServeFile(c, uri, o) || serveIndex(c, strings.TrimSuffix(path.Clean("/"+uri), "/")+"/", o) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ServeFile sert le fichier de chemin public name, confiné à Root, s'il
+// existe et n'est pas un dossier. Un fichier caché ou un lien refusé reçoit
+// un 403 ; dans les deux cas ServeFile renvoie true, la requête est traitée.
+func ServeFile(c *gin.Context, name string, opts StaticOptions) bool {
+	root, err := rootFor(opts.Root)
+	if err != nil {
+		return false
+	}
+	name = path.Clean("/" + name)
+	rel, err := resolve(root, name, opts)
+	if err != nil {
+		writeError(c, opts, http.StatusForbidden)
+		return true
+	}
+
+	fc := sharedFileCache()
+	file := filepath.Join(opts.Root, filepath.FromSlash(rel))
+	entry := fc.stat(root, file, rel)
+	if entry.info == nil || entry.info.IsDir() {
+		return false
+	}
+
+	w := c.Writer
+	h := w.Header()
+
+	served, etag, encoding := rel, entry.etag, ""
+	if opts.Precompressed {
+		variants := false
+		for _, enc := range []struct{ name, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+			if _, err := resolve(root, name+enc.ext, opts); err != nil {
+				continue
+			}
+			variant := fc.stat(root, file+enc.ext, rel+enc.ext)
+			if variant.info == nil || variant.info.IsDir() {
+				continue
+			}
+			variants = true
+			if encoding == "" && acceptsEncoding(c.Request, enc.name) {
+				served = rel + enc.ext
+				etag = "" // Jamais l'ETag de la version non compressée
+				if variant.etag != "" {
+					etag = strings.TrimSuffix(variant.etag, `"`) + "-" + enc.name + `"`
+				}
+				encoding = enc.name
+			}
+		}
+		if variants {
+			h.Add("Vary", "Accept-Encoding")
+		}
+	}
+
+	f, err := root.Open(served)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		h.Set("Content-Type", ctype)
+	}
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+	}
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	applyCacheRules(h, name, opts)
+
+	http.ServeContent(w, c.Request, name, info.ModTime(), f)
+	return true
+}
+
+func applyCacheRules(h http.Header, name string, opts StaticOptions) {
+	for _, rule := range opts.CacheRules {
+		if !matchPattern(rule.Pattern, name) {
+			continue
+		}
+		switch {
+		case rule.CacheControl != "":
+			h.Set("Cache-Control", rule.CacheControl)
+		case rule.Off:
+		case rule.Expires < 0:
+			h.Set("Cache-Control", "no-cache")
+			h.Set("Expires", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+		default:
+			h.Set("Cache-Control", "max-age="+strconv.Itoa(int(rule.Expires.Seconds())))
+			h.Set("Expires", time.Now().Add(rule.Expires).UTC().Format(http.TimeFormat))
+		}
+		return
+	}
+	if opts.ImmutableAssets && isHashedAsset(name) {
+		h.Set("Cache-Control", immutableCacheControl)
+	}
+}
+
+// isHashedAsset exige au moins un chiffre dans le hash pour ne pas confondre
+// un nom comme "index-component.js" avec un fichier versionné.
+func isHashedAsset(name string) bool {
+	m := hashedAsset.FindStringSubmatch(path.Base(name))
+	return m != nil && strings.ContainsAny(m[1], "0123456789")
+}
+
+// matchPattern compare un motif au chemin s'il contient un "/", sinon au nom
+// du fichier. Un motif terminé par "/*" couvre tout le sous-arbre.
+func matchPattern(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// acceptsEncoding indique si Accept-Encoding autorise encoding (q > 0).
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if !strings.EqualFold(strings.TrimSpace(name), encoding) && strings.TrimSpace(name) != "*" {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if f, err := strconv.ParseFloat(q, 64); err == nil && f == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticTree crée base/secret.txt hors de root et, dans root, des fichiers
+// ordinaires, cachés et des liens symboliques.
+func staticTree(t *testing.T) string {
+	t.Helper()
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	files := map[string]string{
+		"secret.txt":                    "secret",
+		"root/app.js":                   "app",
+		"root/.env":                     "env",
+		"root/.git/config":              "git",
+		"root/.well-known/security.txt": "contact",
+		"root/%2e%2e/secret.txt":        "littéral",
+		"root/sub/page.html":            "page",
+	}
+	for name, content := range files {
+		file := filepath.Join(base, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"root/dehors":  "../secret.txt",
+		"root/absolu":  filepath.Join(base, "secret.txt"),
+		"root/interne": "app.js",
+		"root/lien":    "sub",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(base, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestStaticConfinement(t *testing.T) {
+	root := staticTree(t)
+	r := staticEngine(StaticOptions{Root: root})
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		body   string
+	}{
+		{"fichier", "/app.js", http.StatusOK, "app"},
+		{"remontée encodée", "/%2e%2e/secret.txt", http.StatusNotFound, ""},
+		{"barre encodée", "/..%2fsecret.txt", http.StatusNotFound, ""},
+		{"remontée profonde", "/sub/%2e%2e/%2e%2e/secret.txt", http.StatusNotFound, ""},
+		{"double encodage", "/%252e%252e/secret.txt", http.StatusOK, "littéral"},
+		{"antislash", `/..\secret.txt`, http.StatusForbidden, ""}, // Nom littéral commençant par un point
+		{"antislash encodé", "/..%5csecret.txt", http.StatusForbidden, ""},
+		{"antislash dans un dossier", `/sub/..\..\secret.txt`, http.StatusForbidden, ""},
+		{"fichier caché", "/.env", http.StatusForbidden, ""},
+		{"dossier caché", "/.git/config", http.StatusForbidden, ""},
+		{"caché encodé", "/%2eenv", http.StatusForbidden, ""},
+		{"caché après remontée", "/sub/../.env", http.StatusForbidden, ""},
+		{"well-known", "/.well-known/security.txt", http.StatusOK, "contact"},
+		{"lien hors de root", "/dehors", http.StatusNotFound, ""},
+		{"lien absolu hors de root", "/absolu", http.StatusNotFound, ""},
+		{"lien interne", "/interne", http.StatusOK, "app"},
+		{"dossier lié", "/lien/page.html", http.StatusOK, "page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(r, tt.target)
+			if rec.Code != tt.status {
+				t.Errorf("%s : statut %d, attendu %d", tt.target, rec.Code, tt.status)
+			}
+			if strings.Contains(rec.Body.String(), "secret") {
+				t.Errorf("%s : fichier hors de root servi", tt.target)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("%s : corps %q, attendu %q", tt.target, rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestStaticDisableSymlinks(t *testing.T) {
+	root := staticTree(t)
+	// Lien dont la cible appartient à un autre utilisateur (possible en root).
+	foreign := os.Geteuid() == 0
+	if foreign {
+		if err := os.WriteFile(filepath.Join(root, "autre.js"), []byte("autre"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chown(filepath.Join(root, "autre.js"), 65534, 65534); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("autre.js", filepath.Join(root, "etranger")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		mode    string
+		target  string
+		status  int
+		foreign bool
+	}{
+		{SymlinksAllow, "/interne", http.StatusOK, false},
+		{SymlinksAllow, "/lien/page.html", http.StatusOK, false},
+		{SymlinksAllow, "/dehors", http.StatusNotFound, false},
+		{SymlinksDeny, "/app.js", http.StatusOK, false},
+		{SymlinksDeny, "/interne", http.StatusForbidden, false},
+		{SymlinksDeny, "/lien/page.html", http.StatusForbidden, false},
+		{SymlinksDeny, "/dehors", http.StatusForbidden, false},
+		{SymlinksIfNotOwner, "/interne", http.StatusOK, false},
+		{SymlinksIfNotOwner, "/lien/page.html", http.StatusOK, false},
+		{SymlinksIfNotOwner, "/dehors", http.StatusForbidden, false},
+		{SymlinksIfNotOwner, "/etranger", http.StatusForbidden, true},
+		{SymlinksAllow, "/etranger", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+tt.target, func(t *testing.T) {
+			if tt.foreign && !foreign {
+				t.Skip("changement de propriétaire réservé à root")
+			}
+			rec := get(staticEngine(StaticOptions{Root: root, DisableSymlinks: tt.mode}), tt.target)
+			if rec.Code != tt.status {
+				t.Errorf("disable_symlinks %s %s : statut %d, attendu %d", tt.mode, tt.target, rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestServeFileConfinement(t *testing.T) {
+	root := staticTree(t)
+	for _, name := range []string{"../secret.txt", "../../secret.txt", "sub/../../secret.txt", "dehors"} {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		if ServeFile(c, name, StaticOptions{Root: root}) {
+			t.Errorf("ServeFile(%q) a servi %q", name, rec.Body.String())
+		}
+	}
+}
+
+func TestStaticVariantETag(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{"app.js": "app", "app.js.br": "br"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := staticEngine(StaticOptions{Root: root, Precompressed: true})
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+		req.Header.Set("Accept-Encoding", "br")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if etag := request().Header().Get("ETag"); !strings.HasSuffix(etag, `-br"`) || len(etag) <= len(`"-br"`) {
+		t.Errorf("ETag de la variante : %q", etag)
+	}
+
+	// ETag illisible (computeETag en échec) : aucun en-tête plutôt que `-br"`.
+	fc := sharedFileCache()
+	fc.stat(mustRoot(t, root), filepath.Join(root, "app.js.br"), "app.js.br").etag = ""
+	rec := request()
+	if etag := rec.Header().Get("ETag"); etag != "" {
+		t.Errorf("ETag sans empreinte de la variante : %q, attendu aucun", etag)
+	}
+	if rec.Body.String() != "br" {
+		t.Errorf("corps %q, attendu la variante br", rec.Body.String())
+	}
+}
+
+func mustRoot(t *testing.T, dir string) *os.Root {
+	t.Helper()
+	root, err := rootFor(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
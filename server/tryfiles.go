@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const indexFile = "index.html"
+
+type Location struct {
+	Prefix   string        // Préfixe d'URL, comparé par segment (/admin couvre /admin/users)
+	Root     string        // root propre à la location, vide = Root du site
+	TryFiles []string      // Candidats ($uri, $uri/, /index.html) puis repli (URI ou =code)
+	Rewrites []RewriteRule // rewrite/return propres à la location
+
+	AddHeaders    []HeaderRule // add_header propres à la location
+	RemoveHeaders []string     // remove_header propres à la location
+	Cors          *CorsPolicy  // Bloc cors de la location, remplace celui du site
+	VerifyClient  bool         // ssl_verify_client on : certificat client exigé
+}
+
+// Extensions d'asset : seul $uri peut satisfaire la requête, ni $uri/ ni un
+// candidat réécrit ni le repli. Un asset manquant reste un vrai 404, pas
+// index.html.
+var assetExtensions = map[string]bool{
+	".js": true, ".mjs": true, ".css": true, ".map": true, ".json": true, ".wasm": true,
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true,
+	".avif": true, ".ico": true, ".woff": true, ".woff2": true, ".ttf": true, ".otf": true,
+	".eot": true, ".mp4": true, ".webm": true, ".mp3": true, ".pdf": true, ".txt": true,
+}
+
+// matchLocation renvoie la location de plus long préfixe couvrant uri.
+func matchLocation(locations []Location, uri string) *Location {
+	var best *Location
+	for i := range locations {
+		loc := &locations[i]
+		prefix := strings.TrimSuffix(loc.Prefix, "/")
+		if uri != prefix && !strings.HasPrefix(uri, prefix+"/") {
+			continue
+		}
+		if best == nil || len(loc.Prefix) > len(best.Prefix) {
+			best = loc
+		}
+	}
+	return best
+}
+
+// tryFiles applique try_files : le premier candidat existant est servi,
+// sinon le dernier élément est un code (=404) ou une URI de repli.
+func tryFiles(c *gin.Context, loc *Location, opts StaticOptions) {
+	uri := c.Request.URL.Path
+	candidates, last := loc.TryFiles[:len(loc.TryFiles)-1], loc.TryFiles[len(loc.TryFiles)-1]
+	asset := assetExtensions[strings.ToLower(path.Ext(uri))]
+
+	for _, candidate := range candidates {
+		if asset && candidate != "$uri" {
+			continue
+		}
+		name := strings.ReplaceAll(candidate, "$uri", uri)
+		if strings.HasSuffix(name, "/") {
+			if serveIndex(c, name, opts) {
+				return
+			}
+			continue
+		}
+		if ServeFile(c, name, opts) {
+			return
+		}
+	}
+
+	if code, ok := strings.CutPrefix(last, "="); ok {
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			status = http.StatusNotFound
+		}
+		writeError(c, opts, status)
+		return
+	}
+	if asset || !ServeFile(c, strings.ReplaceAll(last, "$uri", uri), opts) {
+		writeError(c, opts, http.StatusNotFound)
+	}
+}
+
+// serveIndex sert index.html du dossier dir. Une requête sans "/" final est
+// redirigée vers le dossier, pour que les chemins relatifs de la page tiennent.
+func serveIndex(c *gin.Context, dir string, opts StaticOptions) bool {
+	root, err := rootFor(opts.Root)
+	if err != nil {
+		return false
+	}
+	rel, err := resolve(root, dir+indexFile, opts)
+	if err != nil {
+		return false
+	}
+	if info, err := root.Stat(rel); err != nil || info.IsDir() {
+		return false
+	}
+
+	if !strings.HasSuffix(c.Request.URL.Path, "/") && c.Request.URL.Path+"/" == dir {
+		target := dir
+		if c.Request.URL.RawQuery != "" {
+			target += "?" + c.Request.URL.RawQuery
+		}
+		c.Redirect(http.StatusMovedPermanently, target)
+		return true
+	}
+	return ServeFile(c, dir+indexFile, opts)
+}
+
+func writeError(c *gin.Context, opts StaticOptions, status int) {
+	if opts.ErrorHandler != nil {
+		opts.ErrorHandler(c.Writer, c.Request, status)
+		return
+	}
+	c.Status(status)
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchLocation(t *testing.T) {
+	locations := []Location{{Prefix: "/"}, {Prefix: "/api"}, {Prefix: "/api/v2/"}, {Prefix: "/docs"}}
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"/", "/"},
+		{"/index.html", "/"},
+		{"/api", "/api"},
+		{"/api/users", "/api"},
+		{"/apiv2", "/"}, // Comparaison par segment
+		{"/api/v2", "/api/v2/"},
+		{"/api/v2/users", "/api/v2/"},
+		{"/docs/guide", "/docs"},
+	}
+	for _, tt := range tests {
+		loc := matchLocation(locations, tt.uri)
+		if loc == nil || loc.Prefix != tt.want {
+			t.Errorf("%s : location %v, attendu %s", tt.uri, loc, tt.want)
+		}
+	}
+	if loc := matchLocation([]Location{{Prefix: "/api"}}, "/public"); loc != nil {
+		t.Errorf("/public : location %s, attendu aucune", loc.Prefix)
+	}
+}
+
+func TestTryFiles(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"index.html":                  "spa",
+		"app.js":                      "app",
+		"docs/index.html":             "docs",
+		"admin/index.html":            "admin",
+		"admin/missing.js/index.html": "dossier", // $uri/ ne doit pas le servir
+		"other/fallback.html":         "repli",
+	} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	locations := []Location{
+		{Prefix: "/", TryFiles: []string{"$uri", "$uri/", "/index.html", "=404"}},
+		{Prefix: "/admin", TryFiles: []string{"$uri", "$uri/", "/admin/index.html"}},
+		{Prefix: "/other", TryFiles: []string{"$uri", "/other/fallback.html", "=410"}},
+		{Prefix: "/strict", TryFiles: []string{"$uri", "=404"}},
+	}
+	r := staticEngine(StaticOptions{Root: root, Locations: locations})
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		body   string
+	}{
+		{"fichier existant", "/app.js", http.StatusOK, "app"},
+		{"route SPA", "/users/42", http.StatusOK, "spa"},
+		{"dossier", "/docs/", http.StatusOK, "docs"},
+		{"dossier sans barre", "/docs", http.StatusMovedPermanently, ""},
+		{"asset manquant avec =404", "/missing.js", http.StatusNotFound, ""},
+		{"asset manquant avec repli", "/admin/app.css", http.StatusNotFound, ""},
+		{"asset sur un dossier", "/admin/missing.js", http.StatusNotFound, ""},
+		{"route de la location", "/admin/users", http.StatusOK, "admin"},
+		{"candidat réécrit", "/other/page", http.StatusOK, "repli"},
+		{"asset et candidat réécrit", "/other/page.js", http.StatusGone, ""},
+		{"code de repli", "/strict/page", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(r, tt.target)
+			if rec.Code != tt.status {
+				t.Errorf("%s : statut %d, attendu %d", tt.target, rec.Code, tt.status)
+			}
+			if tt.body != "" && rec.Body.String() != tt.body {
+				t.Errorf("%s : corps %q, attendu %q", tt.target, rec.Body.String(), tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// $nom ou ${nom}, comme nginx.
+var variablePattern = regexp.MustCompile(`\$(\{[a-zA-Z0-9_]+\}|[a-zA-Z0-9_]+)`)
+
+// Vars interpole les variables nginx d'une requête : $host, $uri, $args,
+// $request_uri, $scheme, $remote_addr, $http_*, $arg_*, $cookie_* et les
+// captures $1..$9 de la dernière regex.
+type Vars struct {
+	Request  *http.Request
+	Captures []string                         // Sous-correspondances, Captures[0] = correspondance entière
+	Lookup   func(name string) (string, bool) // Variables propres à l'appelant, prioritaires
+}
+
+func (v Vars) Expand(value string) string {
+	if !strings.Contains(value, "$") {
+		return value
+	}
+	return variablePattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := strings.Trim(match[1:], "{}")
+		if s, ok := v.Get(name); ok {
+			return s
+		}
+		return ""
+	})
+}
+
+// Get renvoie la valeur d'une variable ; ok est faux si elle est inconnue.
+func (v Vars) Get(name string) (string, bool) {
+	if v.Lookup != nil {
+		if s, ok := v.Lookup(name); ok {
+			return s, true
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < len(v.Captures) {
+			return v.Captures[n], true
+		}
+		return "", true
+	}
+
+	r := v.Request
+	switch name {
+	case "host":
+		return hostOnly(r.Host), true
+	case "http_host":
+		return r.Host, true
+	case "scheme":
+		if r.TLS != nil {
+			return "https", true
+		}
+		return "http", true
+	case "request_uri":
+		// URI d'origine, même après rewrite ; forme absolue ramenée au chemin.
+		if strings.HasPrefix(r.RequestURI, "/") {
+			return r.RequestURI, true
+		}
+		if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+			return u.RequestURI(), true
+		}
+		return r.URL.RequestURI(), true
+	case "uri", "document_uri":
+		return r.URL.Path, true
+	case "args", "query_string":
+		return r.URL.RawQuery, true
+	case "is_args":
+		if r.URL.RawQuery != "" {
+			return "?", true
+		}
+		return "", true
+	case "request_method":
+		return r.Method, true
+	case "remote_addr":
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr, true
+		}
+		return host, true
+	}
+	switch {
+	case strings.HasPrefix(name, "http_"):
+		return r.Header.Get(strings.ReplaceAll(name[len("http_"):], "_", "-")), true
+	case strings.HasPrefix(name, "arg_"):
+		return r.URL.Query().Get(name[len("arg_"):]), true
+	case strings.HasPrefix(name, "cookie_"):
+		if c, err := r.Cookie(name[len("cookie_"):]); err == nil {
+			return c.Value, true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}